@@ -183,6 +183,16 @@ public class CarsController : ControllerBase
                 CarId = carId
             });
         }
+        catch (HttpRequestException ex)
+        {
+            _logger.LogError(ex, "Error registering new car on the blockchain");
+
+            return StatusCode(502, new CreateCarResponse
+            {
+                Success = false,
+                Message = "Car could not be registered on the blockchain"
+            });
+        }
         catch (Exception ex)
         {
             _logger.LogError(ex, "Error creating car");
@@ -237,6 +247,61 @@ public class CarsController : ControllerBase
         }
     }
 
+    [HttpPost("{carId}/register-on-chain")]
+    public async Task<ActionResult<RegisterCarOnChainResponse>> RegisterCarOnChain(int carId)
+    {
+        try
+        {
+            // Extract user ID from JWT token
+            var userIdClaim = User.FindFirst(JwtRegisteredClaimNames.Sub)?.Value
+                           ?? User.FindFirst(ClaimTypes.NameIdentifier)?.Value
+                           ?? User.FindFirst("sub")?.Value;
+
+            if (string.IsNullOrEmpty(userIdClaim) || !int.TryParse(userIdClaim, out int userId))
+            {
+                return Unauthorized(new RegisterCarOnChainResponse
+                {
+                    Success = false,
+                    Message = "Invalid authentication token"
+                });
+            }
+
+            // The ledger only lets the owner register a vehicle
+            var isOwner = await _carService.IsOwnerAsync(userId, carId);
+            if (!isOwner)
+            {
+                return Forbid();
+            }
+
+            var success = await _carService.RegisterCarOnChainAsync(carId, userId);
+
+            if (!success)
+            {
+                return BadRequest(new RegisterCarOnChainResponse
+                {
+                    Success = false,
+                    Message = "Car has no VIN"
+                });
+            }
+
+            return Ok(new RegisterCarOnChainResponse
+            {
+                Success = true,
+                Message = "Car registered on the blockchain"
+            });
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Error registering car {CarId} on the blockchain", carId);
+
+            return StatusCode(500, new RegisterCarOnChainResponse
+            {
+                Success = false,
+                Message = "Server error. Please try again later"
+            });
+        }
+    }
+
     [HttpPut("{carId}")]
     public async Task<ActionResult<UpdateCarResponse>> UpdateCar(int carId, [FromBody] UpdateCarRequest request)
     {
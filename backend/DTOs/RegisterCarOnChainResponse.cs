@@ -0,0 +1,7 @@
+namespace backend.DTOs;
+
+public class RegisterCarOnChainResponse
+{
+    public bool Success { get; set; }
+    public string Message { get; set; } = string.Empty;
+}
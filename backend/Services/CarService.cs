@@ -1,17 +1,20 @@
 using Microsoft.EntityFrameworkCore;
 using backend.Models;
 using backend.DTOs;
+using backend.Services.Fabric;
 
 namespace backend.Services;
 
 public class CarService
 {
     private readonly BlockchainDbContext _context;
+    private readonly FabricClient _fabricClient;
     private readonly ILogger<CarService> _logger;
 
-    public CarService(BlockchainDbContext context, ILogger<CarService> logger)
+    public CarService(BlockchainDbContext context, FabricClient fabricClient, ILogger<CarService> logger)
     {
         _context = context;
+        _fabricClient = fabricClient;
         _logger = logger;
     }
 
@@ -88,6 +91,9 @@ public class CarService
     {
         try
         {
+            // The car is only kept if it could be registered on the ledger
+            await using var transaction = await _context.Database.BeginTransactionAsync();
+
             var car = new CarTable
             {
                 Brand = request.Brand,
@@ -116,6 +122,20 @@ public class CarService
             _context.Users2Cars.Add(users2Car);
             await _context.SaveChangesAsync();
 
+            // The ledger rejects telemetry of unregistered vehicles. It needs a
+            // VIN, so cars created without one are registered later through
+            // RegisterCarOnChainAsync.
+            if (!string.IsNullOrWhiteSpace(car.Vin))
+            {
+                await _fabricClient.RegisterVehicleAsync(car.CarId.ToString(), car.Vin, userId.ToString());
+            }
+            else
+            {
+                _logger.LogWarning("Car {CarId} has no VIN and was not registered on the ledger", car.CarId);
+            }
+
+            await transaction.CommitAsync();
+
             _logger.LogInformation("Created car {CarId} for user {UserId}", car.CarId, userId);
             return car.CarId;
         }
@@ -126,6 +146,34 @@ public class CarService
         }
     }
 
+    /// <summary>
+    /// Registers a car created before the backend registered cars on the
+    /// ledger, or one created without a VIN. Returns false if the car does not
+    /// exist or still has no VIN.
+    /// </summary>
+    public async Task<bool> RegisterCarOnChainAsync(int carId, int userId)
+    {
+        var car = await _context.CarTables.FindAsync(carId);
+
+        if (car == null || string.IsNullOrWhiteSpace(car.Vin))
+        {
+            return false;
+        }
+
+        try
+        {
+            await _fabricClient.RegisterVehicleAsync(car.CarId.ToString(), car.Vin, userId.ToString());
+
+            _logger.LogInformation("Registered car {CarId} on the ledger for user {UserId}", carId, userId);
+            return true;
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Error registering car {CarId} on the ledger", carId);
+            throw;
+        }
+    }
+
     public async Task<bool> UpdateCarAsync(int carId, UpdateCarRequest request)
     {
         try
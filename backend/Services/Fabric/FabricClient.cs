@@ -14,6 +14,25 @@ public class FabricClient
         _logger = logger;
     }
 
+    /// <summary>
+    /// Registers a vehicle on the ledger, which only accepts telemetry for
+    /// registered vehicles. The gateway acts for the signed-in user, who must
+    /// be the owner.
+    /// </summary>
+    public async Task RegisterVehicleAsync(string onChainId, string vin, string ownerUserId)
+    {
+        var request = new
+        {
+            onChainId,
+            vin,
+            ownerUserId
+        };
+
+        var response = await _httpClient.PostAsJsonAsync("/api/vehicles", request);
+
+        response.EnsureSuccessStatusCode();
+    }
+
     public async Task<FabricResponse> SubmitTelemetryAsync(string carId, string carData)
     {
         var request = new
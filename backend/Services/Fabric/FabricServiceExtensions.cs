@@ -11,11 +11,23 @@ public static class FabricServiceExtensions
     {
         var fabricGatewayUrl = configuration["Fabric:GatewayUrl"] ?? "http://localhost:3001";
 
+        // Key issued by the gateway's /admin/keys; not needed when the gateway runs with API_AUTH=disabled
+        var fabricApiKey = configuration["Fabric:ApiKey"];
+
+        services.AddHttpContextAccessor();
+        services.AddTransient<FabricUserHandler>();
+
         services.AddHttpClient<FabricClient>(client =>
         {
             client.BaseAddress = new Uri(fabricGatewayUrl);
             client.Timeout = TimeSpan.FromSeconds(30);
-        });
+
+            if (!string.IsNullOrEmpty(fabricApiKey))
+            {
+                client.DefaultRequestHeaders.Add("X-API-Key", fabricApiKey);
+            }
+        })
+        .AddHttpMessageHandler<FabricUserHandler>();
 
         services.AddScoped<TelemetryService>();
 
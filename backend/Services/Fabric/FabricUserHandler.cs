@@ -0,0 +1,32 @@
+using System.IdentityModel.Tokens.Jwt;
+
+namespace backend.Services.Fabric;
+
+/// <summary>
+/// Names the signed-in user in the X-User-Id header of gateway requests, so the
+/// chaincode checks the user's role on the vehicle. Requests made outside an
+/// authenticated request act for the organization.
+/// </summary>
+public class FabricUserHandler : DelegatingHandler
+{
+    private readonly IHttpContextAccessor _httpContextAccessor;
+
+    public FabricUserHandler(IHttpContextAccessor httpContextAccessor)
+    {
+        _httpContextAccessor = httpContextAccessor;
+    }
+
+    protected override Task<HttpResponseMessage> SendAsync(
+        HttpRequestMessage request, CancellationToken cancellationToken)
+    {
+        var userId = _httpContextAccessor.HttpContext?.User.FindFirst(JwtRegisteredClaimNames.Sub)?.Value;
+
+        if (!string.IsNullOrEmpty(userId))
+        {
+            request.Headers.Remove("X-User-Id");
+            request.Headers.Add("X-User-Id", userId);
+        }
+
+        return base.SendAsync(request, cancellationToken);
+    }
+}
@@ -0,0 +1,209 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// accessObjectType is the object type of
+// access~onChainId~ownership~insuranceCompanyId, so that each owner's grants
+// are kept apart from those of earlier owners
+const accessObjectType = "access"
+
+// GrantAccess gives an insurance company access to a vehicle's data for
+// durationDays, replacing the current owner's previous grant to it.
+// insuranceMspId optionally names the company's organization, which may then
+// locate the vehicle if it is stolen. While the grant runs, writes to the
+// vehicle need that organization's endorsement as well.
+func (c *VehicleContract) GrantAccess(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	insuranceCompanyId string,
+	insuranceMspId string,
+	durationDays int,
+) (*AccessGrant, error) {
+	if insuranceCompanyId == "" {
+		return nil, fmt.Errorf("insuranceCompanyId is required")
+	}
+	if durationDays <= 0 {
+		return nil, fmt.Errorf("durationDays must be positive")
+	}
+
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUser(ctx, vehicle.OwnerMSPID, vehicle.OwnerUserID); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &AccessGrant{
+		OnChainID:          onChainId,
+		InsuranceCompanyID: insuranceCompanyId,
+		InsuranceMSPID:     insuranceMspId,
+		Ownership:          vehicle.Ownership,
+		GrantedAt:          now,
+		ExpiresAt:          now.AddDate(0, 0, durationDays),
+	}
+	if err := putAccessGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+	if _, err := endorseGrants(ctx, vehicle, grant, now); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// RevokeAccess ends the current owner's grant to an insurance company now
+// and drops the company's organization from the vehicle's endorsement
+// policy. The organization must endorse the revocation.
+func (c *VehicleContract) RevokeAccess(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	insuranceCompanyId string,
+) (*AccessGrant, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUser(ctx, vehicle.OwnerMSPID, vehicle.OwnerUserID); err != nil {
+		return nil, err
+	}
+
+	grant, err := c.ReadAccess(ctx, onChainId, insuranceCompanyId)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !grant.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("access of %s to vehicle %s has already ended", insuranceCompanyId, onChainId)
+	}
+
+	grant.ExpiresAt = now
+	if err := putAccessGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+	if _, err := endorseGrants(ctx, vehicle, grant, now); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// ReadAccess returns the current owner's grant to an insurance company
+func (c *VehicleContract) ReadAccess(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	insuranceCompanyId string,
+) (*AccessGrant, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := accessKey(ctx, &AccessGrant{
+		OnChainID:          onChainId,
+		InsuranceCompanyID: insuranceCompanyId,
+		Ownership:          vehicle.Ownership,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	grantJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if grantJSON == nil {
+		return nil, fmt.Errorf("access of %s to vehicle %s not found", insuranceCompanyId, onChainId)
+	}
+
+	var grant AccessGrant
+	if err := json.Unmarshal(grantJSON, &grant); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// GetAccessGrantsByVehicle returns the grants every owner of a vehicle has
+// made, oldest ownership first
+func (c *VehicleContract) GetAccessGrantsByVehicle(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]*AccessGrant, error) {
+	return readAccessGrants(ctx, []string{onChainId})
+}
+
+// endAccessGrants ends the grants of one ownership period that run past at
+func endAccessGrants(ctx contractapi.TransactionContextInterface, onChainId string, ownership int, at time.Time) error {
+	grants, err := readAccessGrants(ctx, []string{onChainId, sequenceKey(ownership)})
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		if !grant.ExpiresAt.After(at) {
+			continue
+		}
+		grant.ExpiresAt = at
+		if err := putAccessGrant(ctx, grant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAccessGrants returns the grants under a partial access key
+func readAccessGrants(ctx contractapi.TransactionContextInterface, attributes []string) ([]*AccessGrant, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accessObjectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var grants []*AccessGrant
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var grant AccessGrant
+		if err := json.Unmarshal(queryResponse.Value, &grant); err != nil {
+			return nil, err
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, nil
+}
+
+// accessKey returns the key a grant is stored under
+func accessKey(ctx contractapi.TransactionContextInterface, grant *AccessGrant) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(accessObjectType, []string{
+		grant.OnChainID, sequenceKey(grant.Ownership), grant.InsuranceCompanyID,
+	})
+}
+
+func putAccessGrant(ctx contractapi.TransactionContextInterface, grant *AccessGrant) error {
+	key, err := accessKey(ctx, grant)
+	if err != nil {
+		return err
+	}
+
+	grantJSON, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, grantJSON)
+}
@@ -0,0 +1,206 @@
+package contract
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Writes to a registered vehicle's assets must be endorsed by the peers of
+// the owner's organization and of every organization holding a running
+// access grant. The chaincode-level policy cannot name these per vehicle, so
+// each asset key carries a key-level policy instead. It is set on all of
+// them when the vehicle is registered, changes hands or an access grant is
+// made or revoked, and copied from the vehicle key onto assets created in
+// between. Telemetry readings are never changed once written and keep the
+// chaincode-level policy; the latest~carId pointer they update is covered.
+//
+// A policy change is validated against the policy it replaces, so an
+// organization leaves the policy in a transaction it endorses itself:
+// RevokeAccess, or RefreshEndorsement once its grant has expired.
+
+// endorsedObjectTypes are the assets keyed by onChainId that carry the
+// policy of vehicle~onChainId
+var endorsedObjectTypes = []string{
+	ownershipObjectType,
+	transferObjectType,
+	accessObjectType,
+	roleObjectType,
+	inviteObjectType,
+	latestObjectType,
+}
+
+// GetEndorsingOrganizations returns the organizations that must endorse
+// writes to a vehicle, sorted. It is empty for vehicles that are not
+// registered, whose writes only need the chaincode-level policy.
+func (c *VehicleContract) GetEndorsingOrganizations(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(vehicleObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(key)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return []string{}, nil
+	}
+
+	ep, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, err
+	}
+	orgs := ep.ListOrgs()
+	sort.Strings(orgs)
+	return orgs, nil
+}
+
+// RefreshEndorsement drops the organizations of expired access grants from
+// the policy of a vehicle's assets. Clients of the owner's organization call
+// it after a grant has run out; the expired grantee must still endorse it.
+func (c *VehicleContract) RefreshEndorsement(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]string, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != vehicle.OwnerMSPID {
+		return nil, fmt.Errorf("client of %s cannot refresh the endorsement of vehicle %s", mspID, onChainId)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return endorseGrants(ctx, vehicle, nil, now)
+}
+
+// endorsingOrgs returns the owner's organization and those of the grants
+// still running at now, sorted and without duplicates
+func endorsingOrgs(vehicle *Vehicle, grants []*AccessGrant, now time.Time) []string {
+	seen := map[string]bool{vehicle.OwnerMSPID: true}
+	orgs := []string{vehicle.OwnerMSPID}
+	for _, grant := range grants {
+		if grant.InsuranceMSPID == "" || seen[grant.InsuranceMSPID] || !grant.ExpiresAt.After(now) {
+			continue
+		}
+		seen[grant.InsuranceMSPID] = true
+		orgs = append(orgs, grant.InsuranceMSPID)
+	}
+	sort.Strings(orgs)
+	return orgs
+}
+
+// endorseGrants sets the policy of a vehicle's assets from its owner and the
+// current owner's grants running at now, and returns the organizations it
+// requires. changed is a grant the transaction writes, which the scan still
+// sees as committed before.
+func endorseGrants(ctx contractapi.TransactionContextInterface, vehicle *Vehicle, changed *AccessGrant, now time.Time) ([]string, error) {
+	grants, err := readAccessGrants(ctx, []string{vehicle.OnChainID, sequenceKey(vehicle.Ownership)})
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	running := []*AccessGrant{}
+	if changed != nil {
+		key, err := accessKey(ctx, changed)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, key)
+		running = append(running, changed)
+	}
+	for _, grant := range grants {
+		if changed == nil || grant.InsuranceCompanyID != changed.InsuranceCompanyID {
+			running = append(running, grant)
+		}
+	}
+
+	orgs := endorsingOrgs(vehicle, running, now)
+	if err := endorseVehicle(ctx, vehicle.OnChainID, orgs, endorsedObjectTypes, written...); err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// endorseVehicle requires orgs to endorse writes to the vehicle key, to the
+// committed keys of objectTypes under onChainId and to written, the keys the
+// transaction creates itself, which range scans do not see
+func endorseVehicle(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	orgs []string,
+	objectTypes []string,
+	written ...string,
+) error {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	if err := ep.AddOrgs(statebased.RoleTypePeer, orgs...); err != nil {
+		return err
+	}
+	policy, err := ep.Policy()
+	if err != nil {
+		return err
+	}
+
+	vehicleKey, err := ctx.GetStub().CreateCompositeKey(vehicleObjectType, []string{onChainId})
+	if err != nil {
+		return err
+	}
+	keys := append([]string{vehicleKey}, written...)
+
+	for _, objectType := range objectTypes {
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{onChainId})
+		if err != nil {
+			return err
+		}
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return err
+			}
+			keys = append(keys, queryResponse.Key)
+		}
+		resultsIterator.Close()
+	}
+
+	for _, key := range keys {
+		if err := ctx.GetStub().SetStateValidationParameter(key, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inheritEndorsement gives key, an asset of the vehicle, the policy of the
+// vehicle key. Assets of vehicles that are not registered keep the
+// chaincode-level policy.
+func inheritEndorsement(ctx contractapi.TransactionContextInterface, onChainId string, key string) error {
+	vehicleKey, err := ctx.GetStub().CreateCompositeKey(vehicleObjectType, []string{onChainId})
+	if err != nil {
+		return err
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(vehicleKey)
+	if err != nil || policy == nil {
+		return err
+	}
+	return ctx.GetStub().SetStateValidationParameter(key, policy)
+}
@@ -0,0 +1,282 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TelemetryFilter is the query language of QueryTelemetry. Conditions are
+// combined with AND and may only name fields in queryFields, so a filter can
+// neither reach other assets nor force a scan of an unindexed field.
+type TelemetryFilter struct {
+	Conditions []FilterCondition `json:"conditions"`
+	Sort       []FilterSort      `json:"sort"`
+	// Limit is the page size, defaultQueryLimit when zero
+	Limit    int32  `json:"limit"`
+	Bookmark string `json:"bookmark"`
+}
+
+// FilterCondition compares one field with a value. Value is a JSON string,
+// a number for the metrics fields, or for "in" an array of strings.
+type FilterCondition struct {
+	Field string          `json:"field"`
+	Op    string          `json:"op"`
+	Value json.RawMessage `json:"value"`
+}
+
+// FilterSort orders results by a field, "asc" (the default) or "desc"
+type FilterSort struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+}
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+	// maxInValues bounds the array of an "in" condition
+	maxInValues = 100
+)
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	// timeField values are RFC 3339 timestamps, normalized to UTC to match
+	// how insertTime is stored
+	timeField
+	numberField
+)
+
+type queryField struct {
+	// path is the field's location in the CouchDB document
+	path string
+	kind fieldKind
+}
+
+// queryFields are the indexed telemetry fields a filter may use
+var queryFields = map[string]queryField{
+	"carId":      {path: "carId", kind: stringField},
+	"insertTime": {path: "insertTime", kind: timeField},
+	"speedKmh":   {path: "metrics.speedKmh", kind: numberField},
+	"odometerKm": {path: "metrics.odometerKm", kind: numberField},
+	"latitude":   {path: "metrics.latitude", kind: numberField},
+	"longitude":  {path: "metrics.longitude", kind: numberField},
+}
+
+// queryOperators maps filter operators to CouchDB operators for each kind
+var queryOperators = map[fieldKind]map[string]string{
+	stringField: {"eq": "$eq", "ne": "$ne", "in": "$in"},
+	timeField:   {"eq": "$eq", "gt": "$gt", "gte": "$gte", "lt": "$lt", "lte": "$lte"},
+	numberField: {"eq": "$eq", "gt": "$gt", "gte": "$gte", "lt": "$lt", "lte": "$lte"},
+}
+
+// queryIndex mirrors an index in META-INF/statedb/couchdb/indexes
+type queryIndex struct {
+	ddoc   string
+	name   string
+	fields []string
+}
+
+// queryIndexes are the indexes a filter can be planned on, in order of
+// preference. The last one is the default.
+var queryIndexes = []queryIndex{
+	{ddoc: "indexCarInsertTimeDoc", name: "indexCarInsertTime", fields: []string{"carId", "insertTime"}},
+	{ddoc: "indexSpeedDoc", name: "indexSpeed", fields: []string{"metrics.speedKmh"}},
+	{ddoc: "indexOdometerDoc", name: "indexOdometer", fields: []string{"metrics.odometerKm"}},
+	{ddoc: "indexLocationDoc", name: "indexLocation", fields: []string{"metrics.latitude", "metrics.longitude"}},
+	{ddoc: "indexInsertTimeDoc", name: "indexInsertTime", fields: []string{"insertTime"}},
+}
+
+type sortField struct {
+	field     string
+	path      string
+	direction string
+}
+
+// compileFilter turns a filter into a CouchDB query string and page size.
+// The query names its index with use_index, so CouchDB never falls back to
+// scanning every document.
+func compileFilter(filter *TelemetryFilter) (string, int32, error) {
+	// Telemetry documents are the only ones with carData at the top level
+	selector := map[string]any{
+		"carData": map[string]any{"$exists": true},
+	}
+	// equality holds the fields restricted to given values, which an index
+	// may have ahead of the sort fields
+	equality := make(map[string]bool)
+
+	for i, condition := range filter.Conditions {
+		field, ok := queryFields[condition.Field]
+		if !ok {
+			return "", 0, fmt.Errorf("conditions[%d]: field %q cannot be queried", i, condition.Field)
+		}
+		operator, ok := queryOperators[field.kind][condition.Op]
+		if !ok {
+			return "", 0, fmt.Errorf("conditions[%d]: operator %q is not supported for %s", i, condition.Op, condition.Field)
+		}
+		value, err := compileValue(field, condition.Op, condition.Value)
+		if err != nil {
+			return "", 0, fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+
+		operators, _ := selector[field.path].(map[string]any)
+		if operators == nil {
+			operators = make(map[string]any)
+			selector[field.path] = operators
+		}
+		if _, exists := operators[operator]; exists {
+			return "", 0, fmt.Errorf("conditions[%d]: %s %s is given more than once", i, condition.Field, condition.Op)
+		}
+		operators[operator] = value
+		if operator == "$eq" || operator == "$in" {
+			equality[field.path] = true
+		}
+	}
+
+	var sort []sortField
+	for i, s := range filter.Sort {
+		field, ok := queryFields[s.Field]
+		if !ok {
+			return "", 0, fmt.Errorf("sort[%d]: field %q cannot be sorted on", i, s.Field)
+		}
+		direction := s.Direction
+		if direction == "" {
+			direction = "asc"
+		}
+		if direction != "asc" && direction != "desc" {
+			return "", 0, fmt.Errorf("sort[%d]: direction must be asc or desc", i)
+		}
+		// CouchDB rejects sorts that mix directions
+		if i > 0 && direction != sort[0].direction {
+			return "", 0, fmt.Errorf("sort[%d]: all sort fields must use the same direction", i)
+		}
+		sort = append(sort, sortField{field: s.Field, path: field.path, direction: direction})
+	}
+
+	index, sort, err := planIndex(selector, equality, sort)
+	if err != nil {
+		return "", 0, err
+	}
+	// CouchDB only uses an index if the selector names all of its fields;
+	// $gt null matches any value, so this only drops documents without them
+	for _, path := range index.fields {
+		if _, ok := selector[path]; !ok {
+			selector[path] = map[string]any{"$gt": nil}
+		}
+	}
+
+	query := map[string]any{
+		"selector":  selector,
+		"use_index": []string{"_design/" + index.ddoc, index.name},
+	}
+	if len(sort) > 0 {
+		var couchSort []map[string]string
+		for _, s := range sort {
+			couchSort = append(couchSort, map[string]string{s.path: s.direction})
+		}
+		query["sort"] = couchSort
+	}
+
+	limit := filter.Limit
+	switch {
+	case limit == 0:
+		limit = defaultQueryLimit
+	case limit < 0 || limit > maxQueryLimit:
+		return "", 0, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(queryJSON), limit, nil
+}
+
+// planIndex picks the first index that serves the sort and leads with a
+// queried field, or that the sort starts with. CouchDB can only sort on an
+// index's fields in order, so it returns the sort with any leading index
+// fields the filter restricts to given values prepended.
+func planIndex(selector map[string]any, equality map[string]bool, sort []sortField) (*queryIndex, []sortField, error) {
+	for i := range queryIndexes {
+		index := &queryIndexes[i]
+		offset, ok := sortOffset(index, equality, sort)
+		if !ok {
+			continue
+		}
+
+		_, queried := selector[index.fields[0]]
+		if !queried && !(len(sort) > 0 && offset == 0) && i != len(queryIndexes)-1 {
+			continue
+		}
+
+		var planned []sortField
+		if len(sort) > 0 {
+			for _, path := range index.fields[:offset] {
+				planned = append(planned, sortField{path: path, direction: sort[0].direction})
+			}
+			planned = append(planned, sort...)
+		}
+		return index, planned, nil
+	}
+
+	return nil, nil, fmt.Errorf("no index can sort by %s with these conditions", sort[0].field)
+}
+
+// sortOffset finds where sort lines up with the index's fields. Fields
+// before it must be restricted to given values for the order to hold.
+func sortOffset(index *queryIndex, equality map[string]bool, sort []sortField) (int, bool) {
+	if len(sort) == 0 {
+		return 0, true
+	}
+	for offset := 0; offset+len(sort) <= len(index.fields); offset++ {
+		matches := true
+		for i, s := range sort {
+			if index.fields[offset+i] != s.path {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return offset, true
+		}
+		if !equality[index.fields[offset]] {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+func compileValue(field queryField, op string, raw json.RawMessage) (any, error) {
+	if op == "in" {
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, fmt.Errorf("value of in must be an array of strings")
+		}
+		if len(values) == 0 || len(values) > maxInValues {
+			return nil, fmt.Errorf("value of in must have between 1 and %d entries", maxInValues)
+		}
+		return values, nil
+	}
+
+	if field.kind == numberField {
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("value must be a number")
+		}
+		return value, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("value must be a string")
+	}
+	if field.kind == timeField {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("value %q is not an RFC 3339 timestamp", value)
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	}
+	return value, nil
+}
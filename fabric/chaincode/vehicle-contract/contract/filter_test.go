@@ -0,0 +1,186 @@
+package contract
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		// want is the expected CouchDB query, compared as JSON
+		want      string
+		wantLimit int32
+		// wantErr is a substring of the expected error
+		wantErr string
+	}{
+		{
+			name:   "empty filter uses the default index",
+			filter: `{}`,
+			want: `{
+				"selector": {"carData": {"$exists": true}, "insertTime": {"$gt": null}},
+				"use_index": ["_design/indexInsertTimeDoc", "indexInsertTime"]
+			}`,
+			wantLimit: defaultQueryLimit,
+		},
+		{
+			name: "car readings newest first",
+			filter: `{
+				"conditions": [{"field": "carId", "op": "eq", "value": "7"}],
+				"sort": [{"field": "insertTime", "direction": "desc"}],
+				"limit": 10
+			}`,
+			want: `{
+				"selector": {"carData": {"$exists": true}, "carId": {"$eq": "7"}, "insertTime": {"$gt": null}},
+				"use_index": ["_design/indexCarInsertTimeDoc", "indexCarInsertTime"],
+				"sort": [{"carId": "desc"}, {"insertTime": "desc"}]
+			}`,
+			wantLimit: 10,
+		},
+		{
+			name: "cars given by in",
+			filter: `{
+				"conditions": [{"field": "carId", "op": "in", "value": ["1", "2"]}],
+				"sort": [{"field": "insertTime"}]
+			}`,
+			want: `{
+				"selector": {"carData": {"$exists": true}, "carId": {"$in": ["1", "2"]}, "insertTime": {"$gt": null}},
+				"use_index": ["_design/indexCarInsertTimeDoc", "indexCarInsertTime"],
+				"sort": [{"carId": "asc"}, {"insertTime": "asc"}]
+			}`,
+			wantLimit: defaultQueryLimit,
+		},
+		{
+			name: "metric range picks its index",
+			filter: `{
+				"conditions": [
+					{"field": "speedKmh", "op": "gte", "value": 100},
+					{"field": "speedKmh", "op": "lt", "value": 150}
+				]
+			}`,
+			want: `{
+				"selector": {"carData": {"$exists": true}, "metrics.speedKmh": {"$gte": 100, "$lt": 150}},
+				"use_index": ["_design/indexSpeedDoc", "indexSpeed"]
+			}`,
+			wantLimit: defaultQueryLimit,
+		},
+		{
+			name:   "timestamps are normalized to UTC",
+			filter: `{"conditions": [{"field": "insertTime", "op": "gt", "value": "2025-03-10T12:00:00+02:00"}]}`,
+			want: `{
+				"selector": {"carData": {"$exists": true}, "insertTime": {"$gt": "2025-03-10T10:00:00Z"}},
+				"use_index": ["_design/indexInsertTimeDoc", "indexInsertTime"]
+			}`,
+			wantLimit: defaultQueryLimit,
+		},
+		{
+			name:    "unknown field",
+			filter:  `{"conditions": [{"field": "carData", "op": "eq", "value": "x"}]}`,
+			wantErr: `field "carData" cannot be queried`,
+		},
+		{
+			name:    "operator not supported for the field",
+			filter:  `{"conditions": [{"field": "carId", "op": "gt", "value": "1"}]}`,
+			wantErr: `operator "gt" is not supported for carId`,
+		},
+		{
+			name: "same condition twice",
+			filter: `{"conditions": [
+				{"field": "speedKmh", "op": "gt", "value": 1},
+				{"field": "speedKmh", "op": "gt", "value": 2}
+			]}`,
+			wantErr: "speedKmh gt is given more than once",
+		},
+		{
+			name:    "number field given a string",
+			filter:  `{"conditions": [{"field": "odometerKm", "op": "eq", "value": "1000"}]}`,
+			wantErr: "value must be a number",
+		},
+		{
+			name:    "invalid timestamp",
+			filter:  `{"conditions": [{"field": "insertTime", "op": "gt", "value": "yesterday"}]}`,
+			wantErr: "not an RFC 3339 timestamp",
+		},
+		{
+			name:    "empty in",
+			filter:  `{"conditions": [{"field": "carId", "op": "in", "value": []}]}`,
+			wantErr: "value of in must have between 1 and",
+		},
+		{
+			name:    "invalid sort direction",
+			filter:  `{"sort": [{"field": "insertTime", "direction": "up"}]}`,
+			wantErr: "direction must be asc or desc",
+		},
+		{
+			name: "mixed sort directions",
+			filter: `{"sort": [
+				{"field": "carId", "direction": "asc"},
+				{"field": "insertTime", "direction": "desc"}
+			]}`,
+			wantErr: "all sort fields must use the same direction",
+		},
+		{
+			name: "sort no index serves",
+			filter: `{"sort": [
+				{"field": "insertTime"},
+				{"field": "carId"}
+			]}`,
+			wantErr: "no index can sort by insertTime",
+		},
+		{
+			name: "sort needing an unrestricted leading field",
+			filter: `{
+				"conditions": [{"field": "carId", "op": "ne", "value": "7"}],
+				"sort": [{"field": "latitude"}, {"field": "longitude"}, {"field": "insertTime"}]
+			}`,
+			wantErr: "no index can sort by latitude",
+		},
+		{
+			name:    "limit above the maximum",
+			filter:  `{"limit": 1001}`,
+			wantErr: "limit must be between 1 and 1000",
+		},
+		{
+			name:    "negative limit",
+			filter:  `{"limit": -1}`,
+			wantErr: "limit must be between 1 and 1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter TelemetryFilter
+			if err := json.Unmarshal([]byte(tt.filter), &filter); err != nil {
+				t.Fatalf("filter: %v", err)
+			}
+
+			query, limit, err := compileFilter(&filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileFilter: %v", err)
+			}
+
+			var got, want any
+			if err := json.Unmarshal([]byte(query), &got); err != nil {
+				t.Fatalf("query %s: %v", query, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("want: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got query %s\nwant %s", query, tt.want)
+			}
+			if limit != tt.wantLimit {
+				t.Errorf("got limit %d, want %d", limit, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package contract
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// userIDAttribute is the certificate attribute naming the backend user an
+// identity belongs to. Identities without it, such as the gateway's, act for
+// the user named in the transient map, which the gateway only sets for a
+// user bound to the caller's API key.
+const userIDAttribute = "userId"
+
+// userTransientKey is the transient map entry in which the gateway names the
+// backend user a request is made for
+const userTransientKey = "userId"
+
+// clientMSPID returns the organization of the identity that submitted the
+// transaction
+func clientMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity: %w", err)
+	}
+	return mspID, nil
+}
+
+// authorizeUser checks that the client acts for userId of mspID. Actions
+// taken by a party, such as proposing or accepting a transfer, need the
+// acting user to be that party; the organization alone cannot take them.
+func authorizeUser(ctx contractapi.TransactionContextInterface, mspID string, userId string) error {
+	clientMSP, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if clientMSP != mspID {
+		return fmt.Errorf("client of %s cannot act for user %s of %s", clientMSP, userId, mspID)
+	}
+
+	acting, err := actingUser(ctx)
+	if err != nil {
+		return err
+	}
+	if acting == "" {
+		return fmt.Errorf("no acting user; only user %s may do this", userId)
+	}
+	if acting != userId {
+		return fmt.Errorf("user %s cannot act for user %s", acting, userId)
+	}
+	return nil
+}
+
+// actingUser returns the backend user the transaction is made for: the
+// userId attribute of the client's certificate, or else the user named in
+// the transient map. It is empty when the organization itself, such as the
+// backend service or a device, makes the call.
+func actingUser(ctx contractapi.TransactionContextInterface) (string, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", err
+	}
+	named := string(transient[userTransientKey])
+
+	attr, found, err := ctx.GetClientIdentity().GetAttributeValue(userIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity: %w", err)
+	}
+	if !found {
+		return named, nil
+	}
+	if named != "" && named != attr {
+		return "", fmt.Errorf("client identity of user %s cannot act for user %s", attr, named)
+	}
+	return attr, nil
+}
+
+// txTime returns the transaction timestamp set by the client, which every
+// endorser sees, unlike the local clock
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return timestamp.AsTime(), nil
+}
@@ -0,0 +1,184 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Telemetry records are stored under telemetry~carId~yyyymmdd~nanos, where
+// yyyymmdd is the UTC day of the reading and nanos its Unix time in
+// nanoseconds. A day bucket can be read with GetStateByPartialCompositeKey,
+// which, unlike a rich query, works on LevelDB and is re-checked for phantom
+// reads at validation time. Records written before the buckets were
+// introduced use telemetry~carId~nanos until MigrateTelemetryKeys re-keys
+// them.
+const (
+	telemetryObjectType = "telemetry"
+	latestObjectType    = "latest"
+	dayLayout           = "20060102"
+)
+
+// maxBucketScan is the widest range, in days, read bucket by bucket. Wider
+// ranges read all of the car's records in one scan instead.
+const maxBucketScan = 31
+
+// telemetryKey builds the key of the reading taken by carId at insertTime
+func telemetryKey(ctx contractapi.TransactionContextInterface, carId string, insertTime time.Time) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(telemetryObjectType, []string{
+		carId,
+		insertTime.UTC().Format(dayLayout),
+		strconv.FormatInt(insertTime.UnixNano(), 10),
+	})
+}
+
+// splitTelemetryKey returns the car and Unix time in nanoseconds of a
+// telemetry key in either layout; legacy reports the pre-bucket layout
+func splitTelemetryKey(ctx contractapi.TransactionContextInterface, key string) (carId string, nanos int64, legacy bool, err error) {
+	objectType, attributes, err := ctx.GetStub().SplitCompositeKey(key)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if objectType != telemetryObjectType || len(attributes) < 2 || len(attributes) > 3 {
+		return "", 0, false, fmt.Errorf("%q is not a telemetry key", key)
+	}
+
+	nanos, err = strconv.ParseInt(attributes[len(attributes)-1], 10, 64)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("%q is not a telemetry key", key)
+	}
+	return attributes[0], nanos, len(attributes) == 2, nil
+}
+
+// parseTime parses an RFC 3339 timestamp argument. An empty value yields
+// def.
+func parseTime(name, value string, def int64) (int64, error) {
+	if value == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: expected an RFC 3339 timestamp", name, value)
+	}
+	return t.UnixNano(), nil
+}
+
+// scanTelemetry returns the car's readings taken from from to to, both
+// inclusive Unix times in nanoseconds, in chronological order. The upper
+// bound is capped at the car's latest reading, so an open range has a finite
+// span.
+func scanTelemetry(
+	ctx contractapi.TransactionContextInterface,
+	carId string,
+	from int64,
+	to int64,
+) ([]*VehicleTelemetry, error) {
+	latest, err := readLatest(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+	// Cars without a latest asset have not been written since before it
+	// existed and have only legacy keys
+	if latest == nil {
+		return readTelemetryRange(ctx, []string{carId}, from, to)
+	}
+
+	to = min(to, latest.Record.InsertTime.UnixNano())
+	if from > to {
+		return nil, nil
+	}
+	// The day buckets miss legacy keys, so a car is read in one scan until
+	// MigrateTelemetryKeys has re-keyed all of its records
+	if !latest.Migrated || bucketSpan(from, to) > maxBucketScan {
+		return readTelemetryRange(ctx, []string{carId}, from, to)
+	}
+
+	var records []*VehicleTelemetry
+	last := time.Unix(0, to).UTC().Format(dayLayout)
+	for day := time.Unix(0, from).UTC(); ; day = day.AddDate(0, 0, 1) {
+		bucket := day.Format(dayLayout)
+		dayRecords, err := readTelemetryRange(ctx, []string{carId, bucket}, from, to)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, dayRecords...)
+		if bucket == last {
+			return records, nil
+		}
+	}
+}
+
+// hasLegacyTelemetry reports whether any of the car's records use the
+// legacy layout
+func hasLegacyTelemetry(ctx contractapi.TransactionContextInterface, carId string) (bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(telemetryObjectType, []string{carId})
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		if _, _, legacy, err := splitTelemetryKey(ctx, queryResponse.Key); err == nil && legacy {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readTelemetryRange reads the telemetry keys under a partial key and
+// returns the records taken from from to to
+func readTelemetryRange(
+	ctx contractapi.TransactionContextInterface,
+	attributes []string,
+	from int64,
+	to int64,
+) ([]*VehicleTelemetry, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(telemetryObjectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []*VehicleTelemetry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, nanos, _, err := splitTelemetryKey(ctx, queryResponse.Key)
+		if err != nil || nanos < from || nanos > to {
+			continue
+		}
+
+		var record VehicleTelemetry
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return nil, err
+		}
+		record.Key = queryResponse.Key
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// bucketSpan is the number of UTC days from from to to, inclusive
+func bucketSpan(from, to int64) int {
+	const day = int64(24 * time.Hour)
+	return int(floorDiv(to, day)-floorDiv(from, day)) + 1
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
+}
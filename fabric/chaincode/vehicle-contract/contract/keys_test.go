@@ -0,0 +1,255 @@
+package contract
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// day0 is midnight UTC of the first day the test readings are taken on
+var day0 = time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+// reading describes a stored telemetry record
+type reading struct {
+	carId  string
+	at     time.Time
+	legacy bool
+}
+
+// putReadings stores the readings, under the legacy telemetry~carId~nanos
+// layout where asked to, without touching latest~carId
+func putReadings(t *testing.T, ctx *contractapi.TransactionContext, readings []reading) {
+	t.Helper()
+
+	for _, r := range readings {
+		record := &VehicleTelemetry{CarId: r.carId, CarData: "{}", InsertTime: r.at}
+		key, err := telemetryKey(ctx, r.carId, r.at)
+		if r.legacy {
+			key, err = ctx.GetStub().CreateCompositeKey(telemetryObjectType, []string{
+				r.carId,
+				strconv.FormatInt(r.at.UnixNano(), 10),
+			})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordJSON, err := marshalTelemetry(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.GetStub().PutState(key, recordJSON); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanTelemetry(t *testing.T) {
+	hours := func(h int) time.Time { return day0.Add(time.Duration(h) * time.Hour) }
+
+	tests := []struct {
+		name     string
+		readings []reading
+		// latest is the newest reading of car 1, if it has a latest asset
+		latest   *reading
+		migrated bool
+		from, to int64
+		want     []time.Time
+	}{
+		{
+			name:     "car without latest asset reads legacy keys",
+			readings: []reading{{"1", hours(1), true}, {"1", hours(30), true}},
+			from:     math.MinInt64, to: math.MaxInt64,
+			want: []time.Time{hours(1), hours(30)},
+		},
+		{
+			name:     "unmigrated car reads legacy and bucket keys",
+			readings: []reading{{"1", hours(1), true}, {"1", hours(30), false}},
+			latest:   &reading{"1", hours(30), false},
+			from:     hours(0).UnixNano(), to: hours(48).UnixNano(),
+			want: []time.Time{hours(1), hours(30)},
+		},
+		{
+			name:     "migrated car reads the day buckets in range",
+			readings: []reading{{"1", hours(1), false}, {"1", hours(30), false}, {"1", hours(54), false}},
+			latest:   &reading{"1", hours(54), false},
+			migrated: true,
+			from:     hours(0).UnixNano(), to: hours(47).UnixNano(),
+			want: []time.Time{hours(1), hours(30)},
+		},
+		{
+			name:     "bounds are inclusive",
+			readings: []reading{{"1", hours(1), false}, {"1", hours(2), false}, {"1", hours(3), false}},
+			latest:   &reading{"1", hours(3), false},
+			migrated: true,
+			from:     hours(1).UnixNano(), to: hours(2).UnixNano(),
+			want: []time.Time{hours(1), hours(2)},
+		},
+		{
+			name:     "range wider than maxBucketScan reads in one scan",
+			readings: []reading{{"1", hours(1), false}, {"1", hours(24 * 40), false}},
+			latest:   &reading{"1", hours(24 * 40), false},
+			migrated: true,
+			from:     math.MinInt64, to: math.MaxInt64,
+			want: []time.Time{hours(1), hours(24 * 40)},
+		},
+		{
+			name:     "open range ends at the latest reading",
+			readings: []reading{{"1", hours(1), false}, {"1", hours(2), false}},
+			latest:   &reading{"1", hours(2), false},
+			migrated: true,
+			from:     hours(1).UnixNano(), to: math.MaxInt64,
+			want: []time.Time{hours(1), hours(2)},
+		},
+		{
+			name:     "range after the latest reading is empty",
+			readings: []reading{{"1", hours(1), false}},
+			latest:   &reading{"1", hours(1), false},
+			migrated: true,
+			from:     hours(2).UnixNano(), to: math.MaxInt64,
+		},
+		{
+			name:     "other cars are left out",
+			readings: []reading{{"1", hours(1), false}, {"10", hours(2), false}, {"2", hours(3), true}},
+			latest:   &reading{"1", hours(1), false},
+			migrated: true,
+			from:     math.MinInt64, to: math.MaxInt64,
+			want: []time.Time{hours(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(t, "Org1MSP")
+			putReadings(t, ctx, tt.readings)
+			if tt.latest != nil {
+				key, err := telemetryKey(ctx, tt.latest.carId, tt.latest.at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				record := &VehicleTelemetry{CarId: tt.latest.carId, CarData: "{}", InsertTime: tt.latest.at}
+				if err := putLatest(ctx, &latestTelemetry{Key: key, Record: record, Migrated: tt.migrated}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			records, err := scanTelemetry(ctx, "1", tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("scanTelemetry: %v", err)
+			}
+			var got []time.Time
+			for _, record := range records {
+				got = append(got, record.InsertTime)
+			}
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("got readings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasLegacyTelemetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		readings []reading
+		want     bool
+	}{
+		{name: "no readings"},
+		{name: "bucket keys only", readings: []reading{{"1", day0, false}}},
+		{name: "legacy key", readings: []reading{{"1", day0, false}, {"1", day0.Add(time.Hour), true}}, want: true},
+		{name: "legacy key of another car", readings: []reading{{"1", day0, false}, {"10", day0, true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(t, "Org1MSP")
+			putReadings(t, ctx, tt.readings)
+
+			got, err := hasLegacyTelemetry(ctx, "1")
+			if err != nil {
+				t.Fatalf("hasLegacyTelemetry: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTelemetryKey(t *testing.T) {
+	ctx := newTestContext(t, "Org1MSP")
+	at := day0.Add(90 * time.Minute)
+	nanos := strconv.FormatInt(at.UnixNano(), 10)
+	key := func(objectType string, attributes ...string) string {
+		k, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantCar    string
+		wantLegacy bool
+		wantErr    bool
+	}{
+		{name: "bucket layout", key: key(telemetryObjectType, "7", "20250310", nanos), wantCar: "7"},
+		{name: "legacy layout", key: key(telemetryObjectType, "7", nanos), wantCar: "7", wantLegacy: true},
+		{name: "other object type", key: key(latestObjectType, "7", nanos), wantErr: true},
+		{name: "too few attributes", key: key(telemetryObjectType, "7"), wantErr: true},
+		{name: "time is not a number", key: key(telemetryObjectType, "7", "20250310", "noon"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carId, gotNanos, legacy, err := splitTelemetryKey(ctx, tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got car %q, want an error", carId)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitTelemetryKey: %v", err)
+			}
+			if carId != tt.wantCar || gotNanos != at.UnixNano() || legacy != tt.wantLegacy {
+				t.Errorf("got (%q, %d, %v), want (%q, %d, %v)", carId, gotNanos, legacy, tt.wantCar, at.UnixNano(), tt.wantLegacy)
+			}
+		})
+	}
+
+	// A reading's key must split back into the car and time it was built from
+	built, err := telemetryKey(ctx, "7", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carId, gotNanos, legacy, err := splitTelemetryKey(ctx, built); err != nil || carId != "7" || gotNanos != at.UnixNano() || legacy {
+		t.Errorf("telemetryKey round trip: got (%q, %d, %v, %v)", carId, gotNanos, legacy, err)
+	}
+}
+
+func TestBucketSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"same day", day0, day0.Add(23 * time.Hour), 1},
+		{"midnight starts a new day", day0.Add(-time.Nanosecond), day0, 2},
+		{"a week", day0, day0.AddDate(0, 0, 6), 7},
+		{"before the epoch", time.Unix(0, -1), time.Unix(0, 0), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucketSpan(tt.from.UnixNano(), tt.to.UnixNano()); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// latestTelemetry is stored under latest~carId and points at the newest
+// reading of a car. The reading is nested so that rich queries on telemetry
+// fields never match it.
+type latestTelemetry struct {
+	Key    string            `json:"key"`
+	Record *VehicleTelemetry `json:"latest"`
+	// Migrated is set once none of the car's records use the legacy
+	// telemetry~carId~nanos layout
+	Migrated bool `json:"migrated,omitempty"`
+}
+
+// GetLatestTelemetry returns the newest reading of a vehicle the acting user
+// may read. For a previous owner that is the newest of their own periods.
+func (c *VehicleContract) GetLatestTelemetry(
+	ctx contractapi.TransactionContextInterface,
+	carId string,
+) (*VehicleTelemetry, error) {
+	access, err := c.telemetryReader(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := readLatest(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("telemetry for vehicle %s not found", carId)
+	}
+	readable, err := access.readable(carId, latest.Record.InsertTime.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	if readable {
+		return latest.record(), nil
+	}
+
+	car, err := access.car(carId)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(car.periods) - 1; i >= 0; i-- {
+		records, err := scanTelemetry(ctx, carId, car.periods[i].from, car.periods[i].to)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			return records[len(records)-1], nil
+		}
+	}
+	return nil, fmt.Errorf("telemetry for vehicle %s not found", carId)
+}
+
+// GetLatestTelemetryForVehicles returns the newest reading of each of the
+// given vehicles, or of every vehicle if none are given. Vehicles without
+// telemetry, and those whose newest reading was taken after the acting user
+// held them, are left out.
+func (c *VehicleContract) GetLatestTelemetryForVehicles(
+	ctx contractapi.TransactionContextInterface,
+	carIds []string,
+) ([]*VehicleTelemetry, error) {
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*VehicleTelemetry
+
+	if len(carIds) > 0 {
+		for _, carId := range carIds {
+			latest, err := readLatest(ctx, carId)
+			if err != nil {
+				return nil, err
+			}
+			if latest != nil {
+				records = append(records, latest.record())
+			}
+		}
+		return access.filter(records)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(latestObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var latest latestTelemetry
+		if err := json.Unmarshal(queryResponse.Value, &latest); err != nil {
+			return nil, err
+		}
+		records = append(records, latest.record())
+	}
+
+	return access.filter(records)
+}
+
+// updateLatest points latest~carId at record unless the car already has a
+// newer reading. Every submission for a car reads this key, so concurrent
+// submissions for the same car fail MVCC validation; the gateway queues them
+// per car to avoid that.
+func updateLatest(ctx contractapi.TransactionContextInterface, key string, record *VehicleTelemetry) error {
+	latest, err := readLatest(ctx, record.CarId)
+	if err != nil {
+		return err
+	}
+	if latest != nil {
+		if !record.InsertTime.After(latest.Record.InsertTime) {
+			return nil
+		}
+		return putLatest(ctx, &latestTelemetry{Key: key, Record: record, Migrated: latest.Migrated})
+	}
+
+	// The car may have been written before latest~carId existed
+	legacy, err := hasLegacyTelemetry(ctx, record.CarId)
+	if err != nil {
+		return err
+	}
+	if err := putLatest(ctx, &latestTelemetry{Key: key, Record: record, Migrated: !legacy}); err != nil {
+		return err
+	}
+	return endorseLatest(ctx, record.CarId)
+}
+
+// endorseLatest gives a new latest~carId the policy of the car's vehicle key.
+// The key keeps its policy once set, so only a new pointer needs one.
+func endorseLatest(ctx contractapi.TransactionContextInterface, carId string) error {
+	latestKey, err := ctx.GetStub().CreateCompositeKey(latestObjectType, []string{carId})
+	if err != nil {
+		return err
+	}
+	return inheritEndorsement(ctx, carId, latestKey)
+}
+
+// putLatest stores the latest~carId asset of latest's car
+func putLatest(ctx contractapi.TransactionContextInterface, latest *latestTelemetry) error {
+	latestJSON, err := json.Marshal(latest)
+	if err != nil {
+		return err
+	}
+
+	latestKey, err := ctx.GetStub().CreateCompositeKey(latestObjectType, []string{latest.Record.CarId})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(latestKey, latestJSON)
+}
+
+// readLatest returns the latest~carId asset, or nil if the car has no
+// telemetry
+func readLatest(ctx contractapi.TransactionContextInterface, carId string) (*latestTelemetry, error) {
+	latestKey, err := ctx.GetStub().CreateCompositeKey(latestObjectType, []string{carId})
+	if err != nil {
+		return nil, err
+	}
+
+	latestJSON, err := ctx.GetStub().GetState(latestKey)
+	if err != nil {
+		return nil, err
+	}
+	if latestJSON == nil {
+		return nil, nil
+	}
+
+	var latest latestTelemetry
+	if err := json.Unmarshal(latestJSON, &latest); err != nil {
+		return nil, err
+	}
+	if latest.Record == nil {
+		return nil, fmt.Errorf("latest telemetry for vehicle %s is corrupt", carId)
+	}
+	return &latest, nil
+}
+
+// record returns the reading with the key it is stored under
+func (l *latestTelemetry) record() *VehicleTelemetry {
+	record := *l.Record
+	record.Key = l.Key
+	return &record
+}
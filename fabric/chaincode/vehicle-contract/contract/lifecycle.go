@@ -0,0 +1,301 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A vehicle is REGISTERED when created and ACTIVE once its owner puts it in
+// use. Accepting a transfer makes it SOLD until the new owner activates it.
+// The police report it STOLEN and, once recovered, ACTIVE again; a stolen
+// vehicle that is never recovered may be written off as SCRAPPED. SCRAPPED is
+// final, and scrapped vehicles accept no more telemetry.
+const (
+	statusRegistered = "REGISTERED"
+	statusActive     = "ACTIVE"
+	statusSold       = "SOLD"
+	statusStolen     = "STOLEN"
+	statusScrapped   = "SCRAPPED"
+)
+
+// Who may make a lifecycle transition: the owner's organization, the
+// police, the organization named by VehicleContract.PoliceMSPID, or either
+const (
+	byOwner         = "owner"
+	byPolice        = "police"
+	byOwnerOrPolice = "owner or police"
+)
+
+// lifecycleTransitions lists, per status, the statuses SetVehicleStatus may
+// move a vehicle to and who may do so. SOLD is only reached by a transfer.
+var lifecycleTransitions = map[string]map[string]string{
+	statusRegistered: {statusActive: byOwner, statusStolen: byPolice, statusScrapped: byOwner},
+	statusActive:     {statusStolen: byPolice, statusScrapped: byOwner},
+	statusSold:       {statusActive: byOwner, statusStolen: byPolice, statusScrapped: byOwner},
+	statusStolen:     {statusActive: byPolice, statusScrapped: byOwnerOrPolice},
+}
+
+// Events emitted when a vehicle is reported stolen and when it stops being
+// stolen, whether recovered or scrapped. The payload is a StolenVehicleEvent,
+// whose status tells the two apart; the location is not part of it, as every
+// channel member sees events, and is read with GetStolenVehicleLocation.
+const (
+	vehicleStolenEvent    = "VehicleStolen"
+	vehicleRecoveredEvent = "VehicleRecovered"
+)
+
+// SetVehicleStatus moves a vehicle to status if lifecycleTransitions allows
+// it and the client's organization may make the transition. An acting user
+// of the owner's organization must be an owner of the vehicle.
+func (c *VehicleContract) SetVehicleStatus(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	status string,
+) (*Vehicle, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	current := lifecycleStatus(vehicle)
+	actor, ok := lifecycleTransitions[current][status]
+	if !ok {
+		return nil, fmt.Errorf("vehicle %s cannot go from %s to %s", onChainId, current, status)
+	}
+
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch actor {
+	case byPolice:
+		if c.PoliceMSPID == "" {
+			return nil, fmt.Errorf("no police organization is configured to mark vehicle %s %s", onChainId, status)
+		}
+		if mspID != c.PoliceMSPID {
+			return nil, fmt.Errorf("only %s may mark vehicle %s %s", c.PoliceMSPID, onChainId, status)
+		}
+	case byOwner:
+		if err := authorizeOwnerOrg(ctx, vehicle); err != nil {
+			return nil, err
+		}
+	case byOwnerOrPolice:
+		if c.PoliceMSPID == "" || mspID != c.PoliceMSPID {
+			if err := authorizeOwnerOrg(ctx, vehicle); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle.Status = status
+	vehicle.StatusChangedAt = now
+	vehicle.StatusChangedBy = mspID
+	if err := putVehicle(ctx, vehicle); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case status == statusStolen:
+		err = emitStolenEvent(ctx, vehicleStolenEvent, vehicle)
+	case current == statusStolen:
+		err = emitStolenEvent(ctx, vehicleRecoveredEvent, vehicle)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vehicle, nil
+}
+
+// GetStolenVehicleLocation returns a stolen vehicle with its newest reading.
+// Only the police, the owner's organization and the organizations of the
+// owner's running access grants may read it.
+func (c *VehicleContract) GetStolenVehicleLocation(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) (*StolenVehicleReport, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if lifecycleStatus(vehicle) != statusStolen {
+		return nil, fmt.Errorf("vehicle %s is not reported stolen", onChainId)
+	}
+
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := c.mayLocate(ctx, vehicle, mspID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("client of %s may not locate vehicle %s", mspID, onChainId)
+	}
+	return stolenVehicleReport(ctx, vehicle)
+}
+
+// GetStolenVehicles returns the stolen vehicles the client's organization
+// may locate, each with its newest reading
+func (c *VehicleContract) GetStolenVehicles(
+	ctx contractapi.TransactionContextInterface,
+) ([]*StolenVehicleReport, error) {
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(vehicleObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	reports := []*StolenVehicleReport{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var vehicle Vehicle
+		if err := json.Unmarshal(queryResponse.Value, &vehicle); err != nil {
+			return nil, err
+		}
+		if lifecycleStatus(&vehicle) != statusStolen {
+			continue
+		}
+
+		allowed, err := c.mayLocate(ctx, &vehicle, mspID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+
+		report, err := stolenVehicleReport(ctx, &vehicle)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// lifecycleStatus returns the status of a vehicle. Vehicles registered
+// before statuses were recorded have none and count as REGISTERED.
+func lifecycleStatus(vehicle *Vehicle) string {
+	if vehicle.Status == "" {
+		return statusRegistered
+	}
+	return vehicle.Status
+}
+
+// acceptsTelemetry checks that a car is registered and not scrapped
+func acceptsTelemetry(ctx contractapi.TransactionContextInterface, carId string) error {
+	vehicle, err := readVehicle(ctx, carId)
+	if err != nil {
+		return err
+	}
+	if vehicle == nil {
+		return fmt.Errorf("vehicle %s is not registered", carId)
+	}
+	if lifecycleStatus(vehicle) == statusScrapped {
+		return fmt.Errorf("vehicle %s is scrapped", carId)
+	}
+	return nil
+}
+
+// authorizeOwnerOrg checks that the client belongs to the owner's
+// organization and, if it acts for a user, that the user is an owner
+func authorizeOwnerOrg(ctx contractapi.TransactionContextInterface, vehicle *Vehicle) error {
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != vehicle.OwnerMSPID {
+		return fmt.Errorf("client of %s does not belong to the owner of vehicle %s", mspID, vehicle.OnChainID)
+	}
+
+	acting, err := actingUser(ctx)
+	if err != nil || acting == "" {
+		return err
+	}
+	assignment, err := userRole(ctx, vehicle, acting)
+	if err != nil {
+		return err
+	}
+	if assignment == nil || assignment.Role != roleOwner || assignment.MSPID != mspID {
+		return fmt.Errorf("user %s is not an owner of vehicle %s", acting, vehicle.OnChainID)
+	}
+	return nil
+}
+
+// mayLocate reports whether mspID may read the location of a stolen vehicle:
+// the police, the owner's organization, and those of running access grants
+func (c *VehicleContract) mayLocate(ctx contractapi.TransactionContextInterface, vehicle *Vehicle, mspID string) (bool, error) {
+	if (c.PoliceMSPID != "" && mspID == c.PoliceMSPID) || mspID == vehicle.OwnerMSPID {
+		return true, nil
+	}
+
+	grants, err := readAccessGrants(ctx, []string{vehicle.OnChainID, sequenceKey(vehicle.Ownership)})
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, grant := range grants {
+		if grant.InsuranceMSPID == mspID && grant.ExpiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stolenVehicleReport returns a stolen vehicle with its newest reading, if
+// it has one
+func stolenVehicleReport(ctx contractapi.TransactionContextInterface, vehicle *Vehicle) (*StolenVehicleReport, error) {
+	report := &StolenVehicleReport{
+		OnChainID:  vehicle.OnChainID,
+		VIN:        vehicle.VIN,
+		OwnerMSPID: vehicle.OwnerMSPID,
+		ReportedAt: vehicle.StatusChangedAt,
+		ReportedBy: vehicle.StatusChangedBy,
+	}
+
+	latest, err := readLatest(ctx, vehicle.OnChainID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		report.LatestReading = latest.record()
+	}
+	return report, nil
+}
+
+// emitStolenEvent sets the transaction's chaincode event
+func emitStolenEvent(ctx contractapi.TransactionContextInterface, name string, vehicle *Vehicle) error {
+	payload, err := json.Marshal(StolenVehicleEvent{
+		OnChainID:  vehicle.OnChainID,
+		VIN:        vehicle.VIN,
+		OwnerMSPID: vehicle.OwnerMSPID,
+		Status:     vehicle.Status,
+		ChangedAt:  vehicle.StatusChangedAt,
+		ChangedBy:  vehicle.StatusChangedBy,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, payload)
+}
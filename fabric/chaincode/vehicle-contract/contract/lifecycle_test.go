@@ -0,0 +1,114 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+const (
+	testOwnerMSP  = "Org1MSP"
+	testPoliceMSP = "PoliceMSP"
+	testOtherMSP  = "Org2MSP"
+)
+
+var lifecycleStatuses = []string{statusRegistered, statusActive, statusSold, statusStolen, statusScrapped}
+
+func TestLifecycleTransitions(t *testing.T) {
+	type transition struct{ from, to string }
+	// allowed lists the organizations that may make each transition; every
+	// other transition is refused to all
+	allowed := map[transition][]string{
+		{statusRegistered, statusActive}:   {testOwnerMSP},
+		{statusRegistered, statusStolen}:   {testPoliceMSP},
+		{statusRegistered, statusScrapped}: {testOwnerMSP},
+		{statusActive, statusStolen}:       {testPoliceMSP},
+		{statusActive, statusScrapped}:     {testOwnerMSP},
+		{statusSold, statusActive}:         {testOwnerMSP},
+		{statusSold, statusStolen}:         {testPoliceMSP},
+		{statusSold, statusScrapped}:       {testOwnerMSP},
+		{statusStolen, statusActive}:       {testPoliceMSP},
+		{statusStolen, statusScrapped}:     {testOwnerMSP, testPoliceMSP},
+	}
+	// event is emitted when a vehicle becomes or stops being stolen
+	event := func(from, to string) string {
+		switch {
+		case to == statusStolen:
+			return vehicleStolenEvent
+		case from == statusStolen:
+			return vehicleRecoveredEvent
+		}
+		return ""
+	}
+
+	for _, from := range lifecycleStatuses {
+		for _, to := range lifecycleStatuses {
+			for _, mspID := range []string{testOwnerMSP, testPoliceMSP, testOtherMSP} {
+				want := false
+				for _, org := range allowed[transition{from, to}] {
+					want = want || org == mspID
+				}
+
+				t.Run(from+" to "+to+" by "+mspID, func(t *testing.T) {
+					ctx := newTestContext(t, mspID)
+					if err := putVehicle(ctx, &Vehicle{OnChainID: "1", VIN: "VIN1", OwnerUserID: "u1", OwnerMSPID: testOwnerMSP, Status: from}); err != nil {
+						t.Fatal(err)
+					}
+					contract := &VehicleContract{PoliceMSPID: testPoliceMSP}
+
+					vehicle, err := contract.SetVehicleStatus(ctx, "1", to)
+					if !want {
+						if err == nil {
+							t.Fatalf("transition was allowed")
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("SetVehicleStatus: %v", err)
+					}
+					if vehicle.Status != to || vehicle.StatusChangedBy != mspID {
+						t.Errorf("got status %s changed by %s", vehicle.Status, vehicle.StatusChangedBy)
+					}
+
+					stub := ctx.GetStub().(*shimtest.MockStub)
+					got := ""
+					select {
+					case e := <-stub.ChaincodeEventsChannel:
+						got = e.EventName
+					default:
+					}
+					if got != event(from, to) {
+						t.Errorf("got event %q, want %q", got, event(from, to))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestLifecycleTransitionsWithoutPolice(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{statusActive, statusStolen, false},
+		{statusStolen, statusActive, false},
+		{statusStolen, statusScrapped, true},
+		{statusActive, statusScrapped, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			ctx := newTestContext(t, testOwnerMSP)
+			if err := putVehicle(ctx, &Vehicle{OnChainID: "1", VIN: "VIN1", OwnerUserID: "u1", OwnerMSPID: testOwnerMSP, Status: tt.from}); err != nil {
+				t.Fatal(err)
+			}
+			contract := &VehicleContract{}
+
+			_, err := contract.SetVehicleStatus(ctx, "1", tt.to)
+			if got := err == nil; got != tt.want {
+				t.Errorf("got allowed %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// telemetryDocument is how a reading is stored: the record plus the metrics
+// parsed from carData, so CouchDB can index them. Metrics are not part of
+// VehicleTelemetry; clients read them from carData.
+type telemetryDocument struct {
+	*VehicleTelemetry
+	Metrics *telemetryMetrics `json:"metrics,omitempty"`
+}
+
+// telemetryMetrics are the carData fields with CouchDB indexes. Field names
+// match case-insensitively, so the backend's SpeedKmh fills speedKmh.
+type telemetryMetrics struct {
+	SpeedKmh   *float64 `json:"speedKmh,omitempty"`
+	OdometerKm *float64 `json:"odometerKm,omitempty"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+}
+
+// marshalTelemetry encodes record as it is stored in world state
+func marshalTelemetry(record *VehicleTelemetry) ([]byte, error) {
+	return json.Marshal(telemetryDocument{
+		VehicleTelemetry: record,
+		Metrics:          parseMetrics(record.CarData),
+	})
+}
+
+// parseMetrics extracts the indexed metrics from carData. carData is opaque
+// to the contract, so anything that is not a JSON object with numeric
+// metrics yields none rather than an error.
+func parseMetrics(carData string) *telemetryMetrics {
+	var metrics telemetryMetrics
+	if err := json.Unmarshal([]byte(carData), &metrics); err != nil {
+		// A mistyped field is skipped; the others are still filled in
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil
+		}
+	}
+	if metrics == (telemetryMetrics{}) {
+		return nil
+	}
+	return &metrics
+}
@@ -0,0 +1,226 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// migrationObjectType keys the markers of finished migrations
+const migrationObjectType = "migration"
+
+// telemetryKeysMigration is the marker written once no record uses the
+// legacy telemetry key layout
+const telemetryKeysMigration = "telemetryKeys"
+
+// migrationMarker is stored under migration~name once a migration is done
+type migrationMarker struct {
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// MigrationResult reports one batch of MigrateTelemetryKeys
+type MigrationResult struct {
+	Migrated int  `json:"migrated"`
+	Done     bool `json:"done"`
+}
+
+// MigrateTelemetryKeys moves up to batchSize records from the legacy
+// telemetry~carId~timestamp layout to telemetry~carId~yyyymmdd~timestamp,
+// repointing latest~carId and creating it for cars written before it
+// existed. Migrated records are stored with the indexed metrics parsed from
+// their carData. Call it until Done is true. A migrated record's history
+// starts at the migration; the old key keeps the earlier history.
+//
+// Once the scan has passed all of a car's keys, its latest~carId is marked
+// migrated and range reads of the car use the day buckets alone. When the
+// admin organization's scan has passed every key, GetTelemetryAfter stops
+// scanning all records as well.
+//
+// The admin organization migrates every record. Other organizations only
+// migrate those of the registered vehicles they own, and Done then means
+// none of those are left.
+func (c *VehicleContract) MigrateTelemetryKeys(
+	ctx contractapi.TransactionContextInterface,
+	batchSize int,
+) (*MigrationResult, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSize must be positive")
+	}
+
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(telemetryObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// Reads within a transaction do not see its own writes, so the latest
+	// asset of each car is tracked here and written once at the end
+	latest := make(map[string]*latestTelemetry)
+	changed := make(map[string]bool)
+	created := make(map[string]bool)
+	// owned caches whether the client may migrate a car's records
+	owned := make(map[string]bool)
+	// finished lists the allowed cars whose keys have all been scanned. Keys
+	// are sorted by car, so a car is finished when the next one starts.
+	var finished []string
+	scanning := ""
+
+	result := &MigrationResult{}
+	for resultsIterator.HasNext() {
+		if result.Migrated == batchSize {
+			break
+		}
+
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		carId, nanos, legacy, err := splitTelemetryKey(ctx, queryResponse.Key)
+		if err != nil {
+			continue
+		}
+
+		allowed, ok := owned[carId]
+		if !ok {
+			if allowed, err = c.mayMigrate(ctx, mspID, carId); err != nil {
+				return nil, err
+			}
+			owned[carId] = allowed
+		}
+		if carId != scanning {
+			if owned[scanning] {
+				finished = append(finished, scanning)
+			}
+			scanning = carId
+		}
+		if !allowed || !legacy {
+			continue
+		}
+
+		var record VehicleTelemetry
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return nil, fmt.Errorf("failed to migrate %q: %w", queryResponse.Key, err)
+		}
+
+		key, err := telemetryKey(ctx, carId, time.Unix(0, nanos))
+		if err != nil {
+			return nil, err
+		}
+		recordJSON, err := marshalTelemetry(&record)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().PutState(key, recordJSON); err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return nil, err
+		}
+		result.Migrated++
+
+		current, ok := latest[carId]
+		if !ok {
+			if current, err = readLatest(ctx, carId); err != nil {
+				return nil, err
+			}
+			created[carId] = current == nil
+		}
+		if current == nil || current.Key == queryResponse.Key || record.InsertTime.After(current.Record.InsertTime) {
+			current = &latestTelemetry{Key: key, Record: &record}
+			changed[carId] = true
+		}
+		latest[carId] = current
+	}
+	result.Done = result.Migrated < batchSize
+	if !resultsIterator.HasNext() {
+		if owned[scanning] {
+			finished = append(finished, scanning)
+		}
+		if c.AdminMSPID != "" && mspID == c.AdminMSPID {
+			if err := markMigrated(ctx, telemetryKeysMigration); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, carId := range finished {
+		current, ok := latest[carId]
+		if !ok {
+			if current, err = readLatest(ctx, carId); err != nil {
+				return nil, err
+			}
+		}
+		if current == nil || current.Migrated {
+			continue
+		}
+		current.Migrated = true
+		latest[carId] = current
+		changed[carId] = true
+	}
+
+	for carId := range changed {
+		if err := putLatest(ctx, latest[carId]); err != nil {
+			return nil, err
+		}
+		if !created[carId] {
+			continue
+		}
+		if err := endorseLatest(ctx, carId); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// mayMigrate reports whether a client of mspID may migrate a car's records:
+// the admin organization any car's, others those of the vehicles they own
+func (c *VehicleContract) mayMigrate(ctx contractapi.TransactionContextInterface, mspID string, carId string) (bool, error) {
+	if c.AdminMSPID != "" && mspID == c.AdminMSPID {
+		return true, nil
+	}
+
+	vehicle, err := readVehicle(ctx, carId)
+	if err != nil {
+		return false, err
+	}
+	return vehicle != nil && vehicle.OwnerMSPID == mspID, nil
+}
+
+// markMigrated records that a migration has finished
+func markMigrated(ctx contractapi.TransactionContextInterface, name string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(migrationObjectType, []string{name})
+	if err != nil {
+		return err
+	}
+	finishedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	markerJSON, err := json.Marshal(migrationMarker{FinishedAt: finishedAt})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, markerJSON)
+}
+
+// migrated reports whether a migration has finished
+func migrated(ctx contractapi.TransactionContextInterface, name string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(migrationObjectType, []string{name})
+	if err != nil {
+		return false, err
+	}
+	markerJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, err
+	}
+	return markerJSON != nil, nil
+}
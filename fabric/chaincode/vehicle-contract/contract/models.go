@@ -0,0 +1,141 @@
+package contract
+
+import (
+	"time"
+)
+
+// VehicleTelemetry stores car ID, car data, and timestamp
+type VehicleTelemetry struct {
+	CarId   string    `json:"carId"`
+	CarData string    `json:"carData"` // JSON string containing telemetry
+	InsertTime time.Time `json:"insertTime"`
+	// Key is the world state key the record was read from. It is filled in
+	// by the query functions and never stored.
+	Key string `json:"key,omitempty" metadata:",optional"`
+}
+
+// PaginatedQueryResult is used for paginated queries
+type PaginatedQueryResult struct {
+	Records             []*VehicleTelemetry `json:"records"`
+	FetchedRecordsCount int32               `json:"fetchedRecordsCount"`
+	Bookmark            string              `json:"bookmark"`
+}
+
+// CompiledQuery is the CouchDB query a TelemetryFilter compiles to
+type CompiledQuery struct {
+	Query    string `json:"query"`
+	PageSize int32  `json:"pageSize"`
+}
+
+// HistoryQueryResult structure for returning history query results
+type HistoryQueryResult struct {
+	TxId      string            `json:"txId"`
+	Timestamp time.Time         `json:"timestamp"`
+	IsDelete  bool              `json:"isDelete"`
+	Record    *VehicleTelemetry `json:"record"`
+}
+
+// Vehicle is stored under vehicle~onChainId. Ownership is the sequence of
+// the current ownership period. Status is the lifecycle status, last changed
+// at StatusChangedAt by a client of StatusChangedBy.
+type Vehicle struct {
+	OnChainID       string    `json:"onChainId"`
+	VIN             string    `json:"vin"`
+	OwnerUserID     string    `json:"ownerUserId"`
+	OwnerMSPID      string    `json:"ownerMspId"`
+	Ownership       int       `json:"ownership"`
+	RegisteredAt    time.Time `json:"registeredAt"`
+	Status          string    `json:"status"`
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+	StatusChangedBy string    `json:"statusChangedBy"`
+}
+
+// StolenVehicleReport is a stolen vehicle with its newest reading, which
+// carries its last known location
+type StolenVehicleReport struct {
+	OnChainID     string            `json:"onChainId"`
+	VIN           string            `json:"vin"`
+	OwnerMSPID    string            `json:"ownerMspId"`
+	ReportedAt    time.Time         `json:"reportedAt"`
+	ReportedBy    string            `json:"reportedBy"`
+	LatestReading *VehicleTelemetry `json:"latestReading,omitempty" metadata:",optional"`
+}
+
+// StolenVehicleEvent is the payload of the VehicleStolen and
+// VehicleRecovered chaincode events
+type StolenVehicleEvent struct {
+	OnChainID  string    `json:"onChainId"`
+	VIN        string    `json:"vin"`
+	OwnerMSPID string    `json:"ownerMspId"`
+	Status     string    `json:"status"`
+	ChangedAt  time.Time `json:"changedAt"`
+	ChangedBy  string    `json:"changedBy"`
+}
+
+// Ownership is one period of a vehicle's ownership chain, stored under
+// ownership~onChainId~sequence. The period runs from From up to, but not
+// including, To, an RFC 3339 timestamp that is empty for the current owner.
+type Ownership struct {
+	OnChainID   string    `json:"onChainId"`
+	Sequence    int       `json:"sequence"`
+	OwnerUserID string    `json:"ownerUserId"`
+	OwnerMSPID  string    `json:"ownerMspId"`
+	From        time.Time `json:"from"`
+	To          string    `json:"to,omitempty" metadata:",optional"`
+	TxID        string    `json:"txId"`
+}
+
+// TransferProposal is a pending ownership transfer, stored under
+// transfer~onChainId until it is accepted or cancelled
+type TransferProposal struct {
+	OnChainID  string    `json:"onChainId"`
+	FromUserID string    `json:"fromUserId"`
+	FromMSPID  string    `json:"fromMspId"`
+	ToUserID   string    `json:"toUserId"`
+	ToMSPID    string    `json:"toMspId"`
+	ProposedAt time.Time `json:"proposedAt"`
+	TxID       string    `json:"txId"`
+}
+
+// AccessGrant gives an insurance company read access to a vehicle's data
+// for one ownership period. It is stored under
+// access~onChainId~ownership~insuranceCompanyId and ends at the latest when
+// the vehicle is transferred. InsuranceMSPID is the company's organization
+// on the channel, which endorses writes to the vehicle while the grant runs;
+// it is empty for companies without one.
+type AccessGrant struct {
+	OnChainID          string    `json:"onChainId"`
+	InsuranceCompanyID string    `json:"insuranceCompanyId"`
+	InsuranceMSPID     string    `json:"insuranceMspId,omitempty" metadata:",optional"`
+	Ownership          int       `json:"ownership"`
+	GrantedAt          time.Time `json:"grantedAt"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+}
+
+// RoleAssignment gives a user a role on a vehicle, stored under
+// role~onChainId~userId. Role is OWNER, DRIVER or VIEWER, as in the
+// backend's Users2Car table.
+type RoleAssignment struct {
+	OnChainID  string    `json:"onChainId"`
+	UserID     string    `json:"userId"`
+	MSPID      string    `json:"mspId"`
+	Role       string    `json:"role"`
+	AssignedBy string    `json:"assignedBy"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
+
+// Invitation offers a user a role on a vehicle, stored under
+// invite~onChainId~inviteId. Status is PENDING until the invited user
+// accepts or declines or the inviter cancels it, as in the backend's
+// CarInvite table.
+type Invitation struct {
+	InviteID      string    `json:"inviteId"`
+	OnChainID     string    `json:"onChainId"`
+	InviterUserID string    `json:"inviterUserId"`
+	InvitedUserID string    `json:"invitedUserId"`
+	InvitedMSPID  string    `json:"invitedMspId"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
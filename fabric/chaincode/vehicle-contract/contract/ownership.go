@@ -0,0 +1,399 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A transfer moves a vehicle in two steps: the owner proposes it with
+// ProposeTransfer and the new owner takes over with AcceptTransfer. Until
+// then either of them can withdraw it with CancelTransfer. Accepting closes
+// the current ownership period and opens the next at the transaction time,
+// which is where telemetry and access grants are split between owners.
+const (
+	ownershipObjectType = "ownership"
+	transferObjectType  = "transfer"
+)
+
+// ProposeTransfer offers ownerUserId's vehicle to newOwnerUserId of
+// newOwnerMspId, or of the owner's organization if newOwnerMspId is empty.
+// A vehicle has at most one pending transfer, and stolen or scrapped
+// vehicles cannot be transferred.
+func (c *VehicleContract) ProposeTransfer(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	ownerUserId string,
+	newOwnerUserId string,
+	newOwnerMspId string,
+) (*TransferProposal, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if ownerUserId != vehicle.OwnerUserID {
+		return nil, fmt.Errorf("user %s does not own vehicle %s", ownerUserId, onChainId)
+	}
+	if err := authorizeUser(ctx, vehicle.OwnerMSPID, ownerUserId); err != nil {
+		return nil, err
+	}
+	if err := transferable(vehicle); err != nil {
+		return nil, err
+	}
+
+	if newOwnerUserId == "" {
+		return nil, fmt.Errorf("newOwnerUserId is required")
+	}
+	if newOwnerMspId == "" {
+		newOwnerMspId = vehicle.OwnerMSPID
+	}
+	if newOwnerUserId == vehicle.OwnerUserID && newOwnerMspId == vehicle.OwnerMSPID {
+		return nil, fmt.Errorf("user %s already owns vehicle %s", newOwnerUserId, onChainId)
+	}
+
+	pending, err := readTransfer(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("vehicle %s already has a pending transfer to user %s", onChainId, pending.ToUserID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &TransferProposal{
+		OnChainID:  onChainId,
+		FromUserID: vehicle.OwnerUserID,
+		FromMSPID:  vehicle.OwnerMSPID,
+		ToUserID:   newOwnerUserId,
+		ToMSPID:    newOwnerMspId,
+		ProposedAt: now,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+	if err := putTransfer(ctx, proposal); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// AcceptTransfer makes userId, who must be the proposed new owner, the owner
+// of the vehicle, which is SOLD until they activate it. Access grants of the previous owner that are still running
+// end at the transfer, and the roles they gave out are removed, so that
+// afterwards only the new owner's organization endorses writes to the
+// vehicle. It returns the new ownership period.
+func (c *VehicleContract) AcceptTransfer(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	userId string,
+) (*Ownership, error) {
+	proposal, err := getTransfer(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if userId != proposal.ToUserID {
+		return nil, fmt.Errorf("vehicle %s is not being transferred to user %s", onChainId, userId)
+	}
+	if err := authorizeUser(ctx, proposal.ToMSPID, userId); err != nil {
+		return nil, err
+	}
+
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if err := transferable(vehicle); err != nil {
+		return nil, err
+	}
+	previous, err := getOwnership(ctx, onChainId, vehicle.Ownership)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	previous.To = now.Format(time.RFC3339Nano)
+	if err := putOwnership(ctx, previous); err != nil {
+		return nil, err
+	}
+	if err := endAccessGrants(ctx, onChainId, previous.Sequence, now); err != nil {
+		return nil, err
+	}
+	if err := clearRoles(ctx, onChainId); err != nil {
+		return nil, err
+	}
+
+	ownership := &Ownership{
+		OnChainID:   onChainId,
+		Sequence:    previous.Sequence + 1,
+		OwnerUserID: proposal.ToUserID,
+		OwnerMSPID:  proposal.ToMSPID,
+		From:        now,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	if err := putOwnership(ctx, ownership); err != nil {
+		return nil, err
+	}
+
+	vehicle.OwnerUserID = ownership.OwnerUserID
+	vehicle.OwnerMSPID = ownership.OwnerMSPID
+	vehicle.Ownership = ownership.Sequence
+	vehicle.Status = statusSold
+	vehicle.StatusChangedAt = now
+	vehicle.StatusChangedBy = ownership.OwnerMSPID
+	if err := putVehicle(ctx, vehicle); err != nil {
+		return nil, err
+	}
+
+	if err := deleteTransfer(ctx, onChainId); err != nil {
+		return nil, err
+	}
+
+	// Roles and the transfer were deleted above and need no policy
+	ownershipKey, err := ctx.GetStub().CreateCompositeKey(ownershipObjectType, []string{onChainId, sequenceKey(ownership.Sequence)})
+	if err != nil {
+		return nil, err
+	}
+	err = endorseVehicle(ctx, onChainId, []string{ownership.OwnerMSPID},
+		[]string{ownershipObjectType, accessObjectType, inviteObjectType, latestObjectType}, ownershipKey)
+	if err != nil {
+		return nil, err
+	}
+	return ownership, nil
+}
+
+// CancelTransfer withdraws a pending transfer. userId must be the owner who
+// proposed it or the user it was offered to, who declines it that way.
+func (c *VehicleContract) CancelTransfer(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	userId string,
+) error {
+	proposal, err := getTransfer(ctx, onChainId)
+	if err != nil {
+		return err
+	}
+
+	switch userId {
+	case proposal.FromUserID:
+		err = authorizeUser(ctx, proposal.FromMSPID, userId)
+	case proposal.ToUserID:
+		err = authorizeUser(ctx, proposal.ToMSPID, userId)
+	default:
+		err = fmt.Errorf("user %s is not a party to the transfer of vehicle %s", userId, onChainId)
+	}
+	if err != nil {
+		return err
+	}
+
+	return deleteTransfer(ctx, onChainId)
+}
+
+// GetPendingTransfer returns the pending transfer of a vehicle
+func (c *VehicleContract) GetPendingTransfer(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) (*TransferProposal, error) {
+	return getTransfer(ctx, onChainId)
+}
+
+// GetOwnershipHistory returns the ownership chain of a vehicle, oldest first
+func (c *VehicleContract) GetOwnershipHistory(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]*Ownership, error) {
+	if _, err := getVehicle(ctx, onChainId); err != nil {
+		return nil, err
+	}
+	return readOwnerships(ctx, onChainId)
+}
+
+// GetTelemetryForOwnership returns the telemetry a vehicle recorded during
+// one ownership period, in chronological order. The first period also
+// covers readings submitted before the vehicle was registered. Only the
+// owner of the period, and those with a role while it is current, see its
+// readings.
+func (c *VehicleContract) GetTelemetryForOwnership(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	sequence int,
+) ([]*VehicleTelemetry, error) {
+	access, err := c.telemetryReader(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	ownership, err := getOwnership(ctx, onChainId, sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := ownershipSpan(ownership)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanTelemetry(ctx, onChainId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return access.filter(records)
+}
+
+// transferable checks that a vehicle is neither stolen nor scrapped
+func transferable(vehicle *Vehicle) error {
+	switch status := lifecycleStatus(vehicle); status {
+	case statusStolen, statusScrapped:
+		return fmt.Errorf("vehicle %s is %s and cannot be transferred", vehicle.OnChainID, strings.ToLower(status))
+	}
+	return nil
+}
+
+// sequenceKey formats an ownership sequence so that keys sort in order
+func sequenceKey(sequence int) string {
+	return fmt.Sprintf("%06d", sequence)
+}
+
+// ownershipSpan returns the inclusive range of reading times, in Unix
+// nanoseconds, an ownership period covers
+func ownershipSpan(ownership *Ownership) (from, to int64, err error) {
+	from = ownership.From.UnixNano()
+	if ownership.Sequence == 1 {
+		from = math.MinInt64
+	}
+	to, err = parseTime("to", ownership.To, math.MaxInt64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ownership.To != "" {
+		to--
+	}
+	return from, to, nil
+}
+
+// readOwnerships returns the ownership periods of a vehicle, oldest first
+func readOwnerships(ctx contractapi.TransactionContextInterface, onChainId string) ([]*Ownership, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ownershipObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var chain []*Ownership
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var ownership Ownership
+		if err := json.Unmarshal(queryResponse.Value, &ownership); err != nil {
+			return nil, err
+		}
+		chain = append(chain, &ownership)
+	}
+
+	return chain, nil
+}
+
+// getOwnership returns one ownership period of a vehicle
+func getOwnership(ctx contractapi.TransactionContextInterface, onChainId string, sequence int) (*Ownership, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(ownershipObjectType, []string{onChainId, sequenceKey(sequence)})
+	if err != nil {
+		return nil, err
+	}
+
+	ownershipJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if ownershipJSON == nil {
+		return nil, fmt.Errorf("ownership %d of vehicle %s not found", sequence, onChainId)
+	}
+
+	var ownership Ownership
+	if err := json.Unmarshal(ownershipJSON, &ownership); err != nil {
+		return nil, err
+	}
+	return &ownership, nil
+}
+
+func putOwnership(ctx contractapi.TransactionContextInterface, ownership *Ownership) error {
+	key, err := ctx.GetStub().CreateCompositeKey(ownershipObjectType, []string{ownership.OnChainID, sequenceKey(ownership.Sequence)})
+	if err != nil {
+		return err
+	}
+
+	ownershipJSON, err := json.Marshal(ownership)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, ownershipJSON)
+}
+
+// getTransfer returns the pending transfer of a vehicle, or an error if
+// there is none
+func getTransfer(ctx contractapi.TransactionContextInterface, onChainId string) (*TransferProposal, error) {
+	proposal, err := readTransfer(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if proposal == nil {
+		return nil, fmt.Errorf("pending transfer of vehicle %s not found", onChainId)
+	}
+	return proposal, nil
+}
+
+// readTransfer returns the pending transfer of a vehicle, or nil if there is
+// none
+func readTransfer(ctx contractapi.TransactionContextInterface, onChainId string) (*TransferProposal, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(transferObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+
+	proposalJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if proposalJSON == nil {
+		return nil, nil
+	}
+
+	var proposal TransferProposal
+	if err := json.Unmarshal(proposalJSON, &proposal); err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+func putTransfer(ctx contractapi.TransactionContextInterface, proposal *TransferProposal) error {
+	key, err := ctx.GetStub().CreateCompositeKey(transferObjectType, []string{proposal.OnChainID})
+	if err != nil {
+		return err
+	}
+
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, proposalJSON); err != nil {
+		return err
+	}
+	return inheritEndorsement(ctx, proposal.OnChainID, key)
+}
+
+func deleteTransfer(ctx contractapi.TransactionContextInterface, onChainId string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(transferObjectType, []string{onChainId})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
@@ -0,0 +1,274 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// QueryResult structure for returning query results
+type QueryResult struct {
+	Key    string            `json:"key"`
+	Record *VehicleTelemetry `json:"record"`
+}
+
+// GetAllTelemetry returns all telemetry records from world state
+func (c *VehicleContract) GetAllTelemetry(ctx contractapi.TransactionContextInterface) ([]*VehicleTelemetry, error) {
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use partial composite key to get all telemetry records
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(telemetryObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []*VehicleTelemetry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record VehicleTelemetry
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			continue // Skip non-telemetry entries
+		}
+		record.Key = queryResponse.Key
+		records = append(records, &record)
+	}
+
+	return access.filter(records)
+}
+
+// GetTelemetryAfter returns telemetry records inserted after a specific timestamp
+// timestamp should be in RFC3339 format: "2024-01-01T00:00:00Z"
+// Once MigrateTelemetryKeys has re-keyed every record, only vehicles whose
+// latest reading is newer are scanned, bucket by bucket. Until then every
+// record is read, as some are only found under the legacy layout.
+func (c *VehicleContract) GetTelemetryAfter(
+	ctx contractapi.TransactionContextInterface,
+	timestamp string,
+) ([]*VehicleTelemetry, error) {
+	if timestamp == "" {
+		return nil, fmt.Errorf("timestamp is required")
+	}
+	after, err := parseTime("timestamp", timestamp, 0)
+	if err != nil {
+		return nil, err
+	}
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := migrated(ctx, telemetryKeysMigration)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		records, err := readTelemetryRange(ctx, []string{}, after+1, math.MaxInt64)
+		if err != nil {
+			return nil, err
+		}
+		return access.filter(records)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(latestObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []*VehicleTelemetry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var latest latestTelemetry
+		if err := json.Unmarshal(queryResponse.Value, &latest); err != nil {
+			return nil, err
+		}
+		if latest.Record == nil || !latest.Record.InsertTime.After(time.Unix(0, after)) {
+			continue
+		}
+
+		carRecords, err := scanTelemetry(ctx, latest.Record.CarId, after+1, math.MaxInt64)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, carRecords...)
+	}
+
+	return access.filter(records)
+}
+
+// GetTelemetryByRange returns telemetry for a vehicle within a time range
+// startTime and endTime are inclusive RFC3339 timestamps; either may be empty
+// to leave that end of the range open
+func (c *VehicleContract) GetTelemetryByRange(
+	ctx contractapi.TransactionContextInterface,
+	carId string,
+	startTime string,
+	endTime string,
+) ([]*VehicleTelemetry, error) {
+	access, err := c.telemetryReader(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := parseTime("startTime", startTime, math.MinInt64)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseTime("endTime", endTime, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := scanTelemetry(ctx, carId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return access.filter(records)
+}
+
+// QueryTelemetry runs a TelemetryFilter, given as JSON, and returns one page
+// of matching records. Pass the returned bookmark in the next filter to get
+// the following page. Records of vehicles the acting user has no role on are
+// left out, so a page may hold fewer records than the limit.
+func (c *VehicleContract) QueryTelemetry(
+	ctx contractapi.TransactionContextInterface,
+	filterJSON string,
+) (*PaginatedQueryResult, error) {
+	filter, queryString, pageSize, err := parseFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, filter.Bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []*VehicleTelemetry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record VehicleTelemetry
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		record.Key = queryResponse.Key
+		records = append(records, &record)
+	}
+
+	records, err = access.filter(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             records,
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// CompileTelemetryQuery returns the CouchDB query QueryTelemetry would run
+// for a filter, for checking its plan with CouchDB's _explain
+func (c *VehicleContract) CompileTelemetryQuery(
+	ctx contractapi.TransactionContextInterface,
+	filterJSON string,
+) (*CompiledQuery, error) {
+	_, queryString, pageSize, err := parseFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledQuery{Query: queryString, PageSize: pageSize}, nil
+}
+
+// GetTelemetryHistory returns the history of changes for a specific telemetry record
+func (c *VehicleContract) GetTelemetryHistory(
+	ctx contractapi.TransactionContextInterface,
+	key string,
+) ([]HistoryQueryResult, error) {
+	carId, nanos, _, err := splitTelemetryKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	access, err := c.telemetryReader(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+	if err := access.checkReading(carId, nanos); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []HistoryQueryResult
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record VehicleTelemetry
+		if len(response.Value) > 0 {
+			err = json.Unmarshal(response.Value, &record)
+			if err != nil {
+				return nil, err
+			}
+			record.Key = key
+		}
+
+		// Convert protobuf timestamp to time.Time
+		timestamp := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos))
+
+		historyRecord := HistoryQueryResult{
+			TxId:      response.TxId,
+			Timestamp: timestamp,
+			IsDelete:  response.IsDelete,
+			Record:    &record,
+		}
+		records = append(records, historyRecord)
+	}
+
+	return records, nil
+}
+
+func parseFilter(filterJSON string) (*TelemetryFilter, string, int32, error) {
+	var filter TelemetryFilter
+	if err := json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+		return nil, "", 0, fmt.Errorf("invalid filter: %w", err)
+	}
+	queryString, pageSize, err := compileFilter(&filter)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("invalid filter: %w", err)
+	}
+	return &filter, queryString, pageSize, nil
+}
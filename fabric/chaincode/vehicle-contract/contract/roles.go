@@ -0,0 +1,752 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Roles mirror the backend's Users2Car roles. The registered owner holds
+// OWNER without an assignment; assigning OWNER to someone else makes a
+// co-owner, who manages roles and invitations like the registered owner but
+// cannot transfer the vehicle. A transfer clears every assignment and
+// cancels pending invitations, so the new owner starts with no one else.
+const (
+	roleObjectType   = "role"
+	inviteObjectType = "invite"
+)
+
+const (
+	roleOwner  = "OWNER"
+	roleDriver = "DRIVER"
+	roleViewer = "VIEWER"
+)
+
+const (
+	invitePending   = "PENDING"
+	inviteAccepted  = "ACCEPTED"
+	inviteDeclined  = "DECLINED"
+	inviteCancelled = "CANCELLED"
+)
+
+// InviteUser offers invitedUserId of invitedMspId, or of the inviter's
+// organization if invitedMspId is empty, a role on a vehicle. The inviter
+// must be an owner, and the invited user must not hold a role or a pending
+// invitation on the vehicle yet.
+func (c *VehicleContract) InviteUser(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	inviterUserId string,
+	invitedUserId string,
+	invitedMspId string,
+	role string,
+) (*Invitation, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	inviter, err := authorizeOwner(ctx, vehicle, inviterUserId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	if invitedUserId == "" {
+		return nil, fmt.Errorf("invitedUserId is required")
+	}
+	if invitedUserId == inviterUserId {
+		return nil, fmt.Errorf("user %s cannot invite themselves", inviterUserId)
+	}
+	if invitedMspId == "" {
+		invitedMspId = inviter.MSPID
+	}
+
+	existing, err := userRole(ctx, vehicle, invitedUserId)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("user %s already has a role on vehicle %s", invitedUserId, onChainId)
+	}
+
+	invitations, err := readInvitations(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		if invitation.Status == invitePending && invitation.InvitedUserID == invitedUserId {
+			return nil, fmt.Errorf("user %s already has a pending invitation to vehicle %s", invitedUserId, onChainId)
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		InviteID:      ctx.GetStub().GetTxID(),
+		OnChainID:     onChainId,
+		InviterUserID: inviterUserId,
+		InvitedUserID: invitedUserId,
+		InvitedMSPID:  invitedMspId,
+		Role:          role,
+		Status:        invitePending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := putInvitation(ctx, invitation); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation gives userId, who must be the invited user, the role
+// offered by a pending invitation
+func (c *VehicleContract) AcceptInvitation(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	inviteId string,
+	userId string,
+) (*RoleAssignment, error) {
+	invitation, err := answerInvitation(ctx, onChainId, inviteId, userId, inviteAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := &RoleAssignment{
+		OnChainID:  onChainId,
+		UserID:     invitation.InvitedUserID,
+		MSPID:      invitation.InvitedMSPID,
+		Role:       invitation.Role,
+		AssignedBy: invitation.InviterUserID,
+		AssignedAt: invitation.UpdatedAt,
+	}
+	if err := putRole(ctx, assignment); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// DeclineInvitation turns down a pending invitation made to userId
+func (c *VehicleContract) DeclineInvitation(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	inviteId string,
+	userId string,
+) (*Invitation, error) {
+	return answerInvitation(ctx, onChainId, inviteId, userId, inviteDeclined)
+}
+
+// CancelInvitation withdraws a pending invitation. userId must be an owner
+// of the vehicle.
+func (c *VehicleContract) CancelInvitation(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	inviteId string,
+	userId string,
+) (*Invitation, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := authorizeOwner(ctx, vehicle, userId); err != nil {
+		return nil, err
+	}
+
+	invitation, err := getPendingInvitation(ctx, onChainId, inviteId)
+	if err != nil {
+		return nil, err
+	}
+	if err := closeInvitation(ctx, invitation, inviteCancelled); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// GetInvitations returns the invitations made for a vehicle, including
+// answered ones
+func (c *VehicleContract) GetInvitations(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]*Invitation, error) {
+	if _, err := getVehicle(ctx, onChainId); err != nil {
+		return nil, err
+	}
+	return readInvitations(ctx, onChainId)
+}
+
+// AssignRole gives userId of userMspId a role on a vehicle without an
+// invitation, or changes the role they hold, as the backend's change-role
+// and assign-viewer do. userMspId defaults to the user's current
+// organization, or the owner's for a new assignment. ownerUserId must be an
+// owner of the vehicle.
+func (c *VehicleContract) AssignRole(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	ownerUserId string,
+	userId string,
+	userMspId string,
+	role string,
+) (*RoleAssignment, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := authorizeOwner(ctx, vehicle, ownerUserId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	if userId == "" {
+		return nil, fmt.Errorf("userId is required")
+	}
+	if userId == vehicle.OwnerUserID {
+		return nil, fmt.Errorf("user %s is the registered owner of vehicle %s; transfer the vehicle instead", userId, onChainId)
+	}
+
+	if userMspId == "" {
+		userMspId = owner.MSPID
+		existing, err := userRole(ctx, vehicle, userId)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			userMspId = existing.MSPID
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := &RoleAssignment{
+		OnChainID:  onChainId,
+		UserID:     userId,
+		MSPID:      userMspId,
+		Role:       role,
+		AssignedBy: ownerUserId,
+		AssignedAt: now,
+	}
+	if err := putRole(ctx, assignment); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// RevokeRole removes the role userId holds on a vehicle. ownerUserId must be
+// an owner of the vehicle.
+func (c *VehicleContract) RevokeRole(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	ownerUserId string,
+	userId string,
+) error {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return err
+	}
+	if _, err := authorizeOwner(ctx, vehicle, ownerUserId); err != nil {
+		return err
+	}
+	if userId == vehicle.OwnerUserID {
+		return fmt.Errorf("user %s is the registered owner of vehicle %s; transfer the vehicle instead", userId, onChainId)
+	}
+
+	existing, err := userRole(ctx, vehicle, userId)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("role of user %s on vehicle %s not found", userId, onChainId)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(roleObjectType, []string{onChainId, userId})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// GetVehicleRoles returns everyone with a role on a vehicle, the registered
+// owner first
+func (c *VehicleContract) GetVehicleRoles(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) ([]*RoleAssignment, error) {
+	vehicle, err := getVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	ownership, err := getOwnership(ctx, onChainId, vehicle.Ownership)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := ownerRole(vehicle)
+	owner.AssignedAt = ownership.From
+	roles := []*RoleAssignment{owner}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var assignment RoleAssignment
+		if err := json.Unmarshal(queryResponse.Value, &assignment); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &assignment)
+	}
+
+	return roles, nil
+}
+
+// validateRole checks that role is one of the backend's role codes
+func validateRole(role string) error {
+	switch role {
+	case roleOwner, roleDriver, roleViewer:
+		return nil
+	}
+	return fmt.Errorf("invalid role %q: must be %s, %s or %s", role, roleOwner, roleDriver, roleViewer)
+}
+
+// ownerRole is the assignment the registered owner holds implicitly
+func ownerRole(vehicle *Vehicle) *RoleAssignment {
+	return &RoleAssignment{
+		OnChainID: vehicle.OnChainID,
+		UserID:    vehicle.OwnerUserID,
+		MSPID:     vehicle.OwnerMSPID,
+		Role:      roleOwner,
+	}
+}
+
+// userRole returns the role userId holds on a vehicle, or nil if they hold
+// none
+func userRole(ctx contractapi.TransactionContextInterface, vehicle *Vehicle, userId string) (*RoleAssignment, error) {
+	if userId == vehicle.OwnerUserID {
+		return ownerRole(vehicle), nil
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(roleObjectType, []string{vehicle.OnChainID, userId})
+	if err != nil {
+		return nil, err
+	}
+
+	assignmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if assignmentJSON == nil {
+		return nil, nil
+	}
+
+	var assignment RoleAssignment
+	if err := json.Unmarshal(assignmentJSON, &assignment); err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// authorizeOwner checks that the client may act for userId and that userId
+// is an owner of the vehicle, and returns their assignment
+func authorizeOwner(ctx contractapi.TransactionContextInterface, vehicle *Vehicle, userId string) (*RoleAssignment, error) {
+	assignment, err := userRole(ctx, vehicle, userId)
+	if err != nil {
+		return nil, err
+	}
+	if assignment == nil || assignment.Role != roleOwner {
+		return nil, fmt.Errorf("user %s is not an owner of vehicle %s", userId, vehicle.OnChainID)
+	}
+	if err := authorizeUser(ctx, assignment.MSPID, userId); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+func putRole(ctx contractapi.TransactionContextInterface, assignment *RoleAssignment) error {
+	key, err := ctx.GetStub().CreateCompositeKey(roleObjectType, []string{assignment.OnChainID, assignment.UserID})
+	if err != nil {
+		return err
+	}
+
+	assignmentJSON, err := json.Marshal(assignment)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, assignmentJSON); err != nil {
+		return err
+	}
+	return inheritEndorsement(ctx, assignment.OnChainID, key)
+}
+
+// clearRoles removes every role assignment of a vehicle and cancels its
+// pending invitations
+func clearRoles(ctx contractapi.TransactionContextInterface, onChainId string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleObjectType, []string{onChainId})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+
+	invitations, err := readInvitations(ctx, onChainId)
+	if err != nil {
+		return err
+	}
+	for _, invitation := range invitations {
+		if invitation.Status != invitePending {
+			continue
+		}
+		if err := closeInvitation(ctx, invitation, inviteCancelled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answerInvitation records the invited user's answer to a pending
+// invitation
+func answerInvitation(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	inviteId string,
+	userId string,
+	status string,
+) (*Invitation, error) {
+	invitation, err := getPendingInvitation(ctx, onChainId, inviteId)
+	if err != nil {
+		return nil, err
+	}
+	if userId != invitation.InvitedUserID {
+		return nil, fmt.Errorf("invitation %s was not made to user %s", inviteId, userId)
+	}
+	if err := authorizeUser(ctx, invitation.InvitedMSPID, userId); err != nil {
+		return nil, err
+	}
+
+	if err := closeInvitation(ctx, invitation, status); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// closeInvitation moves a pending invitation to its final status
+func closeInvitation(ctx contractapi.TransactionContextInterface, invitation *Invitation, status string) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	invitation.Status = status
+	invitation.UpdatedAt = now
+	return putInvitation(ctx, invitation)
+}
+
+// getPendingInvitation returns an invitation, or an error if it does not
+// exist or has been answered
+func getPendingInvitation(ctx contractapi.TransactionContextInterface, onChainId string, inviteId string) (*Invitation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(inviteObjectType, []string{onChainId, inviteId})
+	if err != nil {
+		return nil, err
+	}
+
+	invitationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if invitationJSON == nil {
+		return nil, fmt.Errorf("invitation %s to vehicle %s not found", inviteId, onChainId)
+	}
+
+	var invitation Invitation
+	if err := json.Unmarshal(invitationJSON, &invitation); err != nil {
+		return nil, err
+	}
+	if invitation.Status != invitePending {
+		return nil, fmt.Errorf("invitation %s is already %s", inviteId, invitation.Status)
+	}
+	return &invitation, nil
+}
+
+// readInvitations returns every invitation made for a vehicle
+func readInvitations(ctx contractapi.TransactionContextInterface, onChainId string) ([]*Invitation, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(inviteObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var invitations []*Invitation
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var invitation Invitation
+		if err := json.Unmarshal(queryResponse.Value, &invitation); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &invitation)
+	}
+
+	return invitations, nil
+}
+
+func putInvitation(ctx contractapi.TransactionContextInterface, invitation *Invitation) error {
+	key, err := ctx.GetStub().CreateCompositeKey(inviteObjectType, []string{invitation.OnChainID, invitation.InviteID})
+	if err != nil {
+		return err
+	}
+
+	invitationJSON, err := json.Marshal(invitation)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, invitationJSON); err != nil {
+		return err
+	}
+	return inheritEndorsement(ctx, invitation.OnChainID, key)
+}
+
+// telemetryAccess checks the acting user's role before telemetry is read or
+// written: OWNER and DRIVER may submit a vehicle's telemetry, and a user may
+// read the readings taken while they held the vehicle. Everyone with a role
+// reads those of the current ownership period; owners of earlier periods
+// keep reading their own periods after a transfer, but nothing later. A role
+// only counts for clients of the organization it was given in, as the user
+// named in the transient map is only vouched for by that organization's
+// gateway. Calls acting for no user may submit telemetry for the vehicles of
+// the client's organization, such as readings forwarded from devices, but
+// read none. Telemetry of vehicles that are not registered, which only older
+// readings have, has no owner to decide who may see it and is only shown to
+// the admin organization.
+type telemetryAccess struct {
+	ctx        contractapi.TransactionContextInterface
+	userId     string
+	mspID      string
+	adminMSPID string
+	// cars caches the user's access per car
+	cars map[string]*carAccess
+}
+
+// carAccess is what the acting user may do with one car's telemetry
+type carAccess struct {
+	// role is the user's current role, "" if they hold none. Cars of the
+	// client's organization have organizationRole for calls acting for no
+	// user.
+	role string
+	// periods are the inclusive ranges of reading times, in Unix
+	// nanoseconds, the user may read, oldest first
+	periods []period
+}
+
+type period struct {
+	from int64
+	to   int64
+}
+
+const (
+	// organizationRole marks the client organization's own cars in
+	// telemetryAccess when it acts for no user
+	organizationRole = "ORGANIZATION"
+	// legacyRole marks cars without a vehicle asset in telemetryAccess for
+	// clients of the admin organization, and unregisteredRole for others
+	legacyRole       = "LEGACY"
+	unregisteredRole = "UNREGISTERED"
+)
+
+func (c *VehicleContract) newTelemetryAccess(ctx contractapi.TransactionContextInterface) (*telemetryAccess, error) {
+	userId, err := actingUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &telemetryAccess{
+		ctx:        ctx,
+		userId:     userId,
+		mspID:      mspID,
+		adminMSPID: c.AdminMSPID,
+		cars:       make(map[string]*carAccess),
+	}, nil
+}
+
+// authorizeTelemetry checks that the acting user may read, or with write
+// submit, a car's telemetry
+func (c *VehicleContract) authorizeTelemetry(ctx contractapi.TransactionContextInterface, carId string, write bool) error {
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return err
+	}
+	return access.check(carId, write)
+}
+
+// telemetryReader checks that the acting user may read some of a car's
+// telemetry and returns the access to filter the readings with
+func (c *VehicleContract) telemetryReader(ctx contractapi.TransactionContextInterface, carId string) (*telemetryAccess, error) {
+	access, err := c.newTelemetryAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := access.check(carId, false); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+func (a *telemetryAccess) check(carId string, write bool) error {
+	car, err := a.car(carId)
+	if err != nil {
+		return err
+	}
+	switch role := car.role; {
+	case role == legacyRole && !write:
+		return nil
+	case role == legacyRole || role == unregisteredRole:
+		return fmt.Errorf("vehicle %s is not registered; its telemetry is only shown to %s", carId, a.adminMSPID)
+	case a.userId == "" && !write:
+		return fmt.Errorf("no acting user; telemetry of vehicle %s is only shown to users with a role on it", carId)
+	case a.userId == "" && role != organizationRole:
+		return fmt.Errorf("client of %s cannot submit telemetry for vehicle %s", a.mspID, carId)
+	case a.userId == "":
+		return nil
+	case !write && len(car.periods) > 0:
+		return nil
+	case role == "":
+		return fmt.Errorf("user %s of %s has no role on vehicle %s", a.userId, a.mspID, carId)
+	case write && role == roleViewer:
+		return fmt.Errorf("user %s may only view vehicle %s", a.userId, carId)
+	}
+	return nil
+}
+
+// filter drops the records the acting user may not read
+func (a *telemetryAccess) filter(records []*VehicleTelemetry) ([]*VehicleTelemetry, error) {
+	var readable []*VehicleTelemetry
+	for _, record := range records {
+		ok, err := a.readable(record.CarId, record.InsertTime.UnixNano())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			readable = append(readable, record)
+		}
+	}
+	return readable, nil
+}
+
+// readable reports whether the acting user may read the car's reading taken
+// at nanos
+func (a *telemetryAccess) readable(carId string, nanos int64) (bool, error) {
+	car, err := a.car(carId)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range car.periods {
+		if nanos >= p.from && nanos <= p.to {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkReading checks that the acting user may read the car's reading taken
+// at nanos
+func (a *telemetryAccess) checkReading(carId string, nanos int64) error {
+	ok, err := a.readable(carId, nanos)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("user %s did not hold vehicle %s when the reading was taken", a.userId, carId)
+	}
+	return nil
+}
+
+// car returns the acting user's access to a car's telemetry
+func (a *telemetryAccess) car(carId string) (*carAccess, error) {
+	if car, ok := a.cars[carId]; ok {
+		return car, nil
+	}
+
+	vehicle, err := readVehicle(a.ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+	car := &carAccess{}
+	switch {
+	case vehicle == nil && a.adminMSPID != "" && a.mspID == a.adminMSPID:
+		car.role = legacyRole
+		car.periods = []period{{from: math.MinInt64, to: math.MaxInt64}}
+	case vehicle == nil:
+		car.role = unregisteredRole
+	case a.userId == "":
+		if vehicle.OwnerMSPID == a.mspID {
+			car.role = organizationRole
+		}
+	default:
+		assignment, err := userRole(a.ctx, vehicle, a.userId)
+		if err != nil {
+			return nil, err
+		}
+		// The same user ID in another organization is someone else
+		if assignment != nil && assignment.MSPID == a.mspID {
+			car.role = assignment.Role
+		}
+		if car.periods, err = a.heldPeriods(vehicle, car.role != ""); err != nil {
+			return nil, err
+		}
+	}
+	a.cars[carId] = car
+	return car, nil
+}
+
+// heldPeriods returns the ownership periods of a vehicle in which the acting
+// user held it: the current one if they have a role now, and those in which
+// they were the owner
+func (a *telemetryAccess) heldPeriods(vehicle *Vehicle, current bool) ([]period, error) {
+	chain, err := readOwnerships(a.ctx, vehicle.OnChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []period
+	for _, ownership := range chain {
+		held := ownership.OwnerUserID == a.userId && ownership.OwnerMSPID == a.mspID
+		if !held && !(current && ownership.Sequence == vehicle.Ownership) {
+			continue
+		}
+		from, to, err := ownershipSpan(ownership)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, period{from: from, to: to})
+	}
+	return periods, nil
+}
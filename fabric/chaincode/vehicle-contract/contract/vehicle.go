@@ -0,0 +1,138 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// vehicleObjectType is the object type of vehicle~onChainId. onChainId is
+// the backend's car ID, the same ID telemetry is submitted under.
+const vehicleObjectType = "vehicle"
+
+// RegisterVehicle creates a REGISTERED vehicle owned by ownerUserId of the
+// client's organization and opens its first ownership period. From then on
+// writes to the vehicle need that organization's endorsement.
+func (c *VehicleContract) RegisterVehicle(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+	vin string,
+	ownerUserId string,
+) (*Vehicle, error) {
+	if onChainId == "" || vin == "" || ownerUserId == "" {
+		return nil, fmt.Errorf("onChainId, vin and ownerUserId are required")
+	}
+
+	existing, err := readVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("vehicle %s already exists", onChainId)
+	}
+
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUser(ctx, mspID, ownerUserId); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle := &Vehicle{
+		OnChainID:       onChainId,
+		VIN:             vin,
+		OwnerUserID:     ownerUserId,
+		OwnerMSPID:      mspID,
+		Ownership:       1,
+		RegisteredAt:    now,
+		Status:          statusRegistered,
+		StatusChangedAt: now,
+		StatusChangedBy: mspID,
+	}
+	ownership := &Ownership{
+		OnChainID:   onChainId,
+		Sequence:    1,
+		OwnerUserID: ownerUserId,
+		OwnerMSPID:  mspID,
+		From:        now,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	if err := putOwnership(ctx, ownership); err != nil {
+		return nil, err
+	}
+	if err := putVehicle(ctx, vehicle); err != nil {
+		return nil, err
+	}
+
+	ownershipKey, err := ctx.GetStub().CreateCompositeKey(ownershipObjectType, []string{onChainId, sequenceKey(1)})
+	if err != nil {
+		return nil, err
+	}
+	if err := endorseVehicle(ctx, onChainId, []string{mspID}, endorsedObjectTypes, ownershipKey); err != nil {
+		return nil, err
+	}
+	return vehicle, nil
+}
+
+// ReadVehicle returns a vehicle
+func (c *VehicleContract) ReadVehicle(
+	ctx contractapi.TransactionContextInterface,
+	onChainId string,
+) (*Vehicle, error) {
+	return getVehicle(ctx, onChainId)
+}
+
+// getVehicle returns a vehicle, or an error if it is not registered
+func getVehicle(ctx contractapi.TransactionContextInterface, onChainId string) (*Vehicle, error) {
+	vehicle, err := readVehicle(ctx, onChainId)
+	if err != nil {
+		return nil, err
+	}
+	if vehicle == nil {
+		return nil, fmt.Errorf("vehicle %s not found", onChainId)
+	}
+	return vehicle, nil
+}
+
+// readVehicle returns the vehicle~onChainId asset, or nil if the vehicle is
+// not registered
+func readVehicle(ctx contractapi.TransactionContextInterface, onChainId string) (*Vehicle, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(vehicleObjectType, []string{onChainId})
+	if err != nil {
+		return nil, err
+	}
+
+	vehicleJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if vehicleJSON == nil {
+		return nil, nil
+	}
+
+	var vehicle Vehicle
+	if err := json.Unmarshal(vehicleJSON, &vehicle); err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+func putVehicle(ctx contractapi.TransactionContextInterface, vehicle *Vehicle) error {
+	key, err := ctx.GetStub().CreateCompositeKey(vehicleObjectType, []string{vehicle.OnChainID})
+	if err != nil {
+		return err
+	}
+
+	vehicleJSON, err := json.Marshal(vehicle)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, vehicleJSON)
+}
@@ -0,0 +1,129 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type VehicleContract struct {
+	contractapi.Contract
+
+	// AdminMSPID is the organization that maintains the data of every
+	// vehicle, such as migrating the telemetry of vehicles it does not own.
+	// Every endorsing peer must run the chaincode with the same value.
+	AdminMSPID string
+	// PoliceMSPID is the organization that reports vehicles stolen and
+	// recovered. While it is empty no vehicle can be reported stolen.
+	PoliceMSPID string
+}
+
+// SubmitTelemetry stores telemetry data for a registered vehicle that is not scrapped
+// Each submission creates a new record with composite key: telemetry~carId~yyyymmdd~timestamp
+// and moves latest~carId to it
+func (c *VehicleContract) SubmitTelemetry(
+	ctx contractapi.TransactionContextInterface,
+	carId string,
+	carData string,
+) error {
+	if err := acceptsTelemetry(ctx, carId); err != nil {
+		return err
+	}
+	if err := c.authorizeTelemetry(ctx, carId, true); err != nil {
+		return err
+	}
+
+	// Every endorser must compute the same key and value, so the reading is
+	// stamped with the transaction time rather than the local clock
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	record := VehicleTelemetry{
+		CarId:      carId,
+		CarData:    carData,
+		InsertTime: now,
+	}
+
+	recordJSON, err := marshalTelemetry(&record)
+	if err != nil {
+		return err
+	}
+
+	key, err := telemetryKey(ctx, carId, record.InsertTime)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, recordJSON); err != nil {
+		return err
+	}
+
+	return updateLatest(ctx, key, &record)
+}
+
+// ReadTelemetry retrieves a specific telemetry record by composite key
+func (c *VehicleContract) ReadTelemetry(
+	ctx contractapi.TransactionContextInterface,
+	key string,
+) (*VehicleTelemetry, error) {
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("telemetry record not found")
+	}
+
+	var record VehicleTelemetry
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return nil, err
+	}
+	access, err := c.telemetryReader(ctx, record.CarId)
+	if err != nil {
+		return nil, err
+	}
+	if err := access.checkReading(record.CarId, record.InsertTime.UnixNano()); err != nil {
+		return nil, err
+	}
+	record.Key = key
+	return &record, nil
+}
+
+// GetTelemetryByVehicle retrieves the telemetry records of a specific vehicle
+// taken while the acting user held it
+func (c *VehicleContract) GetTelemetryByVehicle(
+	ctx contractapi.TransactionContextInterface,
+	carId string,
+) ([]*VehicleTelemetry, error) {
+	access, err := c.telemetryReader(ctx, carId)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(telemetryObjectType, []string{carId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []*VehicleTelemetry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record VehicleTelemetry
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		record.Key = queryResponse.Key
+		records = append(records, &record)
+	}
+
+	return access.filter(records)
+}
@@ -2,17 +2,51 @@ package main
 
 import (
 	"log"
+	"os"
+
+	"vehicle-contract/contract"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-contract-api-go/metadata"
 )
 
+// contractVersion is reported through the contract metadata so clients can
+// tell which build of the chaincode is deployed
+const contractVersion = "1.1.0"
+
+// defaultAdminMSPID is the organization that maintains every vehicle's data
+// unless ADMIN_MSP_ID names another
+const defaultAdminMSPID = "Org1MSP"
+
 func main() {
-	chaincode, err := contractapi.NewChaincode(&VehicleContract{})
+	vehicleContract := &contract.VehicleContract{
+		AdminMSPID:  envOr("ADMIN_MSP_ID", defaultAdminMSPID),
+		PoliceMSPID: os.Getenv("POLICE_MSP_ID"),
+	}
+	vehicleContract.BeforeTransaction = logTransaction
+	if vehicleContract.PoliceMSPID == "" {
+		log.Printf("WARNING: POLICE_MSP_ID is not set, so no vehicle can be reported stolen or recovered")
+	}
+
+	chaincode, err := contractapi.NewChaincode(vehicleContract)
 	if err != nil {
 		log.Panicf("Error creating chaincode: %v", err)
 	}
 
+	chaincode.Info = metadata.InfoMetadata{
+		Title:   "vehicle-contract",
+		Version: contractVersion,
+	}
+
 	if err := chaincode.Start(); err != nil {
 		log.Panicf("Error starting chaincode: %v", err)
 	}
 }
+
+// envOr returns the environment variable name, or fallback if it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
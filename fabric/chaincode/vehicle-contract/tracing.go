@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// logTransaction runs before every transaction. The gateway passes the W3C
+// trace context in the transient map, so logging it next to the transaction
+// ID lets chaincode logs be joined with the gateway's traces.
+func logTransaction(ctx contractapi.TransactionContextInterface) error {
+	stub := ctx.GetStub()
+	function, _ := stub.GetFunctionAndParameters()
+
+	traceID := ""
+	if transient, err := stub.GetTransient(); err == nil {
+		traceID = traceIDFromTraceparent(string(transient["traceparent"]))
+	}
+
+	log.Printf("txId=%s function=%s traceId=%s", stub.GetTxID(), function, traceID)
+	return nil
+}
+
+// traceIDFromTraceparent extracts the trace ID from a header of the form
+// version-traceid-spanid-flags
+func traceIDFromTraceparent(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[1]
+}
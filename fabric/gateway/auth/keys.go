@@ -0,0 +1,414 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// keyPrefix marks gateway API keys so they are easy to spot in logs and
+// secret scanners. Keys have the form fgw_<id>_<secret>.
+const keyPrefix = "fgw_"
+
+var (
+	keysBucket  = []byte("apikeys")
+	usageBucket = []byte("usage")
+)
+
+var (
+	// ErrInvalidKey is returned for malformed, unknown or mismatched keys
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrRevokedKey is returned for keys that were revoked
+	ErrRevokedKey = errors.New("API key has been revoked")
+	// ErrKeyNotFound is returned by admin operations on unknown key IDs
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// Scope limits what a key may call. Routes are gin route patterns, optionally
+// prefixed with a method ("GET /api/telemetry/vehicle/:carId"); a trailing *
+// matches any route with that prefix. Vehicles lists the car IDs the key may
+// name in a request, with "*" allowing any vehicle. Users lists the backend
+// users the key may act for; "*" lets a backend that signs in its own users
+// name any of them in X-User-Id, and a key bound to a single user acts for it
+// without the header.
+type Scope struct {
+	Routes   []string `json:"routes"`
+	Vehicles []string `json:"vehicles"`
+	Users    []string `json:"users,omitempty"`
+}
+
+// Limits configures a key's token bucket and daily quota. A zero rate or
+// quota means unlimited.
+type Limits struct {
+	RatePerSecond float64 `json:"ratePerSecond"`
+	Burst         int     `json:"burst"`
+	DailyQuota    int64   `json:"dailyQuota"`
+}
+
+// APIKey is the stored record of a client key. Only a SHA-256 hash of the
+// key is kept; the plaintext is shown once when the key is created or
+// rotated.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     Scope      `json:"scope"`
+	Limits    Limits     `json:"limits"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+
+	Hash string `json:"-"`
+	// PreviousHash keeps the key replaced by the last rotation valid until
+	// PreviousExpiresAt so clients can switch over
+	PreviousHash      string     `json:"-"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+}
+
+// storedKey adds the hashes back for persistence, since APIKey hides them
+// from API responses
+type storedKey struct {
+	APIKey
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previousHash,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// AllowsRoute reports whether the key may call the gin route path with method
+func (k *APIKey) AllowsRoute(method, path string) bool {
+	for _, pattern := range k.Scope.Routes {
+		patternMethod, patternPath, found := strings.Cut(pattern, " ")
+		if !found {
+			patternMethod, patternPath = "", pattern
+		}
+		if patternMethod != "" && !strings.EqualFold(patternMethod, method) {
+			continue
+		}
+		if patternPath == "*" || patternPath == path {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(patternPath, "*"); ok && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsVehicle reports whether the key may access data for carID
+func (k *APIKey) AllowsVehicle(carID string) bool {
+	for _, vehicle := range k.Scope.Vehicles {
+		if vehicle == "*" || vehicle == carID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAllVehicles reports whether the key's vehicle scope is "*"
+func (k *APIKey) AllowsAllVehicles() bool {
+	for _, vehicle := range k.Scope.Vehicles {
+		if vehicle == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ActingUser returns the user a request made with the key acts for, given
+// the user it names, and false if the key may not act for that user. A key
+// bound to a single user acts for it when none is named; otherwise the
+// request acts for no user.
+func (k *APIKey) ActingUser(named string) (string, bool) {
+	if named == "" {
+		if len(k.Scope.Users) == 1 && k.Scope.Users[0] != "*" {
+			return k.Scope.Users[0], true
+		}
+		return "", true
+	}
+	for _, user := range k.Scope.Users {
+		if user == "*" || user == named {
+			return named, true
+		}
+	}
+	return "", false
+}
+
+// KeyStore persists API keys and their daily usage in a local bbolt file
+type KeyStore struct {
+	db *bolt.DB
+}
+
+func OpenKeyStore(path string) (*KeyStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open API key store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(keysBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(usageBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise API key store: %w", err)
+	}
+
+	return &KeyStore{db: db}, nil
+}
+
+// Create stores a new key and returns it with its plaintext value
+func (s *KeyStore) Create(name string, scope Scope, limits Limits) (*APIKey, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, plaintext, err := newSecret(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:        id,
+		Name:      name,
+		Scope:     scope,
+		Limits:    limits,
+		CreatedAt: time.Now().UTC(),
+		Hash:      secret,
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return putKey(tx, key)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, plaintext, nil
+}
+
+// Get returns the key with the given ID, or nil if it does not exist
+func (s *KeyStore) Get(id string) (*APIKey, error) {
+	var key *APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		key, err = getKey(tx, id)
+		return err
+	})
+	return key, err
+}
+
+// List returns every key, including revoked ones
+func (s *KeyStore) List() ([]*APIKey, error) {
+	var keys []*APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).ForEach(func(_, data []byte) error {
+			key, err := decodeKey(data)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Rotate replaces the key's secret. The old secret keeps working for grace.
+func (s *KeyStore) Rotate(id string, grace time.Duration) (*APIKey, string, error) {
+	secret, plaintext, err := newSecret(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var key *APIKey
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		key, err = getKey(tx, id)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return ErrKeyNotFound
+		}
+		if key.Revoked() {
+			return ErrRevokedKey
+		}
+
+		now := time.Now().UTC()
+		key.PreviousHash, key.PreviousExpiresAt = "", nil
+		if grace > 0 {
+			expires := now.Add(grace)
+			key.PreviousHash, key.PreviousExpiresAt = key.Hash, &expires
+		}
+		key.Hash = secret
+		key.RotatedAt = &now
+		return putKey(tx, key)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, plaintext, nil
+}
+
+// Revoke disables the key permanently. The record is kept for auditing.
+func (s *KeyStore) Revoke(id string) (*APIKey, error) {
+	var key *APIKey
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		key, err = getKey(tx, id)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return ErrKeyNotFound
+		}
+		if key.Revoked() {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		key.PreviousHash, key.PreviousExpiresAt = "", nil
+		return putKey(tx, key)
+	})
+	return key, err
+}
+
+// Authenticate returns the key matching the plaintext value
+func (s *KeyStore) Authenticate(plaintext string) (*APIKey, error) {
+	id, ok := parseKeyID(plaintext)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidKey
+	}
+
+	hash := hashKey(plaintext)
+	matches := constantTimeEqual(hash, key.Hash)
+	if !matches && key.PreviousHash != "" && time.Now().Before(*key.PreviousExpiresAt) {
+		matches = constantTimeEqual(hash, key.PreviousHash)
+	}
+	if !matches {
+		return nil, ErrInvalidKey
+	}
+	if key.Revoked() {
+		return nil, ErrRevokedKey
+	}
+	return key, nil
+}
+
+// ConsumeQuota counts one request against the key's quota for day
+// (YYYY-MM-DD). It returns the number of requests used, and false without
+// counting when the quota is already spent.
+func (s *KeyStore) ConsumeQuota(id, day string, quota int64) (int64, bool, error) {
+	var used int64
+	var allowed bool
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usageBucket)
+		usageKey := []byte(id + "/" + day)
+
+		used, allowed = 0, false
+		if data := bucket.Get(usageKey); len(data) == 8 {
+			used = int64(binary.BigEndian.Uint64(data))
+		}
+		if used >= quota {
+			return nil
+		}
+
+		used++
+		allowed = true
+		return bucket.Put(usageKey, binary.BigEndian.AppendUint64(nil, uint64(used)))
+	})
+	return used, allowed, err
+}
+
+func (s *KeyStore) Close() error {
+	return s.db.Close()
+}
+
+func getKey(tx *bolt.Tx, id string) (*APIKey, error) {
+	data := tx.Bucket(keysBucket).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	return decodeKey(data)
+}
+
+func decodeKey(data []byte) (*APIKey, error) {
+	var stored storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	key := stored.APIKey
+	key.Hash, key.PreviousHash = stored.Hash, stored.PreviousHash
+	return &key, nil
+}
+
+func putKey(tx *bolt.Tx, key *APIKey) error {
+	data, err := json.Marshal(storedKey{APIKey: *key, Hash: key.Hash, PreviousHash: key.PreviousHash})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(keysBucket).Put([]byte(key.ID), data)
+}
+
+// newSecret generates a plaintext key for id and returns its hash
+func newSecret(id string) (hash, plaintext string, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext = keyPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return hashKey(plaintext), plaintext, nil
+}
+
+func parseKeyID(plaintext string) (string, bool) {
+	rest, ok := strings.CutPrefix(plaintext, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	return id, ok && id != "" && secret != ""
+}
+
+func hashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
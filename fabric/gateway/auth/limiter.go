@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled continuously at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps one token bucket per API key in memory. Buckets start
+// full, so a restart briefly allows a burst.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// RateStatus is the state of a key's bucket after a request
+type RateStatus struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again, or when the request
+	// was rejected, until the next token is available
+	Reset time.Duration
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (l *RateLimiter) Allow(key *APIKey) RateStatus {
+	rate := key.Limits.RatePerSecond
+	capacity := float64(key.Limits.Burst)
+	if capacity < 1 {
+		capacity = math.Max(1, math.Ceil(rate))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key.ID]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key.ID] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	status := RateStatus{Limit: int(capacity)}
+	if b.tokens < 1 {
+		status.Reset = secondsToDuration((1 - b.tokens) / rate)
+		return status
+	}
+
+	b.tokens--
+	status.Allowed = true
+	status.Remaining = int(b.tokens)
+	status.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return status
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fabric-gateway/fabric"
+	"fabric-gateway/logging"
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the client key; "Authorization: Bearer <key>" is
+// accepted as well
+const APIKeyHeader = "X-API-Key"
+
+// Error codes returned when a request is rejected before reaching Fabric
+const (
+	ErrCodeUnauthorized  = "UNAUTHORIZED"
+	ErrCodeForbidden     = "FORBIDDEN"
+	ErrCodeRateLimited   = "RATE_LIMITED"
+	ErrCodeQuotaExceeded = "QUOTA_EXCEEDED"
+	ErrCodeKeyRevoked    = "KEY_REVOKED"
+)
+
+// contextKey is the gin context key holding the authenticated *APIKey
+const contextKey = "apiKey"
+
+// Authenticator checks API keys, their scopes, rate limits and quotas
+type Authenticator struct {
+	store   *KeyStore
+	limiter *RateLimiter
+}
+
+func NewAuthenticator(store *KeyStore) *Authenticator {
+	return &Authenticator{store: store, limiter: NewRateLimiter()}
+}
+
+// KeyFromContext returns the key that authenticated the request, if any
+func KeyFromContext(c *gin.Context) *APIKey {
+	key, _ := c.Value(contextKey).(*APIKey)
+	return key
+}
+
+// AuthorizeVehicle applies the vehicle scope of the request's key to a
+// vehicle the middleware cannot see, e.g. one encoded in a record key. It
+// rejects the request with 403 and returns false if the key does not allow
+// the vehicle. Requests without a key (API_AUTH=disabled) are allowed.
+func AuthorizeVehicle(c *gin.Context, carID string) bool {
+	if key := KeyFromContext(c); key != nil && !key.AllowsVehicle(carID) {
+		reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is not allowed to access vehicle "+carID)
+		return false
+	}
+	return true
+}
+
+// AuthorizeVehicles is AuthorizeVehicle for requests that can name several
+// vehicles. A key limited to some vehicles must name at least one, since
+// naming none would reach every vehicle.
+func AuthorizeVehicles(c *gin.Context, carIDs []string) bool {
+	key := KeyFromContext(c)
+	if key == nil || key.AllowsAllVehicles() {
+		return true
+	}
+	if len(carIDs) == 0 {
+		reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is limited to specific vehicles; the request must name them")
+		return false
+	}
+	for _, carID := range carIDs {
+		if !AuthorizeVehicle(c, carID) {
+			return false
+		}
+	}
+	return true
+}
+
+// VisibleVehicle reports whether the request's key allows a vehicle, for
+// routes that return several vehicles and leave out those it does not.
+// Requests without a key see every vehicle.
+func VisibleVehicle(c *gin.Context, carID string) bool {
+	key := KeyFromContext(c)
+	return key == nil || key.AllowsVehicle(carID)
+}
+
+// AuthorizeAllVehicles is for routes whose results cannot be told apart by
+// vehicle. It rejects the request with 403 and returns false if the key is
+// limited to some vehicles.
+func AuthorizeAllVehicles(c *gin.Context) bool {
+	if key := KeyFromContext(c); key != nil && !key.AllowsAllVehicles() {
+		reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is limited to specific vehicles and cannot call "+c.Request.Method+" "+c.FullPath())
+		return false
+	}
+	return true
+}
+
+// AuthorizeUser applies the user scope of the request's key to the user
+// named by the request, and returns the user the request acts for. It
+// rejects the request with 403 and returns false if the key may not act for
+// that user. Requests without a key (API_AUTH=disabled) act for the named
+// user.
+func AuthorizeUser(c *gin.Context, named string) (string, bool) {
+	key := KeyFromContext(c)
+	if key == nil {
+		return named, true
+	}
+	userID, ok := key.ActingUser(named)
+	if !ok {
+		reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is not allowed to act for user "+named)
+		return "", false
+	}
+	return userID, true
+}
+
+// Middleware rejects requests without a valid key (401), outside the key's
+// route or vehicle scope (403), or over its rate limit or daily quota (429).
+// Handlers of routes that do not name a single vehicle apply the vehicle
+// scope themselves, with AuthorizeVehicles, VisibleVehicle or
+// AuthorizeAllVehicles.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plaintext := requestKey(c)
+		if plaintext == "" {
+			reject(c, http.StatusUnauthorized, ErrCodeUnauthorized, "API key required")
+			return
+		}
+
+		key, err := a.store.Authenticate(plaintext)
+		switch {
+		case errors.Is(err, ErrInvalidKey), errors.Is(err, ErrRevokedKey):
+			reject(c, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(c.Request.Context(), "failed to look up API key", "error", err)
+			reject(c, http.StatusInternalServerError, fabric.ErrCodeInternal, "Failed to authenticate request")
+			return
+		}
+		logging.Annotate(c.Request.Context(), "apiKeyId", key.ID)
+
+		if !key.AllowsRoute(c.Request.Method, c.FullPath()) {
+			reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is not allowed to call "+c.Request.Method+" "+c.FullPath())
+			return
+		}
+		if carID := requestVehicle(c); carID != "" && !key.AllowsVehicle(carID) {
+			reject(c, http.StatusForbidden, ErrCodeForbidden, "API key is not allowed to access vehicle "+carID)
+			return
+		}
+
+		if key.Limits.RatePerSecond > 0 {
+			status := a.limiter.Allow(key)
+			c.Header("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+			c.Header("X-RateLimit-Reset", ceilSeconds(status.Reset))
+			if !status.Allowed {
+				c.Header("Retry-After", ceilSeconds(status.Reset))
+				reject(c, http.StatusTooManyRequests, ErrCodeRateLimited, "Rate limit exceeded")
+				return
+			}
+		}
+
+		if quota := key.Limits.DailyQuota; quota > 0 {
+			now := time.Now().UTC()
+			resetIn := now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+
+			used, allowed, err := a.store.ConsumeQuota(key.ID, now.Format(time.DateOnly), quota)
+			if err != nil {
+				slog.ErrorContext(c.Request.Context(), "failed to record API key usage", "error", err)
+				reject(c, http.StatusInternalServerError, fabric.ErrCodeInternal, "Failed to authenticate request")
+				return
+			}
+			c.Header("X-RateLimit-Quota-Limit", strconv.FormatInt(quota, 10))
+			c.Header("X-RateLimit-Quota-Remaining", strconv.FormatInt(quota-used, 10))
+			c.Header("X-RateLimit-Quota-Reset", ceilSeconds(resetIn))
+			if !allowed {
+				c.Header("Retry-After", ceilSeconds(resetIn))
+				reject(c, http.StatusTooManyRequests, ErrCodeQuotaExceeded, "Daily quota exceeded")
+				return
+			}
+		}
+
+		c.Set(contextKey, key)
+		c.Next()
+	}
+}
+
+// AdminMiddleware guards the key management endpoints with the admin key.
+// With no admin key configured the endpoints are disabled.
+func AdminMiddleware(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			reject(c, http.StatusForbidden, ErrCodeForbidden, "Admin API is disabled")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(requestKey(c)), []byte(adminKey)) != 1 {
+			reject(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Admin key required")
+			return
+		}
+		c.Next()
+	}
+}
+
+func requestKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// requestVehicle finds the vehicle a request refers to in the path, query
+// string or JSON body
+func requestVehicle(c *gin.Context) string {
+	for _, name := range []string{"carId", "onChainId"} {
+		if value := c.Param(name); value != "" {
+			return value
+		}
+		if value := c.Query(name); value != "" {
+			return value
+		}
+	}
+
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return ""
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+
+	var body struct {
+		CarID     string `json:"carId"`
+		OnChainID string `json:"onChainId"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return ""
+	}
+	if body.CarID != "" {
+		return body.CarID
+	}
+	return body.OnChainID
+}
+
+func reject(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    code,
+	})
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,222 @@
+package fabric
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig sizes the evaluate cache. A zero Size disables caching.
+type CacheConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Size: 1000,
+		TTL:  30 * time.Second,
+	}
+}
+
+// carScopedFunctions read only the state of the car named by their first
+// argument. Their results are invalidated by writes to that car; results of
+// every other function are invalidated by any write.
+var carScopedFunctions = map[string]bool{
+	"GetTelemetryByVehicle":     true,
+	"GetTelemetryByRange":       true,
+	"GetLatestTelemetry":        true,
+	"ReadVehicle":               true,
+	"GetOwnershipHistory":       true,
+	"GetTelemetryForOwnership":  true,
+	"GetPendingTransfer":        true,
+	"ReadAccess":                true,
+	"GetAccessGrantsByVehicle":  true,
+	"GetVehicleRoles":           true,
+	"GetInvitations":            true,
+	"GetEndorsingOrganizations": true,
+	"GetStolenVehicleLocation":  true,
+}
+
+// keyScopedFunctions read the world state key given as their first argument,
+// which belongs to the car named by its first attribute
+var keyScopedFunctions = map[string]bool{
+	"ReadTelemetry":       true,
+	"GetTelemetryHistory": true,
+}
+
+// globalTag marks cache entries that depend on the state of every car
+const globalTag = ""
+
+// CacheMode is how an evaluation may use the cache
+type CacheMode int
+
+const (
+	// CacheDefault serves cached results and stores fresh ones
+	CacheDefault CacheMode = iota
+	// CacheRefresh skips cached results but stores the fresh one
+	// (Cache-Control: no-cache)
+	CacheRefresh
+	// CacheBypass neither reads nor stores (Cache-Control: no-store)
+	CacheBypass
+)
+
+type cacheModeKey struct{}
+
+// WithCacheMode returns a context whose evaluations use the cache as mode
+func WithCacheMode(ctx context.Context, mode CacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+func cacheModeFrom(ctx context.Context) CacheMode {
+	mode, _ := ctx.Value(cacheModeKey{}).(CacheMode)
+	return mode
+}
+
+type cacheEntry struct {
+	key     string
+	tag     string
+	result  string
+	expires time.Time
+}
+
+// evaluateCache is an LRU cache of evaluation results with a TTL. Entries
+// are tagged with the car they depend on so block events can drop them.
+type evaluateCache struct {
+	mu      sync.Mutex
+	config  CacheConfig
+	entries map[string]*list.Element
+	lru     *list.List
+	// epoch advances on every invalidation. A result is only stored if no
+	// invalidation happened while it was being evaluated, otherwise a read
+	// racing a commit could cache the state from before the commit.
+	epoch uint64
+}
+
+func newEvaluateCache(config CacheConfig) *evaluateCache {
+	return &evaluateCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// cacheKey identifies an evaluation. Results depend on the acting user's
+// roles, so each user has their own entries.
+func cacheKey(userID, funcName string, args []string) string {
+	return userID + "\x00" + funcName + "\x00" + strings.Join(args, "\x00")
+}
+
+func cacheTag(funcName string, args []string) string {
+	if len(args) == 0 {
+		return globalTag
+	}
+	switch {
+	case carScopedFunctions[funcName]:
+		return args[0]
+	case keyScopedFunctions[funcName]:
+		if car := carFromKey(args[0]); car != "" {
+			return car
+		}
+	}
+	return globalTag
+}
+
+func (c *evaluateCache) configure(config CacheConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.config = config
+	c.epoch++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *evaluateCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config.Size > 0
+}
+
+// get returns a live cached result and the epoch to pass to put on a miss
+func (c *evaluateCache) get(key string) (string, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false, c.epoch
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return "", false, c.epoch
+	}
+	c.lru.MoveToFront(element)
+	return entry.result, true, c.epoch
+}
+
+// put stores a result evaluated since epoch, evicting the least recently
+// used entry when full
+func (c *evaluateCache) put(key, tag, result string, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if epoch != c.epoch {
+		return
+	}
+
+	entry := &cacheEntry{key: key, tag: tag, result: result, expires: time.Now().Add(c.config.TTL)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.config.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate drops the entries for the given cars and every entry that
+// depends on all cars. It returns the number of entries removed.
+func (c *evaluateCache) invalidate(cars map[string]bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	removed := 0
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if tag := element.Value.(*cacheEntry).tag; tag == globalTag || cars[tag] {
+			c.remove(element)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// purge drops every entry, e.g. when block events may have been missed
+func (c *evaluateCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *evaluateCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *evaluateCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,140 @@
+package fabric
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCacheTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		funcName string
+		args     []string
+		want     string
+	}{
+		{"car-scoped function", "GetTelemetryByVehicle", []string{"7"}, "7"},
+		{"car-scoped function with more arguments", "GetTelemetryByRange", []string{"7", "", ""}, "7"},
+		{"key-scoped function", "ReadTelemetry", []string{"\x00telemetry\x007\x0020250311\x001\x00"}, "7"},
+		{"key-scoped function with a legacy key", "GetTelemetryHistory", []string{"\x00telemetry\x007\x001\x00"}, "7"},
+		{"key-scoped function with a bad key", "ReadTelemetry", []string{"\x00telemetry"}, globalTag},
+		{"function reading every car", "GetAllTelemetry", nil, globalTag},
+		{"unlisted function with arguments", "QueryTelemetry", []string{`{"conditions":[]}`}, globalTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheTag(tt.funcName, tt.args); got != tt.want {
+				t.Errorf("got tag %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCacheInvalidate(t *testing.T) {
+	// entries maps cache keys to their tags
+	entries := map[string]string{
+		"car1": "1",
+		"car2": "2",
+		"car3": "3",
+		"all":  globalTag,
+	}
+
+	tests := []struct {
+		name        string
+		cars        map[string]bool
+		wantRemoved int
+		wantKept    []string
+	}{
+		{"one car", map[string]bool{"1": true}, 2, []string{"car2", "car3"}},
+		{"several cars", map[string]bool{"1": true, "3": true}, 3, []string{"car2"}},
+		{"unknown car", map[string]bool{"9": true}, 1, []string{"car1", "car2", "car3"}},
+		{"no cars", nil, 1, []string{"car1", "car2", "car3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newEvaluateCache(CacheConfig{Size: 10, TTL: time.Minute})
+			for key, tag := range entries {
+				_, _, epoch := c.get(key)
+				c.put(key, tag, "result", epoch)
+			}
+
+			if removed := c.invalidate(tt.cars); removed != tt.wantRemoved {
+				t.Errorf("removed %d entries, want %d", removed, tt.wantRemoved)
+			}
+			var kept []string
+			for key := range entries {
+				if _, ok, _ := c.get(key); ok {
+					kept = append(kept, key)
+				}
+			}
+			slices.Sort(kept)
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestEvaluateCachePut(t *testing.T) {
+	tests := []struct {
+		name string
+		// between runs after the miss and before the result is stored
+		between func(c *evaluateCache)
+		want    bool
+	}{
+		{"stored", func(*evaluateCache) {}, true},
+		{"invalidated for another car meanwhile", func(c *evaluateCache) { c.invalidate(map[string]bool{"2": true}) }, false},
+		{"purged meanwhile", func(c *evaluateCache) { c.purge() }, false},
+		{"resized meanwhile", func(c *evaluateCache) { c.configure(CacheConfig{Size: 10, TTL: time.Minute}) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newEvaluateCache(CacheConfig{Size: 10, TTL: time.Minute})
+
+			_, ok, epoch := c.get("key")
+			if ok {
+				t.Fatal("empty cache had an entry")
+			}
+			tt.between(c)
+			c.put("key", "1", "result", epoch)
+
+			if _, ok, _ := c.get("key"); ok != tt.want {
+				t.Errorf("got cached %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCacheExpiryAndEviction(t *testing.T) {
+	c := newEvaluateCache(CacheConfig{Size: 2, TTL: time.Minute})
+	for _, key := range []string{"a", "b"} {
+		_, _, epoch := c.get(key)
+		c.put(key, globalTag, key, epoch)
+	}
+	// Reading a makes b the least recently used
+	if result, ok, _ := c.get("a"); !ok || result != "a" {
+		t.Fatalf("got %q, %v for a", result, ok)
+	}
+	_, _, epoch := c.get("c")
+	c.put("c", globalTag, "c", epoch)
+	if _, ok, _ := c.get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	if c.len() != 2 {
+		t.Errorf("got %d entries, want 2", c.len())
+	}
+
+	expiring := newEvaluateCache(CacheConfig{Size: 2, TTL: time.Millisecond})
+	_, _, epoch = expiring.get("a")
+	expiring.put("a", globalTag, "a", epoch)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := expiring.get("a"); ok {
+		t.Error("expired entry was served")
+	}
+	if expiring.len() != 0 {
+		t.Errorf("expired entry was kept")
+	}
+}
@@ -1,34 +1,89 @@
 package fabric
 
 import (
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"fabric-gateway/logging"
+	"fabric-gateway/metrics"
+
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// commitRetryInterval is how long to wait before asking the peer again for
+// the commit status of an asynchronously submitted transaction
+const commitRetryInterval = 5 * time.Second
+
+// organizationsPath is where the crypto material is mounted in the container
+const organizationsPath = "/app/organizations"
+
 type Client struct {
-	grpcConn *grpc.ClientConn
-	gateway  *client.Gateway
-	contract *client.Contract
+	channelName   string
+	chaincodeName string
+	id            *identity.X509Identity
+	sign          identity.Sign
+	peers         []PeerEndpoint
+	health        endpointHealth
+
+	mu         sync.RWMutex
+	conn       *connection
+	failoverCh chan struct{}
+	listener   blockListener
+
+	txStore *TxStatusStore
+
+	retryPolicy RetryPolicy
+	queue       *submitQueue
+	cache       *evaluateCache
+	orgs        organizationCache
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// submits tracks SubmitTransaction and SubmitAsync calls, queued or
+	// running, and commits the background commit status waits, so that
+	// Shutdown can drain both before stopping the other goroutines. submitMu
+	// orders a submission's start against Shutdown setting closing.
+	submitMu sync.Mutex
+	submits  sync.WaitGroup
+	commits  sync.WaitGroup
+	inFlight atomic.Int64
+	closing  atomic.Bool
 }
 
-func NewClient(channelName, chaincodeName string) (*Client, error) {
+// ErrShuttingDown is returned for submissions made after Shutdown started
+var ErrShuttingDown = errors.New("gateway is shutting down")
+
+// DefaultPeerEndpoints is used when no peers are configured
+func DefaultPeerEndpoints() []PeerEndpoint {
+	peers, _ := ParsePeerEndpoints("peer0.org1.example.com:7051")
+	return peers
+}
+
+// NewClient connects to the first healthy peer in peers, failing over to the
+// others while running. txStore may be nil, in which case asynchronous
+// submission is unavailable.
+func NewClient(channelName, chaincodeName string, peers []PeerEndpoint, txStore *TxStatusStore) (*Client, error) {
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peer endpoints configured")
+	}
+
 	// Paths - these are relative to /app in the container
-	cryptoPath := "/app/organizations/peerOrganizations/org1.example.com"
+	cryptoPath := filepath.Join(organizationsPath, "peerOrganizations", "org1.example.com")
 	certPath := filepath.Join(cryptoPath, "users", "Admin@org1.example.com", "msp", "signcerts", "Admin@org1.example.com-cert.pem")
 	keyDir := filepath.Join(cryptoPath, "users", "Admin@org1.example.com", "msp", "keystore")
-	tlsCertPath := filepath.Join(cryptoPath, "peers", "peer0.org1.example.com", "tls", "ca.crt")
-
-	peerEndpoint := "peer0.org1.example.com:7051"
-	gatewayPeer := "peer0.org1.example.com"
 
 	// Load credentials
 	certificate, err := loadCertificate(certPath)
@@ -51,50 +106,53 @@ func NewClient(channelName, chaincodeName string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create signer: %w", err)
 	}
 
-	// Create gRPC connection
-	tlsCert, err := os.ReadFile(tlsCertPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read TLS cert: %w", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		channelName:   channelName,
+		chaincodeName: chaincodeName,
+		id:            id,
+		sign:          sign,
+		peers:         peers,
+		failoverCh:    make(chan struct{}, 1),
+		txStore:       txStore,
+		ctx:           ctx,
+		cancel:        cancel,
+
+		retryPolicy: DefaultRetryPolicy(),
+		queue:       newSubmitQueue(DefaultQueueConfig()),
+		cache:       newEvaluateCache(DefaultCacheConfig()),
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(tlsCert) {
-		return nil, fmt.Errorf("failed to add TLS cert to pool")
+	c.health.status = make([]EndpointStatus, len(peers))
+	for i, peer := range peers {
+		c.health.status[i].Address = peer.Address
 	}
 
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, gatewayPeer)
-	grpcConn, err := grpc.Dial(peerEndpoint,
-		grpc.WithTransportCredentials(transportCredentials),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
-	}
-
-	// Create gateway
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(grpcConn),
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
+	c.conn, err = c.connectFirstHealthy(0)
 	if err != nil {
-		grpcConn.Close()
-		return nil, fmt.Errorf("failed to connect gateway: %w", err)
+		// Start anyway; gRPC keeps reconnecting and the monitor fails over
+		// as soon as any peer comes up
+		slog.Warn("no peer is reachable yet", "peer", peers[0].Address, "error", err)
+		if c.conn, err = c.dial(0, false); err != nil {
+			cancel()
+			c.queue.close()
+			return nil, err
+		}
 	}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
+	slog.Info("connected to Fabric network", "channel", channelName, "chaincode", chaincodeName, "peer", peers[c.conn.endpoint].Address)
+
+	c.wg.Add(2)
+	go c.monitorEndpoints()
+	go c.listenBlocks()
 
-	log.Printf("Connected to Fabric network: channel=%s, chaincode=%s", channelName, chaincodeName)
+	if txStore != nil {
+		if err := c.resumePendingCommits(); err != nil {
+			slog.Error("failed to resume pending transactions", "error", err)
+		}
+	}
 
-	return &Client{
-		grpcConn: grpcConn,
-		gateway:  gw,
-		contract: contract,
-	}, nil
+	return c, nil
 }
 
 func loadCertificate(certPath string) (*x509.Certificate, error) {
@@ -128,35 +186,439 @@ func loadPrivateKey(keyDir string) (interface{}, error) {
 	return nil, fmt.Errorf("no private key found in %s", keyDir)
 }
 
-func (c *Client) SubmitTransaction(funcName string, args ...string) (string, error) {
-	log.Printf("Submitting transaction: %s with %d args", funcName, len(args))
+// SetRetryPolicy replaces the policy used to retry failed transactions
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetCacheConfig resizes the evaluate cache, dropping its entries
+func (c *Client) SetCacheConfig(config CacheConfig) {
+	c.cache.configure(config)
+}
+
+// CacheSize returns the number of cached evaluation results
+func (c *Client) CacheSize() int {
+	return c.cache.len()
+}
+
+// SetQueueConfig resizes the submission queue
+func (c *Client) SetQueueConfig(config QueueConfig) {
+	c.queue.configure(config)
+}
+
+// QueueDepth returns the number of submissions waiting for a worker and the
+// number being processed
+func (c *Client) QueueDepth() (queued, running int) {
+	return c.queue.depth()
+}
+
+// SubmitTransaction endorses, orders and waits for the commit of a
+// transaction. ctx carries the trace context; the phases themselves use the
+// gateway's configured timeouts. The call waits for a submission worker and
+// fails with QUEUE_FULL when too many submissions are already waiting.
+func (c *Client) SubmitTransaction(ctx context.Context, funcName string, args ...string) (string, error) {
+	if err := c.startSubmit(); err != nil {
+		return "", err
+	}
+	defer c.submits.Done()
+	c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+
+	ctx, span := c.startSpan(ctx, "fabric.Submit "+funcName, funcName)
+	defer span.End()
 
-	result, err := c.contract.SubmitTransaction(funcName, args...)
+	start := time.Now()
+	logCall(ctx, "submitting transaction", funcName, args)
+
+	var result []byte
+	var txID string
+	err := c.queue.do(ctx, funcName, queueKey(funcName, args), func() error {
+		return c.withRetry(ctx, funcName, true, func() error {
+			var commit *client.Commit
+			var err error
+			if result, commit, err = c.endorseAndSubmit(ctx, funcName, args); err != nil {
+				return err
+			}
+			txID = commit.TransactionID()
+			return c.waitForCommit(ctx, funcName, commit)
+		})
+	})
 	if err != nil {
+		recordSpanError(span, err)
+		slog.ErrorContext(ctx, "transaction failed", "function", funcName, "txId", txID,
+			"code", ClassifyError(err).Code, "durationMs", time.Since(start).Milliseconds(), "error", err)
 		return "", fmt.Errorf("failed to submit transaction %s: %w", funcName, err)
 	}
 
-	log.Printf("Transaction %s submitted successfully", funcName)
+	// Let the caller read its own write before the block event arrives
+	c.cache.invalidate(map[string]bool{queueKey(funcName, args): true})
+
+	slog.InfoContext(ctx, "transaction committed", "function", funcName, "txId", txID,
+		"durationMs", time.Since(start).Milliseconds())
 	return string(result), nil
 }
 
-func (c *Client) EvaluateTransaction(funcName string, args ...string) (string, error) {
-	log.Printf("Evaluating transaction: %s with %d args", funcName, len(args))
+// EvaluateTransaction queries the ledger. Results are cached per function and
+// arguments until a block writes the state they read or the TTL expires; the
+// cache is only used while the block event listener is running, and ctx may
+// opt out with WithCacheMode.
+func (c *Client) EvaluateTransaction(ctx context.Context, funcName string, args ...string) (string, error) {
+	ctx, span := c.startSpan(ctx, "fabric.Evaluate "+funcName, funcName)
+	defer span.End()
+
+	key := cacheKey(UserFromContext(ctx), funcName, args)
+	mode := cacheModeFrom(ctx)
+	useCache := c.cache.enabled() && c.ListenerStatus().Running
+
+	var epoch uint64
+	if useCache {
+		var cached string
+		var hit bool
+		cached, hit, epoch = c.cache.get(key)
+		switch {
+		case mode != CacheDefault:
+			metrics.CountCache(funcName, metrics.CacheBypass)
+		case hit:
+			metrics.CountCache(funcName, metrics.CacheHit)
+			span.SetAttributes(attribute.Bool("fabric.cache_hit", true))
+			return cached, nil
+		default:
+			metrics.CountCache(funcName, metrics.CacheMiss)
+		}
+	}
+
+	start := time.Now()
+	logCall(ctx, "evaluating transaction", funcName, args)
 
-	result, err := c.contract.EvaluateTransaction(funcName, args...)
+	var result []byte
+	err := c.withRetry(ctx, funcName, false, func() (err error) {
+		start := time.Now()
+		result, err = c.current().contract.Evaluate(funcName,
+			client.WithArguments(args...),
+			client.WithTransient(Transient(ctx)),
+		)
+		metrics.ObservePhase("evaluate", funcName, start, err)
+		return err
+	})
 	if err != nil {
+		recordSpanError(span, err)
+		slog.WarnContext(ctx, "evaluation failed", "function", funcName,
+			"code", ClassifyError(err).Code, "durationMs", time.Since(start).Milliseconds(), "error", err)
 		return "", fmt.Errorf("failed to evaluate transaction %s: %w", funcName, err)
 	}
 
+	if useCache && mode != CacheBypass {
+		c.cache.put(key, cacheTag(funcName, args), string(result), epoch)
+	}
+
+	slog.DebugContext(ctx, "transaction evaluated", "function", funcName,
+		"durationMs", time.Since(start).Milliseconds())
 	return string(result), nil
 }
 
-func (c *Client) Close() {
-	log.Println("Closing Fabric gateway connection")
-	if c.gateway != nil {
-		c.gateway.Close()
+// logCall logs the start of a Fabric call. Arguments are only included at
+// debug level when payload logging is enabled, as they may contain locations.
+func logCall(ctx context.Context, msg, funcName string, args []string) {
+	attrs := []any{"function", funcName, "argCount", len(args)}
+	if logging.PayloadsEnabled() {
+		attrs = append(attrs, "args", args)
+	}
+	slog.DebugContext(ctx, msg, attrs...)
+}
+
+// endorseAndSubmit endorses the proposal and sends the transaction to the
+// orderer, recording the latency of each phase. The trace context and acting
+// user go to the chaincode in the transient map, which is not written to the
+// ledger. Writes to a registered vehicle are endorsed by the organizations
+// its key-level policy requires.
+func (c *Client) endorseAndSubmit(ctx context.Context, funcName string, args []string) ([]byte, *client.Commit, error) {
+	orgs, err := c.endorsingOrganizations(ctx, funcName, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []client.ProposalOption{
+		client.WithArguments(args...),
+		client.WithTransient(Transient(ctx)),
+	}
+	if len(orgs) > 0 {
+		options = append(options, client.WithEndorsingOrganizations(orgs...))
+	}
+
+	proposal, err := c.current().contract.NewProposal(funcName, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, span := c.startSpan(ctx, "fabric.Endorse", funcName)
+	span.SetAttributes(attribute.String("fabric.tx_id", proposal.TransactionID()))
+	start := time.Now()
+	transaction, err := proposal.Endorse()
+	metrics.ObservePhase("endorse", funcName, start, err)
+	endSpan(span, err)
+	if err != nil {
+		return nil, nil, err
 	}
-	if c.grpcConn != nil {
-		c.grpcConn.Close()
+
+	_, span = c.startSpan(ctx, "fabric.SubmitToOrderer", funcName)
+	span.SetAttributes(attribute.String("fabric.tx_id", transaction.TransactionID()))
+	start = time.Now()
+	commit, err := transaction.Submit()
+	metrics.ObservePhase("submit", funcName, start, err)
+	endSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return transaction.Result(), commit, nil
+}
+
+// waitForCommit blocks until the transaction is committed and fails if it
+// was marked invalid
+func (c *Client) waitForCommit(ctx context.Context, funcName string, commit *client.Commit) error {
+	_, span := c.startSpan(ctx, "fabric.Commit", funcName)
+	span.SetAttributes(attribute.String("fabric.tx_id", commit.TransactionID()))
+
+	start := time.Now()
+	status, err := commit.Status()
+	if err == nil {
+		span.SetAttributes(
+			attribute.Int64("fabric.block_number", int64(status.BlockNumber)),
+			attribute.String("fabric.validation_code", status.Code.String()),
+		)
+		if !status.Successful {
+			err = commitFailure(status.TransactionID, status.Code)
+		}
 	}
+	metrics.ObservePhase("commit", funcName, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// SubmitAsync endorses the transaction and sends it to the orderer, returning
+// the transaction ID without waiting for the commit. The commit status is
+// tracked in the background and recorded in the transaction status store.
+func (c *Client) SubmitAsync(ctx context.Context, funcName string, args ...string) (string, error) {
+	if c.txStore == nil {
+		return "", fmt.Errorf("asynchronous submission requires a transaction status store")
+	}
+	if err := c.startSubmit(); err != nil {
+		return "", err
+	}
+	defer c.submits.Done()
+
+	ctx, span := c.startSpan(ctx, "fabric.SubmitAsync "+funcName, funcName)
+	defer span.End()
+
+	start := time.Now()
+	logCall(ctx, "submitting transaction asynchronously", funcName, args)
+
+	var commit *client.Commit
+	err := c.queue.do(ctx, funcName, queueKey(funcName, args), func() error {
+		return c.withRetry(ctx, funcName, true, func() (err error) {
+			_, commit, err = c.endorseAndSubmit(ctx, funcName, args)
+			return err
+		})
+	})
+	if err != nil {
+		recordSpanError(span, err)
+		slog.ErrorContext(ctx, "transaction failed", "function", funcName,
+			"code", ClassifyError(err).Code, "durationMs", time.Since(start).Milliseconds(), "error", err)
+		return "", fmt.Errorf("failed to submit transaction %s: %w", funcName, err)
+	}
+
+	now := time.Now().UTC()
+	status := &TxStatus{
+		TxID:        commit.TransactionID(),
+		Function:    funcName,
+		Status:      TxStatusPending,
+		SubmittedAt: now,
+		UpdatedAt:   now,
+	}
+
+	// The transaction is already with the orderer, so a failure to persist
+	// only costs us resuming the wait after a restart
+	if status.Commit, err = commit.Bytes(); err != nil {
+		slog.ErrorContext(ctx, "failed to serialize commit", "function", funcName, "txId", status.TxID, "error", err)
+	}
+	if err := c.txStore.Put(status); err != nil {
+		slog.ErrorContext(ctx, "failed to record transaction status", "function", funcName, "txId", status.TxID, "error", err)
+	}
+
+	c.trackCommit(trace.SpanContextFromContext(ctx), status, commit)
+
+	slog.InfoContext(ctx, "transaction ordered", "function", funcName, "txId", status.TxID,
+		"durationMs", time.Since(start).Milliseconds())
+	return status.TxID, nil
+}
+
+// TransactionStatus returns the recorded status of an asynchronously
+// submitted transaction, or nil if the transaction is unknown
+func (c *Client) TransactionStatus(txID string) (*TxStatus, error) {
+	if c.txStore == nil {
+		return nil, fmt.Errorf("transaction status store is not configured")
+	}
+
+	status, err := c.txStore.Get(txID)
+	if err != nil || status == nil {
+		return nil, err
+	}
+
+	status.Commit = nil
+	return status, nil
+}
+
+func (c *Client) resumePendingCommits() error {
+	pending, err := c.txStore.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range pending {
+		commit, err := c.current().gateway.NewCommit(status.Commit)
+		if err != nil {
+			slog.Error("cannot resume transaction", "function", status.Function, "txId", status.TxID, "error", err)
+			continue
+		}
+		c.trackCommit(trace.SpanContext{}, status, commit)
+	}
+
+	if len(pending) > 0 {
+		slog.Info("resumed commit tracking", "pending", len(pending))
+	}
+	return nil
+}
+
+// trackCommit waits in the background for the transaction to commit and
+// records the outcome. The wait is abandoned when the client is closed; the
+// transaction stays pending and is picked up again on the next start.
+func (c *Client) trackCommit(parent trace.SpanContext, status *TxStatus, commit *client.Commit) {
+	c.commits.Add(1)
+	c.inFlight.Add(1)
+	go func() {
+		defer c.commits.Done()
+		defer c.inFlight.Add(-1)
+
+		_, span := c.startSpan(trace.ContextWithSpanContext(c.ctx, parent), "fabric.Commit", status.Function)
+		span.SetAttributes(attribute.String("fabric.tx_id", status.TxID))
+		defer span.End()
+
+		for {
+			result, err := commit.StatusWithContext(c.ctx)
+			if err == nil {
+				var outcome error
+				if !result.Successful {
+					outcome = commitFailure(result.TransactionID, result.Code)
+				}
+				metrics.ObservePhase("commit", status.Function, status.SubmittedAt, outcome)
+				span.SetAttributes(
+					attribute.Int64("fabric.block_number", int64(result.BlockNumber)),
+					attribute.String("fabric.validation_code", result.Code.String()),
+				)
+				endSpan(span, outcome)
+
+				status.BlockNumber = result.BlockNumber
+				status.ValidationCode = result.Code.String()
+				status.Status = TxStatusInvalid
+				if result.Successful {
+					status.Status = TxStatusCommitted
+				}
+				status.Commit = nil
+				status.UpdatedAt = time.Now().UTC()
+
+				if err := c.txStore.Put(status); err != nil {
+					slog.Error("failed to record transaction status", "function", status.Function, "txId", status.TxID, "error", err)
+				}
+				slog.Info("transaction committed", "function", status.Function, "txId", status.TxID,
+					"validationCode", status.ValidationCode, "block", status.BlockNumber,
+					"durationMs", time.Since(status.SubmittedAt).Milliseconds())
+				return
+			}
+
+			if c.ctx.Err() != nil {
+				return
+			}
+
+			slog.Warn("failed to get commit status, retrying", "function", status.Function, "txId", status.TxID, "error", err)
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(commitRetryInterval):
+			}
+
+			// The peer may have changed since the commit was created
+			if status.Commit != nil {
+				if resumed, err := c.current().gateway.NewCommit(status.Commit); err == nil {
+					commit = resumed
+				}
+			}
+		}
+	}()
+}
+
+// Shutdown rejects new submissions and waits until every submission, queued
+// or running, has finished and every in-flight transaction has its commit
+// status, or until ctx expires. It then closes the client, which fails the
+// submissions still queued with ErrShuttingDown and waits for the running
+// ones. Transactions still pending at the deadline are resumed on the next
+// start.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.stopSubmits()
+
+	drained := make(chan struct{})
+	go func() {
+		// A submission starts its commit wait before it finishes, so once
+		// submits is drained no new commit waits are added
+		c.submits.Wait()
+		c.commits.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("%d transactions still in flight at shutdown deadline", c.inFlight.Load())
+	}
+
+	c.Close()
+	return err
+}
+
+// startSubmit counts a submission in until it calls submits.Done, or returns
+// ErrShuttingDown once Shutdown or Close has started
+func (c *Client) startSubmit() error {
+	c.submitMu.Lock()
+	defer c.submitMu.Unlock()
+
+	if c.closing.Load() {
+		return ErrShuttingDown
+	}
+	c.submits.Add(1)
+	return nil
+}
+
+// stopSubmits rejects new submissions. Every submission that got past
+// startSubmit is already counted in submits, so it is safe to wait on.
+func (c *Client) stopSubmits() {
+	c.submitMu.Lock()
+	defer c.submitMu.Unlock()
+
+	c.closing.Store(true)
+}
+
+// InFlight returns the number of transactions submitted but not yet known
+// to be committed
+func (c *Client) InFlight() int64 {
+	return c.inFlight.Load()
+}
+
+func (c *Client) Close() {
+	slog.Info("closing Fabric gateway connection")
+	c.stopSubmits()
+	c.queue.close()
+	c.cancel()
+	c.wg.Wait()
+	c.commits.Wait()
+	c.current().close()
 }
@@ -0,0 +1,50 @@
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// vehicleWriteFunctions write the assets of the vehicle named by their first
+// argument. Once a vehicle is registered those writes must be endorsed by
+// the organizations in its key-level policy, which the default endorsement
+// plan, built from the chaincode-level policy, does not know about.
+var vehicleWriteFunctions = map[string]bool{
+	"SubmitTelemetry":    true,
+	"SetVehicleStatus":   true,
+	"GrantAccess":        true,
+	"RevokeAccess":       true,
+	"RefreshEndorsement": true,
+	"ProposeTransfer":    true,
+	"AcceptTransfer":     true,
+	"CancelTransfer":     true,
+	"AssignRole":         true,
+	"RevokeRole":         true,
+	"InviteUser":         true,
+	"AcceptInvitation":   true,
+	"DeclineInvitation":  true,
+	"CancelInvitation":   true,
+}
+
+// endorsingOrganizations returns the organizations whose peers must endorse
+// a submission, or nil to leave the choice to the gateway peer. The lookup
+// goes through the evaluate cache, which a block writing the vehicle clears,
+// so a retry after a grant or transfer changed the policy sees the new one.
+func (c *Client) endorsingOrganizations(ctx context.Context, funcName string, args []string) ([]string, error) {
+	if !vehicleWriteFunctions[funcName] || len(args) == 0 {
+		return nil, nil
+	}
+
+	// The policy is the same for every user, so share one cache entry
+	result, err := c.EvaluateTransaction(WithUser(ctx, ""), "GetEndorsingOrganizations", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var orgs []string
+	if err := json.Unmarshal([]byte(result), &orgs); err != nil {
+		return nil, fmt.Errorf("failed to decode endorsing organizations: %w", err)
+	}
+	return orgs, nil
+}
@@ -0,0 +1,292 @@
+package fabric
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// healthCheckInterval is how often the active peer connection is probed
+	healthCheckInterval = 10 * time.Second
+	// probeTimeout bounds how long a peer may take to reach the ready state
+	probeTimeout = 3 * time.Second
+	// retireGracePeriod is how long a connection replaced by failover stays
+	// open for the calls still using it. It outlasts the longest of them, a
+	// commit status wait, which times out after a minute.
+	retireGracePeriod = 2 * time.Minute
+)
+
+// PeerEndpoint is a gateway peer the client can connect to
+type PeerEndpoint struct {
+	Address     string `json:"address"`
+	ServerName  string `json:"serverName"`
+	TLSCertPath string `json:"-"`
+}
+
+// EndpointStatus reports the last known health of a configured peer
+type EndpointStatus struct {
+	Address     string    `json:"address"`
+	Active      bool      `json:"active"`
+	Healthy     bool      `json:"healthy"`
+	State       string    `json:"state,omitempty"`
+	LastChecked time.Time `json:"lastChecked,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// ParsePeerEndpoints parses a comma-separated list of peers in the form
+// host:port or host:port=/path/to/tls/ca.crt. Without an explicit path the
+// TLS CA certificate is looked up in the organizations directory using the
+// peer's host name, e.g. peer0.org2.example.com reads
+// peerOrganizations/org2.example.com/peers/peer0.org2.example.com/tls/ca.crt.
+func ParsePeerEndpoints(spec string) ([]PeerEndpoint, error) {
+	var endpoints []PeerEndpoint
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		address, tlsCertPath, _ := strings.Cut(entry, "=")
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %q: %w", address, err)
+		}
+
+		if tlsCertPath == "" {
+			_, orgDomain, found := strings.Cut(host, ".")
+			if !found {
+				return nil, fmt.Errorf("cannot derive organization from peer host %q; set the TLS CA path explicitly", host)
+			}
+			tlsCertPath = filepath.Join(organizationsPath, "peerOrganizations", orgDomain, "peers", host, "tls", "ca.crt")
+		}
+
+		endpoints = append(endpoints, PeerEndpoint{
+			Address:     address,
+			ServerName:  host,
+			TLSCertPath: tlsCertPath,
+		})
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no peer endpoints configured")
+	}
+	return endpoints, nil
+}
+
+// connection is the set of handles bound to one peer endpoint
+type connection struct {
+	endpoint int
+	grpcConn *grpc.ClientConn
+	gateway  *client.Gateway
+	network  *client.Network
+	contract *client.Contract
+}
+
+func (conn *connection) close() {
+	conn.gateway.Close()
+	conn.grpcConn.Close()
+}
+
+type endpointHealth struct {
+	mu     sync.Mutex
+	status []EndpointStatus
+}
+
+func (h *endpointHealth) record(index int, healthy bool, state connectivity.State, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := &h.status[index]
+	status.Healthy = healthy
+	status.State = state.String()
+	status.LastChecked = time.Now().UTC()
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+}
+
+// dial opens a connection to the endpoint. With requireReady the dial fails
+// unless the peer reaches the ready state within probeTimeout.
+func (c *Client) dial(index int, requireReady bool) (*connection, error) {
+	endpoint := c.peers[index]
+
+	tlsCert, err := os.ReadFile(endpoint.TLSCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS cert: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(tlsCert) {
+		return nil, fmt.Errorf("failed to add TLS cert to pool")
+	}
+
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, endpoint.ServerName)
+	grpcConn, err := grpc.Dial(endpoint.Address,
+		grpc.WithTransportCredentials(transportCredentials),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	ready, state := probe(grpcConn)
+	if requireReady && !ready {
+		grpcConn.Close()
+		err := fmt.Errorf("peer %s is %s", endpoint.Address, state)
+		c.health.record(index, false, state, err)
+		return nil, err
+	}
+	c.health.record(index, ready, state, nil)
+
+	gw, err := client.Connect(
+		c.id,
+		client.WithSign(c.sign),
+		client.WithClientConnection(grpcConn),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		grpcConn.Close()
+		return nil, fmt.Errorf("failed to connect gateway: %w", err)
+	}
+
+	network := gw.GetNetwork(c.channelName)
+	return &connection{
+		endpoint: index,
+		grpcConn: grpcConn,
+		gateway:  gw,
+		network:  network,
+		contract: network.GetContract(c.chaincodeName),
+	}, nil
+}
+
+// probe waits up to probeTimeout for the connection to become ready
+func probe(grpcConn *grpc.ClientConn) (bool, connectivity.State) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	grpcConn.Connect()
+	for {
+		state := grpcConn.GetState()
+		if state == connectivity.Ready {
+			return true, state
+		}
+		if !grpcConn.WaitForStateChange(ctx, state) {
+			return false, grpcConn.GetState()
+		}
+	}
+}
+
+// connectFirstHealthy dials the endpoints in order starting at start and
+// returns the first one that is ready
+func (c *Client) connectFirstHealthy(start int) (*connection, error) {
+	var lastErr error
+	for i := 0; i < len(c.peers); i++ {
+		index := (start + i) % len(c.peers)
+		conn, err := c.dial(index, true)
+		if err == nil {
+			return conn, nil
+		}
+		slog.Warn("peer unavailable", "peer", c.peers[index].Address, "error", err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no healthy peer endpoint: %w", lastErr)
+}
+
+// current returns the connection to the active peer
+func (c *Client) current() *connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// reportUnavailable asks the monitor to check the active peer now rather
+// than at the next interval
+func (c *Client) reportUnavailable() {
+	select {
+	case c.failoverCh <- struct{}{}:
+	default:
+	}
+}
+
+// monitorEndpoints probes the active peer and fails over to the next healthy
+// endpoint when it stops responding
+func (c *Client) monitorEndpoints() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.failoverCh:
+		}
+
+		active := c.current()
+		ready, state := probe(active.grpcConn)
+		c.health.record(active.endpoint, ready, state, nil)
+		if ready {
+			continue
+		}
+
+		slog.Warn("peer unhealthy, failing over", "peer", c.peers[active.endpoint].Address, "state", state.String())
+		next, err := c.connectFirstHealthy(active.endpoint + 1)
+		if err != nil {
+			slog.Error("failover failed", "peer", c.peers[active.endpoint].Address, "error", err)
+			continue
+		}
+
+		c.mu.Lock()
+		c.conn = next
+		c.mu.Unlock()
+		c.retire(active)
+
+		slog.Info("switched gateway peer", "peer", c.peers[next.endpoint].Address)
+	}
+}
+
+// retire closes a connection replaced by failover once the submissions and
+// commit status waits started on it have had time to finish, or at once
+// when the client closes
+func (c *Client) retire(conn *connection) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		select {
+		case <-time.After(retireGracePeriod):
+		case <-c.ctx.Done():
+		}
+		conn.close()
+	}()
+}
+
+// Endpoints reports the health of every configured peer
+func (c *Client) Endpoints() []EndpointStatus {
+	active := c.current().endpoint
+
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+
+	statuses := make([]EndpointStatus, len(c.health.status))
+	copy(statuses, c.health.status)
+	statuses[active].Active = true
+	return statuses
+}
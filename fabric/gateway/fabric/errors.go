@@ -0,0 +1,217 @@
+package fabric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stable error codes returned to API clients
+const (
+	ErrCodeMVCCConflict      = "MVCC_CONFLICT"
+	ErrCodeEndorsementPolicy = "ENDORSEMENT_POLICY_FAILURE"
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeTimeout           = "TIMEOUT"
+	ErrCodeChaincode         = "CHAINCODE_ERROR"
+	ErrCodeUnavailable       = "UNAVAILABLE"
+	ErrCodeTxInvalid         = "TRANSACTION_INVALID"
+	ErrCodeInternal          = "INTERNAL_ERROR"
+)
+
+// ErrorDetail is the error reported by an individual peer or orderer
+type ErrorDetail struct {
+	Address string `json:"address,omitempty"`
+	MSPID   string `json:"mspId,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error is a Fabric failure translated into an API error code and HTTP status
+type Error struct {
+	Code       string
+	HTTPStatus int
+	Message    string
+	TxID       string
+	Details    []ErrorDetail
+	// RetryAfter, when set, tells the client when to try again
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError translates errors returned by the Fabric gateway client into
+// an *Error. Errors already classified are returned unchanged.
+func ClassifyError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	result := &Error{
+		Code:       ErrCodeInternal,
+		HTTPStatus: http.StatusInternalServerError,
+		Message:    err.Error(),
+		Err:        err,
+	}
+
+	if errors.Is(err, ErrShuttingDown) {
+		result.Code, result.HTTPStatus = ErrCodeUnavailable, http.StatusServiceUnavailable
+		return result
+	}
+
+	var commitErr *client.CommitError
+	if errors.As(err, &commitErr) {
+		result.TxID = commitErr.TransactionID
+		result.Code, result.HTTPStatus = classifyValidationCode(commitErr.Code)
+		return result
+	}
+
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	switch {
+	case errors.As(err, &endorseErr):
+		result.TxID = endorseErr.TransactionID
+	case errors.As(err, &submitErr):
+		result.TxID = submitErr.TransactionID
+	case errors.As(err, &commitStatusErr):
+		result.TxID = commitStatusErr.TransactionID
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		result.Code, result.HTTPStatus = ErrCodeTimeout, http.StatusGatewayTimeout
+		return result
+	}
+
+	grpcStatus, ok := status.FromError(err)
+	if !ok {
+		return result
+	}
+
+	result.Details = errorDetails(grpcStatus)
+	result.Code, result.HTTPStatus = classifyStatus(grpcStatus, result.Details)
+	if submitErr != nil && result.Code == ErrCodeChaincode {
+		// The orderer does not run chaincode, so a rejected submit is an
+		// availability problem rather than a contract error
+		result.Code, result.HTTPStatus = ErrCodeUnavailable, http.StatusBadGateway
+	}
+
+	return result
+}
+
+// commitFailure reports a transaction that was ordered but marked invalid
+func commitFailure(txID string, code peer.TxValidationCode) *Error {
+	errCode, httpStatus := classifyValidationCode(code)
+	return &Error{
+		Code:       errCode,
+		HTTPStatus: httpStatus,
+		Message:    fmt.Sprintf("transaction %s failed to commit with status code %d (%s)", txID, int32(code), code),
+		TxID:       txID,
+	}
+}
+
+func classifyValidationCode(code peer.TxValidationCode) (string, int) {
+	switch code {
+	case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+		return ErrCodeMVCCConflict, http.StatusConflict
+	case peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:
+		return ErrCodeEndorsementPolicy, http.StatusForbidden
+	default:
+		return ErrCodeTxInvalid, http.StatusConflict
+	}
+}
+
+func classifyStatus(grpcStatus *status.Status, details []ErrorDetail) (string, int) {
+	switch grpcStatus.Code() {
+	case codes.DeadlineExceeded:
+		return ErrCodeTimeout, http.StatusGatewayTimeout
+	case codes.Unavailable:
+		return ErrCodeUnavailable, http.StatusServiceUnavailable
+	case codes.NotFound:
+		return ErrCodeNotFound, http.StatusNotFound
+	case codes.Canceled:
+		return ErrCodeTimeout, http.StatusGatewayTimeout
+	}
+
+	messages := []string{grpcStatus.Message()}
+	for _, detail := range details {
+		messages = append(messages, detail.Message)
+	}
+	if code, httpStatus, ok := classifyMessages(messages); ok {
+		return code, httpStatus
+	}
+
+	// The gateway reports a chaincode that returned an error as Aborted
+	// (endorse) or Unknown (evaluate), with the peer messages in details
+	switch grpcStatus.Code() {
+	case codes.Aborted, codes.Unknown, codes.FailedPrecondition, codes.InvalidArgument:
+		return ErrCodeChaincode, http.StatusUnprocessableEntity
+	}
+
+	return ErrCodeInternal, http.StatusBadGateway
+}
+
+// classifyMessages recognises well-known failures from the text of peer and
+// chaincode error messages
+func classifyMessages(messages []string) (string, int, bool) {
+	for _, message := range messages {
+		lower := strings.ToLower(message)
+		switch {
+		case strings.Contains(lower, "not found"), strings.Contains(lower, "does not exist"):
+			return ErrCodeNotFound, http.StatusNotFound, true
+		case strings.Contains(lower, "endorsement policy"), strings.Contains(lower, "failed to collect enough"):
+			return ErrCodeEndorsementPolicy, http.StatusForbidden, true
+		case strings.Contains(lower, "mvcc"):
+			return ErrCodeMVCCConflict, http.StatusConflict, true
+		}
+	}
+	return "", 0, false
+}
+
+// ChaincodeError classifies an error returned by the chaincode itself, for
+// ledgers that run the contract without going through a peer
+func ChaincodeError(txID, message string) *Error {
+	code, httpStatus, ok := classifyMessages([]string{message})
+	if !ok {
+		code, httpStatus = ErrCodeChaincode, http.StatusUnprocessableEntity
+	}
+	return &Error{
+		Code:       code,
+		HTTPStatus: httpStatus,
+		Message:    message,
+		TxID:       txID,
+	}
+}
+
+func errorDetails(grpcStatus *status.Status) []ErrorDetail {
+	var details []ErrorDetail
+	for _, detail := range grpcStatus.Details() {
+		if peerDetail, ok := detail.(*gateway.ErrorDetail); ok {
+			details = append(details, ErrorDetail{
+				Address: peerDetail.GetAddress(),
+				MSPID:   peerDetail.GetMspId(),
+				Message: peerDetail.GetMessage(),
+			})
+		}
+	}
+	return details
+}
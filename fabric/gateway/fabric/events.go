@@ -0,0 +1,213 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"fabric-gateway/metrics"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// listenerRetryInterval is the delay before reconnecting a dropped block
+// event stream
+const listenerRetryInterval = 5 * time.Second
+
+// ListenerStatus reports the progress of the block event listener
+type ListenerStatus struct {
+	Running   bool      `json:"running"`
+	LastBlock uint64    `json:"lastBlock"`
+	LastEvent time.Time `json:"lastEvent,omitempty"`
+}
+
+type blockListener struct {
+	mu        sync.Mutex
+	running   bool
+	started   bool
+	lastBlock uint64
+	lastEvent time.Time
+}
+
+func (l *blockListener) status() ListenerStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ListenerStatus{Running: l.running, LastBlock: l.lastBlock, LastEvent: l.lastEvent}
+}
+
+// ChannelHeight queries the peer for the number of blocks in the channel
+func (c *Client) ChannelHeight(ctx context.Context) (uint64, error) {
+	qscc := c.current().network.GetContract("qscc")
+	result, err := qscc.EvaluateWithContext(ctx, "GetChainInfo", client.WithArguments(c.channelName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query chain info: %w", err)
+	}
+
+	var info common.BlockchainInfo
+	if err := proto.Unmarshal(result, &info); err != nil {
+		return 0, fmt.Errorf("failed to parse chain info: %w", err)
+	}
+	return info.GetHeight(), nil
+}
+
+// listenBlocks follows block events from the active peer, reconnecting
+// from the next expected block whenever the stream ends
+func (c *Client) listenBlocks() {
+	defer c.wg.Done()
+
+	for c.ctx.Err() == nil {
+		if err := c.streamBlocks(); err != nil && c.ctx.Err() == nil {
+			slog.Warn("block event stream interrupted", "error", err)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(listenerRetryInterval):
+		}
+	}
+}
+
+func (c *Client) streamBlocks() error {
+	l := &c.listener
+
+	l.mu.Lock()
+	started, startBlock := l.started, l.lastBlock+1
+	l.mu.Unlock()
+
+	if !started {
+		height, err := c.ChannelHeight(c.ctx)
+		if err != nil {
+			return err
+		}
+		startBlock = height
+		l.mu.Lock()
+		l.started = true
+		if height > 0 {
+			l.lastBlock = height - 1
+		}
+		l.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	blocks, err := c.current().network.BlockEvents(ctx, client.WithStartBlock(startBlock))
+	if err != nil {
+		return err
+	}
+
+	// Blocks may have been missed while the stream was down
+	c.cache.purge()
+
+	l.mu.Lock()
+	l.running = true
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.running = false
+		l.mu.Unlock()
+	}()
+
+	for block := range blocks {
+		if cars := writtenCars(block, c.chaincodeName); len(cars) > 0 {
+			metrics.CountCacheInvalidations(c.cache.invalidate(cars))
+		}
+
+		l.mu.Lock()
+		l.lastBlock = block.GetHeader().GetNumber()
+		l.lastEvent = time.Now().UTC()
+		l.mu.Unlock()
+	}
+
+	return fmt.Errorf("event stream closed")
+}
+
+// writtenCars returns the cars whose state was written by the valid
+// transactions of namespace in block. Composite keys identify the car by
+// their first attribute; plain keys are the car ID. Transactions that cannot
+// be parsed are skipped.
+func writtenCars(block *common.Block, namespace string) map[string]bool {
+	cars := make(map[string]bool)
+	filter := block.GetMetadata().GetMetadata()[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+
+	for i, data := range block.GetData().GetData() {
+		if i < len(filter) && peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+		for _, key := range writtenKeys(data, namespace) {
+			if car := carFromKey(key); car != "" {
+				cars[car] = true
+			}
+		}
+	}
+	return cars
+}
+
+func writtenKeys(envelopeBytes []byte, namespace string) []string {
+	envelope := &common.Envelope{}
+	payload := &common.Payload{}
+	channelHeader := &common.ChannelHeader{}
+	transaction := &peer.Transaction{}
+	if proto.Unmarshal(envelopeBytes, envelope) != nil ||
+		proto.Unmarshal(envelope.GetPayload(), payload) != nil ||
+		proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader) != nil ||
+		common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION ||
+		proto.Unmarshal(payload.GetData(), transaction) != nil {
+		return nil
+	}
+
+	var keys []string
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		responsePayload := &peer.ProposalResponsePayload{}
+		chaincodeAction := &peer.ChaincodeAction{}
+		txRWSet := &rwset.TxReadWriteSet{}
+		if proto.Unmarshal(action.GetPayload(), actionPayload) != nil ||
+			proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload) != nil ||
+			proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction) != nil ||
+			proto.Unmarshal(chaincodeAction.GetResults(), txRWSet) != nil {
+			continue
+		}
+
+		for _, nsRWSet := range txRWSet.GetNsRwset() {
+			if nsRWSet.GetNamespace() != namespace {
+				continue
+			}
+			kvRWSet := &kvrwset.KVRWSet{}
+			if proto.Unmarshal(nsRWSet.GetRwset(), kvRWSet) != nil {
+				continue
+			}
+			for _, write := range kvRWSet.GetWrites() {
+				keys = append(keys, write.GetKey())
+			}
+		}
+	}
+	return keys
+}
+
+// carFromKey returns the car a state key belongs to. Composite keys have the
+// form \x00objectType\x00attr1\x00...; the first attribute is the car ID.
+func carFromKey(key string) string {
+	if !strings.HasPrefix(key, "\x00") {
+		return key
+	}
+	parts := strings.Split(key, "\x00")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
+
+// ListenerStatus reports the last block seen by the block event listener
+func (c *Client) ListenerStatus() ListenerStatus {
+	return c.listener.status()
+}
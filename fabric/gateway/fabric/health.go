@@ -0,0 +1,116 @@
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ChaincodeInfo is the subset of the contract metadata reported by readiness
+type ChaincodeInfo struct {
+	Name      string   `json:"name"`
+	Title     string   `json:"title"`
+	Version   string   `json:"version"`
+	Contracts []string `json:"contracts"`
+}
+
+// Readiness is the result of checking that the gateway can serve requests
+type Readiness struct {
+	Ready           bool             `json:"ready"`
+	Peer            string           `json:"peer"`
+	ConnectionState string           `json:"connectionState"`
+	Endpoints       []EndpointStatus `json:"endpoints"`
+	Chaincode       *ChaincodeInfo   `json:"chaincode,omitempty"`
+	ChannelHeight   uint64           `json:"channelHeight,omitempty"`
+	EventListener   ListenerStatus   `json:"eventListener"`
+	ListenerLag     uint64           `json:"listenerLag"`
+	Errors          []string         `json:"errors,omitempty"`
+}
+
+// contractMetadata mirrors the parts of the contract API metadata we read
+type contractMetadata struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Contracts map[string]json.RawMessage `json:"contracts"`
+}
+
+// CheckReadiness verifies the peer connection and runs cheap queries
+// against the chaincode and channel
+func (c *Client) CheckReadiness(ctx context.Context) *Readiness {
+	conn := c.current()
+	state := conn.grpcConn.GetState()
+
+	readiness := &Readiness{
+		Ready:           true,
+		Peer:            c.peers[conn.endpoint].Address,
+		ConnectionState: state.String(),
+		Endpoints:       c.Endpoints(),
+		EventListener:   c.ListenerStatus(),
+	}
+
+	fail := func(err error) {
+		readiness.Ready = false
+		readiness.Errors = append(readiness.Errors, err.Error())
+	}
+
+	if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+		fail(fmt.Errorf("peer connection is %s", state))
+		return readiness
+	}
+
+	info, err := c.chaincodeInfo(ctx, conn)
+	if err != nil {
+		fail(fmt.Errorf("chaincode check failed: %w", err))
+	} else {
+		readiness.Chaincode = info
+	}
+
+	height, err := c.ChannelHeight(ctx)
+	if err != nil {
+		fail(fmt.Errorf("channel height check failed: %w", err))
+	} else {
+		readiness.ChannelHeight = height
+		if height > 0 && readiness.EventListener.LastBlock < height-1 {
+			readiness.ListenerLag = height - 1 - readiness.EventListener.LastBlock
+		}
+	}
+
+	return readiness
+}
+
+// chaincodeInfo evaluates the contract API's built-in metadata function,
+// which needs no ledger reads
+func (c *Client) chaincodeInfo(ctx context.Context, conn *connection) (*ChaincodeInfo, error) {
+	result, err := conn.contract.EvaluateWithContext(ctx, "org.hyperledger.fabric:GetMetadata", client.WithArguments())
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseChaincodeInfo(c.chaincodeName, result)
+}
+
+// ParseChaincodeInfo reads the output of the contract API's GetMetadata
+// function
+func ParseChaincodeInfo(name string, result []byte) (*ChaincodeInfo, error) {
+	var metadata contractMetadata
+	if err := json.Unmarshal(result, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse chaincode metadata: %w", err)
+	}
+
+	info := &ChaincodeInfo{
+		Name:    name,
+		Title:   metadata.Info.Title,
+		Version: metadata.Info.Version,
+	}
+	for name := range metadata.Contracts {
+		info.Contracts = append(info.Contracts, name)
+	}
+	sort.Strings(info.Contracts)
+	return info, nil
+}
@@ -0,0 +1,24 @@
+package fabric
+
+import "context"
+
+// Ledger is what the handlers need from the vehicle chaincode. Client is the
+// implementation backed by a Fabric network; mockledger runs the contract in
+// process for local development.
+type Ledger interface {
+	SubmitTransaction(ctx context.Context, funcName string, args ...string) (string, error)
+	SubmitAsync(ctx context.Context, funcName string, args ...string) (string, error)
+	EvaluateTransaction(ctx context.Context, funcName string, args ...string) (string, error)
+	TransactionStatus(txID string) (*TxStatus, error)
+	ChannelOrganizations(ctx context.Context) ([]string, error)
+
+	CheckReadiness(ctx context.Context) *Readiness
+	ListenerStatus() ListenerStatus
+	InFlight() int64
+	QueueDepth() (queued, running int)
+	CacheSize() int
+
+	Shutdown(ctx context.Context) error
+}
+
+var _ Ledger = (*Client)(nil)
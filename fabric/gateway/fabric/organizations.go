@@ -0,0 +1,97 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"google.golang.org/protobuf/proto"
+)
+
+// organizationsTTL is how long the channel's organizations are kept before
+// the config block is read again, so that organizations joining the channel
+// are picked up without a restart
+const organizationsTTL = 5 * time.Minute
+
+// organizationCache holds the last organizations read from the channel
+// config
+type organizationCache struct {
+	mu      sync.Mutex
+	orgs    []string
+	fetched time.Time
+}
+
+// ChannelOrganizations returns the MSP IDs of the channel's application
+// organizations, sorted. The chaincode cannot read the channel config, so
+// the gateway checks organizations named in requests against it.
+func (c *Client) ChannelOrganizations(ctx context.Context) ([]string, error) {
+	c.orgs.mu.Lock()
+	defer c.orgs.mu.Unlock()
+	if c.orgs.orgs != nil && time.Since(c.orgs.fetched) < organizationsTTL {
+		return c.orgs.orgs, nil
+	}
+
+	cscc := c.current().network.GetContract("cscc")
+	result, err := cscc.EvaluateWithContext(ctx, "GetConfigBlock", client.WithArguments(c.channelName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel config: %w", err)
+	}
+
+	orgs, err := configOrganizations(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse channel config: %w", err)
+	}
+	c.orgs.orgs = orgs
+	c.orgs.fetched = time.Now()
+	return orgs, nil
+}
+
+// configOrganizations returns the MSP IDs of the application organizations
+// in a config block
+func configOrganizations(blockBytes []byte) ([]string, error) {
+	block := &common.Block{}
+	if err := proto.Unmarshal(blockBytes, block); err != nil {
+		return nil, err
+	}
+	if len(block.GetData().GetData()) == 0 {
+		return nil, fmt.Errorf("config block has no transaction")
+	}
+
+	envelope := &common.Envelope{}
+	payload := &common.Payload{}
+	configEnvelope := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(block.GetData().GetData()[0], envelope); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(payload.GetData(), configEnvelope); err != nil {
+		return nil, err
+	}
+
+	application := configEnvelope.GetConfig().GetChannelGroup().GetGroups()["Application"]
+	orgs := []string{}
+	for _, group := range application.GetGroups() {
+		mspValue, ok := group.GetValues()["MSP"]
+		if !ok {
+			continue
+		}
+		mspConfig := &msp.MSPConfig{}
+		fabricConfig := &msp.FabricMSPConfig{}
+		if err := proto.Unmarshal(mspValue.GetValue(), mspConfig); err != nil {
+			return nil, err
+		}
+		if err := proto.Unmarshal(mspConfig.GetConfig(), fabricConfig); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, fabricConfig.GetName())
+	}
+	sort.Strings(orgs)
+	return orgs, nil
+}
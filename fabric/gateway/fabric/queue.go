@@ -0,0 +1,214 @@
+package fabric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"fabric-gateway/metrics"
+)
+
+// ErrCodeQueueFull is returned when the submission queue has no room
+const ErrCodeQueueFull = "QUEUE_FULL"
+
+// ErrQueueFull is wrapped by the *Error returned for rejected submissions
+var ErrQueueFull = errors.New("submission queue is full")
+
+// QueueConfig bounds the submissions sent to the peers at once
+type QueueConfig struct {
+	// Workers is the number of transactions endorsed and submitted
+	// concurrently
+	Workers int
+	// MaxQueued is how many submissions may wait for a worker before new
+	// ones are rejected
+	MaxQueued int
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Workers:   8,
+		MaxQueued: 256,
+	}
+}
+
+type submitJob struct {
+	ctx      context.Context
+	funcName string
+	run      func() error
+	done     chan error
+	queuedAt time.Time
+}
+
+// submitQueue runs submissions on a fixed set of workers. Jobs with the same
+// key, the car or vehicle ID, run one at a time in the order they were
+// queued; jobs for different keys run in parallel.
+type submitQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	config  QueueConfig
+	waiting map[string][]*submitJob
+	// ready lists keys that have waiting jobs and none running, oldest first
+	ready   []string
+	running map[string]bool
+	queued  int
+	// avgRun is a moving average of job duration, used for Retry-After
+	avgRun time.Duration
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newSubmitQueue(config QueueConfig) *submitQueue {
+	q := &submitQueue{
+		waiting: make(map[string][]*submitJob),
+		running: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	q.configure(config)
+	return q
+}
+
+// configure applies a new configuration. Extra workers are started at once;
+// surplus workers exit after their current job.
+func (q *submitQueue) configure(config QueueConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id := q.config.Workers; id < config.Workers; id++ {
+		q.wg.Add(1)
+		go q.work(id)
+	}
+	q.config = config
+	q.cond.Broadcast()
+}
+
+// do queues run under key and waits for it to finish. It returns a QUEUE_FULL
+// error without queueing when MaxQueued submissions are already waiting.
+func (q *submitQueue) do(ctx context.Context, funcName, key string, run func() error) error {
+	job := &submitJob{
+		ctx:      ctx,
+		funcName: funcName,
+		run:      run,
+		done:     make(chan error, 1),
+		queuedAt: time.Now(),
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrShuttingDown
+	}
+	if q.queued >= q.config.MaxQueued {
+		retryAfter := q.retryAfter()
+		q.mu.Unlock()
+		metrics.CountQueueRejected(funcName)
+		return &Error{
+			Code:       ErrCodeQueueFull,
+			HTTPStatus: http.StatusServiceUnavailable,
+			Message:    fmt.Sprintf("%s; retry in %s", ErrQueueFull, retryAfter),
+			RetryAfter: retryAfter,
+			Err:        ErrQueueFull,
+		}
+	}
+
+	if len(q.waiting[key]) == 0 && !q.running[key] {
+		q.ready = append(q.ready, key)
+	}
+	q.waiting[key] = append(q.waiting[key], job)
+	q.queued++
+	q.cond.Signal()
+	q.mu.Unlock()
+
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		// The worker skips the job when it reaches it
+		return ctx.Err()
+	}
+}
+
+func (q *submitQueue) work(id int) {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for !q.closed && id < q.config.Workers && len(q.ready) == 0 {
+			q.cond.Wait()
+		}
+		if q.closed || id >= q.config.Workers {
+			q.mu.Unlock()
+			return
+		}
+
+		key := q.ready[0]
+		q.ready = q.ready[1:]
+		job := q.waiting[key][0]
+		q.waiting[key] = q.waiting[key][1:]
+		q.queued--
+		q.running[key] = true
+		q.mu.Unlock()
+
+		metrics.ObservePhase("queue", job.funcName, job.queuedAt, nil)
+
+		start := time.Now()
+		err := job.ctx.Err()
+		if err == nil {
+			err = job.run()
+		}
+		job.done <- err
+
+		q.mu.Lock()
+		q.avgRun = (q.avgRun*7 + time.Since(start)) / 8
+		delete(q.running, key)
+		if len(q.waiting[key]) > 0 {
+			q.ready = append(q.ready, key)
+			q.cond.Signal()
+		} else {
+			delete(q.waiting, key)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// retryAfter estimates how long the current backlog takes to drain
+func (q *submitQueue) retryAfter() time.Duration {
+	estimate := q.avgRun * time.Duration(q.queued/max(q.config.Workers, 1)+1)
+	return max(estimate.Round(time.Second), time.Second)
+}
+
+// depth returns the number of waiting and running submissions
+func (q *submitQueue) depth() (queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued, len(q.running)
+}
+
+// close fails every waiting job and stops the workers once their current
+// job is done
+func (q *submitQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	for key, jobs := range q.waiting {
+		for _, job := range jobs {
+			job.done <- ErrShuttingDown
+		}
+		delete(q.waiting, key)
+	}
+	q.ready, q.queued = nil, 0
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// queueKey orders submissions by their first argument, which is the car or
+// vehicle ID for every contract function
+func queueKey(funcName string, args []string) string {
+	if len(args) == 0 {
+		return funcName
+	}
+	return args[0]
+}
@@ -0,0 +1,290 @@
+package fabric
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n jobs are waiting for a worker
+func waitQueued(t *testing.T, q *submitQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if queued, _ := q.depth(); queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			queued, running := q.depth()
+			t.Fatalf("timed out waiting for %d queued jobs; %d queued, %d running", n, queued, running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockKey runs a job under key that holds its worker until release is
+// closed, and returns once the job is running
+func blockKey(t *testing.T, q *submitQueue, key string, release chan struct{}) <-chan error {
+	t.Helper()
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- q.do(context.Background(), "Test", key, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job for %s did not start", key)
+	}
+	return done
+}
+
+func TestSubmitQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		// held are keys whose workers are held by a running job while the
+		// jobs are queued
+		held []string
+		// keys are the keys of the jobs, queued in this order
+		keys []string
+		// want is the order in which the jobs of each key must run
+		want map[string][]int
+		// order, if set, is the order in which all jobs must run
+		order []int
+	}{
+		{
+			name:    "one key runs in queue order",
+			workers: 4,
+			held:    []string{"a"},
+			keys:    []string{"a", "a", "a", "a"},
+			want:    map[string][]int{"a": {0, 1, 2, 3}},
+		},
+		{
+			name:    "keys keep their own order",
+			workers: 4,
+			held:    []string{"a", "b", "c"},
+			keys:    []string{"a", "b", "a", "b", "c"},
+			want:    map[string][]int{"a": {0, 2}, "b": {1, 3}, "c": {4}},
+		},
+		{
+			name:    "a key goes to the back after each job",
+			workers: 1,
+			held:    []string{"x"},
+			keys:    []string{"b", "b", "a", "c"},
+			want:    map[string][]int{"b": {0, 1}, "a": {2}, "c": {3}},
+			order:   []int{0, 2, 3, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSubmitQueue(QueueConfig{Workers: tt.workers, MaxQueued: len(tt.keys)})
+			defer q.close()
+
+			release := make(chan struct{})
+			var held []<-chan error
+			for _, key := range tt.held {
+				held = append(held, blockKey(t, q, key, release))
+			}
+
+			var mu sync.Mutex
+			var order []int
+			ran := make(map[string][]int)
+			running := make(map[string]bool)
+			var wg sync.WaitGroup
+			for i, key := range tt.keys {
+				i, key := i, key
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := q.do(context.Background(), "Test", key, func() error {
+						mu.Lock()
+						if running[key] {
+							t.Errorf("two jobs for %s ran at once", key)
+						}
+						running[key] = true
+						order = append(order, i)
+						ran[key] = append(ran[key], i)
+						mu.Unlock()
+
+						time.Sleep(time.Millisecond)
+
+						mu.Lock()
+						running[key] = false
+						mu.Unlock()
+						return nil
+					})
+					if err != nil {
+						t.Errorf("job %d: %v", i, err)
+					}
+				}()
+				waitQueued(t, q, i+1)
+			}
+
+			close(release)
+			for _, done := range held {
+				if err := <-done; err != nil {
+					t.Fatal(err)
+				}
+			}
+			wg.Wait()
+
+			for key, want := range tt.want {
+				if !slices.Equal(ran[key], want) {
+					t.Errorf("key %s ran jobs %v, want %v", key, ran[key], want)
+				}
+			}
+			if tt.order != nil && !slices.Equal(order, tt.order) {
+				t.Errorf("jobs ran in order %v, want %v", order, tt.order)
+			}
+		})
+	}
+}
+
+func TestSubmitQueueRunsKeysInParallel(t *testing.T) {
+	q := newSubmitQueue(QueueConfig{Workers: 2, MaxQueued: 2})
+	defer q.close()
+
+	release := make(chan struct{})
+	blocked := blockKey(t, q, "a", release)
+
+	// Only runs while "a" holds the other worker
+	if err := q.do(context.Background(), "Test", "b", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	q := newSubmitQueue(QueueConfig{Workers: 1, MaxQueued: 1})
+	defer q.close()
+
+	release := make(chan struct{})
+	blocked := blockKey(t, q, "a", release)
+	queued := make(chan error, 1)
+	go func() { queued <- q.do(context.Background(), "Test", "b", func() error { return nil }) }()
+	waitQueued(t, q, 1)
+
+	err := q.do(context.Background(), "Test", "c", func() error { return nil })
+	var fabricErr *Error
+	if !errors.Is(err, ErrQueueFull) || !errors.As(err, &fabricErr) {
+		t.Fatalf("got %v, want a QUEUE_FULL error", err)
+	}
+	if fabricErr.Code != ErrCodeQueueFull || fabricErr.RetryAfter < time.Second {
+		t.Errorf("got code %s retry after %s", fabricErr.Code, fabricErr.RetryAfter)
+	}
+
+	close(release)
+	for _, done := range []<-chan error{blocked, queued} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSubmitQueueCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancel cancels the context of a waiting job
+		cancel func(context.CancelFunc)
+		// ctxErr is what the waiting job returns
+		ctxErr error
+	}{
+		{
+			name:   "cancelled while queued",
+			cancel: func(cancel context.CancelFunc) { cancel() },
+			ctxErr: context.Canceled,
+		},
+		{
+			name:   "deadline passed while queued",
+			cancel: func(context.CancelFunc) { time.Sleep(20 * time.Millisecond) },
+			ctxErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSubmitQueue(QueueConfig{Workers: 1, MaxQueued: 2})
+			defer q.close()
+
+			release := make(chan struct{})
+			blocked := blockKey(t, q, "a", release)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			var ran atomic.Bool
+			done := make(chan error, 1)
+			go func() {
+				done <- q.do(ctx, "Test", "a", func() error {
+					ran.Store(true)
+					return nil
+				})
+			}()
+			waitQueued(t, q, 1)
+
+			tt.cancel(cancel)
+			if err := <-done; !errors.Is(err, tt.ctxErr) {
+				t.Fatalf("got %v, want %v", err, tt.ctxErr)
+			}
+
+			// The worker skips the abandoned job and moves on
+			close(release)
+			if err := <-blocked; err != nil {
+				t.Fatal(err)
+			}
+			if err := q.do(context.Background(), "Test", "a", func() error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if ran.Load() {
+				t.Error("cancelled job ran")
+			}
+		})
+	}
+}
+
+func TestSubmitQueueClose(t *testing.T) {
+	q := newSubmitQueue(QueueConfig{Workers: 1, MaxQueued: 1})
+
+	release := make(chan struct{})
+	blocked := blockKey(t, q, "a", release)
+	queued := make(chan error, 1)
+	go func() { queued <- q.do(context.Background(), "Test", "b", func() error { return nil }) }()
+	waitQueued(t, q, 1)
+
+	closed := make(chan struct{})
+	go func() {
+		q.close()
+		close(closed)
+	}()
+
+	// Waiting jobs fail at once; the running one is waited for
+	if err := <-queued; !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("queued job: got %v, want ErrShuttingDown", err)
+	}
+	select {
+	case <-closed:
+		t.Fatal("close returned before the running job finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	<-closed
+
+	if err := q.do(context.Background(), "Test", "c", func() error { return nil }); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("after close: got %v, want ErrShuttingDown", err)
+	}
+}
@@ -0,0 +1,154 @@
+package fabric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"fabric-gateway/metrics"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// RetryPolicy controls how failed submit and evaluate calls are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// MaxAttemptsByFunction caps attempts for individual chaincode
+	// functions, overriding MaxAttempts in either direction
+	MaxAttemptsByFunction map[string]int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		MaxAttemptsByFunction: map[string]int{
+			// Readings for the same car race on shared keys
+			"SubmitTelemetry": 5,
+		},
+	}
+}
+
+// ParseAttemptsByFunction parses a comma-separated list of
+// function=attempts pairs, e.g. SubmitTelemetry=8,RegisterVehicle=2, for
+// RetryPolicy.MaxAttemptsByFunction
+func ParseAttemptsByFunction(spec string) (map[string]int, error) {
+	attempts := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		funcName, value, found := strings.Cut(entry, "=")
+		if !found || funcName == "" {
+			return nil, fmt.Errorf("invalid attempts %q: want function=attempts", entry)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid attempts for %s: %q is not a positive number", funcName, value)
+		}
+		attempts[funcName] = n
+	}
+	return attempts, nil
+}
+
+func (p RetryPolicy) attemptsFor(funcName string) int {
+	attempts, ok := p.MaxAttemptsByFunction[funcName]
+	if !ok {
+		attempts = p.MaxAttempts
+	}
+	if attempts < 1 {
+		return 1
+	}
+	return attempts
+}
+
+// backoff returns the delay before the given retry (1-based), doubling the
+// base delay each time and adding jitter so concurrent writers spread out
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isRetryable reports whether a failed call can safely be repeated. Submits
+// are only retried when the transaction was never ordered, as when
+// endorsement failed, or was ordered but invalidated, as on an MVCC
+// conflict. Once the orderer may have it, which a failure sending it or
+// waiting for its commit status does not rule out, a new proposal could
+// commit the same reading twice.
+func isRetryable(err error, submit bool) bool {
+	if submit && MayBeOrdered(err) {
+		return false
+	}
+
+	switch ClassifyError(err).Code {
+	case ErrCodeMVCCConflict, ErrCodeUnavailable, ErrCodeTimeout:
+		return true
+	}
+	return false
+}
+
+// MayBeOrdered reports whether a failed submit may have reached the orderer,
+// so that its transaction can still commit. Sending the transaction or
+// waiting for its commit status failed, and neither rules that out.
+func MayBeOrdered(err error) bool {
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	return errors.As(err, &submitErr) || errors.As(err, &commitStatusErr)
+}
+
+// withRetry runs call until it succeeds, fails with a non-retryable error or
+// the attempts for funcName are used up
+func (c *Client) withRetry(ctx context.Context, funcName string, submit bool, call func() error) error {
+	maxAttempts := c.retryPolicy.attemptsFor(funcName)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = call(); err == nil {
+			return nil
+		}
+		code := ClassifyError(err).Code
+		metrics.CountError(funcName, code)
+		if code == ErrCodeUnavailable {
+			c.reportUnavailable()
+		}
+		if !isRetryable(err, submit) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			metrics.CountRetryExhausted(funcName)
+			slog.WarnContext(ctx, "giving up after retries", "function", funcName, "attempts", attempt, "code", code, "error", err)
+			return err
+		}
+
+		delay := c.retryPolicy.backoff(attempt)
+		metrics.CountRetry(funcName)
+		slog.InfoContext(ctx, "retrying transaction", "function", funcName, "attempt", attempt+1,
+			"maxAttempts", maxAttempts, "delayMs", delay.Milliseconds(), "code", code, "error", err)
+
+		select {
+		case <-c.ctx.Done():
+			return err
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
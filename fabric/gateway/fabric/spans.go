@@ -0,0 +1,38 @@
+package fabric
+
+import (
+	"context"
+
+	"fabric-gateway/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a client span for a call to the chaincode
+func (c *Client) startSpan(ctx context.Context, name, funcName string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("fabric.channel", c.channelName),
+			attribute.String("fabric.chaincode", c.chaincodeName),
+			attribute.String("fabric.function", funcName),
+		),
+	)
+}
+
+// recordSpanError marks the span as failed with the classified error code
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetAttributes(attribute.String("fabric.error_code", ClassifyError(err).Code))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func endSpan(span trace.Span, err error) {
+	recordSpanError(span, err)
+	span.End()
+}
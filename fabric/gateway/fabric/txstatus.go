@@ -0,0 +1,109 @@
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Transaction states reported by GET /api/tx/:txId
+const (
+	TxStatusPending   = "PENDING"
+	TxStatusCommitted = "COMMITTED"
+	TxStatusInvalid   = "INVALID"
+)
+
+var txStatusBucket = []byte("txstatus")
+
+// TxStatus is the gateway-side record of an asynchronously submitted transaction
+type TxStatus struct {
+	TxID           string    `json:"txId"`
+	Function       string    `json:"function"`
+	Status         string    `json:"status"`
+	ValidationCode string    `json:"validationCode,omitempty"`
+	BlockNumber    uint64    `json:"blockNumber,omitempty"`
+	SubmittedAt    time.Time `json:"submittedAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+
+	// Commit is the serialized commit status request, kept while the
+	// transaction is pending so the wait can be resumed after a restart.
+	Commit []byte `json:"commit,omitempty"`
+}
+
+// TxStatusStore persists transaction status in a local bbolt file
+type TxStatusStore struct {
+	db *bolt.DB
+}
+
+func OpenTxStatusStore(path string) (*TxStatusStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction status store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(txStatusBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise transaction status store: %w", err)
+	}
+
+	return &TxStatusStore{db: db}, nil
+}
+
+func (s *TxStatusStore) Put(status *TxStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(txStatusBucket).Put([]byte(status.TxID), data)
+	})
+}
+
+// Get returns the stored status, or nil if the transaction is unknown
+func (s *TxStatusStore) Get(txID string) (*TxStatus, error) {
+	var status *TxStatus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(txStatusBucket).Get([]byte(txID))
+		if data == nil {
+			return nil
+		}
+		status = &TxStatus{}
+		return json.Unmarshal(data, status)
+	})
+	return status, err
+}
+
+// Pending returns every transaction still waiting for its commit status
+func (s *TxStatusStore) Pending() ([]*TxStatus, error) {
+	var pending []*TxStatus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(txStatusBucket).ForEach(func(_, data []byte) error {
+			var status TxStatus
+			if err := json.Unmarshal(data, &status); err != nil {
+				return err
+			}
+			if status.Status == TxStatusPending {
+				pending = append(pending, &status)
+			}
+			return nil
+		})
+	})
+	return pending, err
+}
+
+func (s *TxStatusStore) Close() error {
+	return s.db.Close()
+}
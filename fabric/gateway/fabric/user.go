@@ -0,0 +1,37 @@
+package fabric
+
+import (
+	"context"
+
+	"fabric-gateway/tracing"
+)
+
+// UserTransientKey is the transient map entry naming the backend user a call
+// is made for. The chaincode checks that user's role on the vehicle before
+// telemetry is read or written, and that user-specific arguments, such as the
+// user accepting a transfer, name the same user.
+const UserTransientKey = "userId"
+
+type userKey struct{}
+
+// WithUser returns a context whose calls are made for a backend user
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns the backend user set by WithUser, or "" if calls
+// are made for the organization itself
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
+
+// Transient returns the transient map of a proposal made for ctx: the trace
+// context and the acting user. Neither is written to the ledger.
+func Transient(ctx context.Context) map[string][]byte {
+	transient := tracing.TransientContext(ctx)
+	if userID := UserFromContext(ctx); userID != "" {
+		transient[UserTransientKey] = []byte(userID)
+	}
+	return transient
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"slices"
 
 	"fabric-gateway/fabric"
 	"fabric-gateway/models"
@@ -11,42 +12,65 @@ import (
 )
 
 type AccessHandler struct {
-	fabricClient *fabric.Client
+	fabricClient fabric.Ledger
 }
 
-func NewAccessHandler(client *fabric.Client) *AccessHandler {
+func NewAccessHandler(client fabric.Ledger) *AccessHandler {
 	return &AccessHandler{fabricClient: client}
 }
 
+// accessResponse is the body of the access grant routes
+type accessResponse struct {
+	Success bool               `json:"success"`
+	Access  models.AccessGrant `json:"access"`
+}
+
+// accessGrantsResponse lists the grants made by every owner of a vehicle
+type accessGrantsResponse struct {
+	Success bool                 `json:"success"`
+	Grants  []models.AccessGrant `json:"grants"`
+}
+
 func (h *AccessHandler) GrantAccess(c *gin.Context) {
 	var req models.GrantAccessRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondBadRequest(c, "Invalid request: "+err.Error())
 		return
 	}
 
+	if req.InsuranceMSPID != "" {
+		orgs, err := h.fabricClient.ChannelOrganizations(c.Request.Context())
+		if err != nil {
+			respondError(c, "Failed to grant access", err)
+			return
+		}
+		if !slices.Contains(orgs, req.InsuranceMSPID) {
+			respondBadRequest(c, fmt.Sprintf("insuranceMspId %s is not an organization of the channel", req.InsuranceMSPID))
+			return
+		}
+	}
+
 	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
 		"GrantAccess",
 		req.OnChainID,
 		req.InsuranceCompanyID,
+		req.InsuranceMSPID,
 		fmt.Sprintf("%d", req.DurationDays),
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, "Failed to grant access", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Result:  result,
-	})
+	var grant models.AccessGrant
+	if err := decodeResult(result, &grant); err != nil {
+		respondError(c, "Failed to grant access", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accessResponse{Success: true, Access: grant})
 }
 
 func (h *AccessHandler) ReadAccess(c *gin.Context) {
@@ -54,21 +78,47 @@ func (h *AccessHandler) ReadAccess(c *gin.Context) {
 	companyID := c.Param("companyId")
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"ReadAccess",
 		onChainID,
 		companyID,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, "Failed to read access", err)
+		return
+	}
+
+	var grant models.AccessGrant
+	if err := decodeResult(result, &grant); err != nil {
+		respondError(c, "Failed to read access", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accessResponse{Success: true, Access: grant})
+}
+
+// RevokeAccess handles DELETE /api/vehicles/:onChainId/access/:companyId
+// The company's organization, if the grant names one, endorses the
+// revocation along with the owner's.
+func (h *AccessHandler) RevokeAccess(c *gin.Context) {
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"RevokeAccess",
+		c.Param("onChainId"),
+		c.Param("companyId"),
+	)
+
+	if err != nil {
+		respondError(c, "Failed to revoke access", err)
+		return
+	}
+
+	var grant models.AccessGrant
+	if err := decodeResult(result, &grant); err != nil {
+		respondError(c, "Failed to revoke access", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"access":  result,
-	})
+	c.JSON(http.StatusOK, accessResponse{Success: true, Access: grant})
 }
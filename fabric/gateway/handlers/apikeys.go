@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fabric-gateway/auth"
+	"fabric-gateway/fabric"
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	store *auth.KeyStore
+}
+
+func NewAPIKeyHandler(store *auth.KeyStore) *APIKeyHandler {
+	return &APIKeyHandler{store: store}
+}
+
+// apiKeyResponse returns a key's metadata and, after creation or rotation,
+// the plaintext key. The plaintext cannot be retrieved again.
+type apiKeyResponse struct {
+	Success bool         `json:"success"`
+	Key     string       `json:"key,omitempty"`
+	APIKey  *auth.APIKey `json:"apiKey"`
+}
+
+type apiKeyListResponse struct {
+	Success bool           `json:"success"`
+	APIKeys []*auth.APIKey `json:"apiKeys"`
+}
+
+// CreateKey handles POST /admin/keys
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	key, plaintext, err := h.store.Create(req.Name,
+		auth.Scope{Routes: req.Routes, Vehicles: req.Vehicles, Users: req.Users},
+		auth.Limits{RatePerSecond: req.RatePerSecond, Burst: req.Burst, DailyQuota: req.DailyQuota},
+	)
+	if err != nil {
+		respondKeyError(c, "Failed to create API key", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, apiKeyResponse{Success: true, Key: plaintext, APIKey: key})
+}
+
+// ListKeys handles GET /admin/keys
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.store.List()
+	if err != nil {
+		respondKeyError(c, "Failed to list API keys", err)
+		return
+	}
+	if keys == nil {
+		keys = []*auth.APIKey{}
+	}
+
+	c.JSON(http.StatusOK, apiKeyListResponse{Success: true, APIKeys: keys})
+}
+
+// GetKey handles GET /admin/keys/:keyId
+func (h *APIKeyHandler) GetKey(c *gin.Context) {
+	key, err := h.store.Get(c.Param("keyId"))
+	if err == nil && key == nil {
+		err = auth.ErrKeyNotFound
+	}
+	if err != nil {
+		respondKeyError(c, "Failed to get API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponse{Success: true, APIKey: key})
+}
+
+// RotateKey handles POST /admin/keys/:keyId/rotate?gracePeriod=1h
+// The previous key keeps working for the grace period, 0 by default.
+func (h *APIKeyHandler) RotateKey(c *gin.Context) {
+	var grace time.Duration
+	if value := c.Query("gracePeriod"); value != "" {
+		var err error
+		if grace, err = time.ParseDuration(value); err != nil || grace < 0 {
+			respondBadRequest(c, "Invalid gracePeriod")
+			return
+		}
+	}
+
+	key, plaintext, err := h.store.Rotate(c.Param("keyId"), grace)
+	if err != nil {
+		respondKeyError(c, "Failed to rotate API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponse{Success: true, Key: plaintext, APIKey: key})
+}
+
+// RevokeKey handles DELETE /admin/keys/:keyId
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	key, err := h.store.Revoke(c.Param("keyId"))
+	if err != nil {
+		respondKeyError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponse{Success: true, APIKey: key})
+}
+
+func respondKeyError(c *gin.Context, message string, err error) {
+	status, code := http.StatusInternalServerError, fabric.ErrCodeInternal
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		status, code = http.StatusNotFound, fabric.ErrCodeNotFound
+	case errors.Is(err, auth.ErrRevokedKey):
+		status, code = http.StatusConflict, auth.ErrCodeKeyRevoked
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   message + ": " + err.Error(),
+		Code:    code,
+	})
+}
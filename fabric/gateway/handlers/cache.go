@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strings"
+
+	"fabric-gateway/fabric"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControl lets clients skip the evaluate cache. "Cache-Control:
+// no-cache" (or max-age=0, or "Pragma: no-cache") reads from the ledger and
+// refreshes the cache; "no-store" reads from the ledger without caching.
+func CacheControl() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := fabric.CacheDefault
+		for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-store":
+				mode = fabric.CacheBypass
+			case "no-cache", "max-age=0":
+				if mode == fabric.CacheDefault {
+					mode = fabric.CacheRefresh
+				}
+			}
+		}
+		if mode == fabric.CacheDefault && strings.EqualFold(c.GetHeader("Pragma"), "no-cache") {
+			mode = fabric.CacheRefresh
+		}
+
+		if mode != fabric.CacheDefault {
+			c.Request = c.Request.WithContext(fabric.WithCacheMode(c.Request.Context(), mode))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"fabric-gateway/fabric"
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCodeInvalidRequest is returned when the request fails validation
+// before reaching Fabric
+const ErrCodeInvalidRequest = "INVALID_REQUEST"
+
+// respondError translates a Fabric error into the shared error envelope
+func respondError(c *gin.Context, message string, err error) {
+	fabricErr := fabric.ClassifyError(err)
+
+	response := models.ErrorResponse{
+		Success: false,
+		Error:   message + ": " + fabricErr.Message,
+		Code:    fabricErr.Code,
+		TxID:    fabricErr.TxID,
+	}
+	for _, detail := range fabricErr.Details {
+		response.Details = append(response.Details, models.ErrorDetail{
+			Address: detail.Address,
+			MSPID:   detail.MSPID,
+			Message: detail.Message,
+		})
+	}
+
+	if fabricErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(fabricErr.RetryAfter.Seconds()))))
+	}
+
+	c.JSON(fabricErr.HTTPStatus, response)
+}
+
+// respondBadRequest reports a request rejected by the gateway itself
+func respondBadRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    ErrCodeInvalidRequest,
+	})
+}
+
+// ErrCodeInvalidResult is returned when the chaincode answers with data the
+// gateway cannot decode
+const ErrCodeInvalidResult = "INVALID_CHAINCODE_RESULT"
+
+// decodeResult unmarshals a chaincode result into v. contractapi returns an
+// empty payload for nil slices and pointers, which leaves v untouched.
+func decodeResult(result string, v any) error {
+	if result == "" {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(result), v); err != nil {
+		return &fabric.Error{
+			Code:       ErrCodeInvalidResult,
+			HTTPStatus: http.StatusBadGateway,
+			Message:    "failed to decode chaincode result: " + err.Error(),
+			Err:        err,
+		}
+	}
+	return nil
+}
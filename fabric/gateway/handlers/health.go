@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"fabric-gateway/fabric"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the ledger queries made by the readiness check
+const readinessTimeout = 5 * time.Second
+
+type HealthHandler struct {
+	fabricClient fabric.Ledger
+}
+
+func NewHealthHandler(client fabric.Ledger) *HealthHandler {
+	return &HealthHandler{fabricClient: client}
+}
+
+// Live handles GET /health/live and only reports that the process is up
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready handles GET /health/ready and returns 503 unless the peer is
+// reachable and the chaincode answers
+func (h *HealthHandler) Ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	readiness := h.fabricClient.CheckReadiness(ctx)
+
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
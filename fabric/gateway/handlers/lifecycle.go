@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"fabric-gateway/auth"
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StolenVehicle is a stolen vehicle with its newest reading, which carries
+// its last known location
+type StolenVehicle struct {
+	OnChainID     string            `json:"onChainId"`
+	VIN           string            `json:"vin"`
+	OwnerMSPID    string            `json:"ownerMspId"`
+	ReportedAt    time.Time         `json:"reportedAt"`
+	ReportedBy    string            `json:"reportedBy"`
+	LatestReading *VehicleTelemetry `json:"latestReading,omitempty"`
+}
+
+// stolenVehicleResponse is the body of GET /api/vehicles/:onChainId/location
+type stolenVehicleResponse struct {
+	Success bool          `json:"success"`
+	Vehicle StolenVehicle `json:"vehicle"`
+}
+
+// stolenVehiclesResponse is the body of GET /api/vehicles/stolen
+type stolenVehiclesResponse struct {
+	Success  bool            `json:"success"`
+	Vehicles []StolenVehicle `json:"vehicles"`
+}
+
+// SetVehicleStatus handles PUT /api/vehicles/:onChainId/status
+func (h *VehicleHandler) SetVehicleStatus(c *gin.Context) {
+	var req models.VehicleStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(c.Request.Context(), "SetVehicleStatus", c.Param("onChainId"), req.Status)
+	if err != nil {
+		respondError(c, "Failed to change vehicle status", err)
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := decodeResult(result, &vehicle); err != nil {
+		respondError(c, "Failed to change vehicle status", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicleResponse{Success: true, Vehicle: vehicle})
+}
+
+// GetStolenVehicleLocation handles GET /api/vehicles/:onChainId/location
+func (h *VehicleHandler) GetStolenVehicleLocation(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetStolenVehicleLocation", c.Param("onChainId"))
+	if err != nil {
+		respondError(c, "Failed to locate vehicle", err)
+		return
+	}
+
+	var vehicle StolenVehicle
+	if err := decodeResult(result, &vehicle); err != nil {
+		respondError(c, "Failed to locate vehicle", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stolenVehicleResponse{Success: true, Vehicle: vehicle})
+}
+
+// GetStolenVehicles handles GET /api/vehicles/stolen
+func (h *VehicleHandler) GetStolenVehicles(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetStolenVehicles")
+	if err != nil {
+		respondError(c, "Failed to get stolen vehicles", err)
+		return
+	}
+
+	vehicles := []StolenVehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get stolen vehicles", err)
+		return
+	}
+	vehicles = slices.DeleteFunc(vehicles, func(vehicle StolenVehicle) bool {
+		return !auth.VisibleVehicle(c, vehicle.OnChainID)
+	})
+
+	c.JSON(http.StatusOK, stolenVehiclesResponse{Success: true, Vehicles: vehicles})
+}
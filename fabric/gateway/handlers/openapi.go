@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"net/http"
+
+	"fabric-gateway/auth"
+	"fabric-gateway/fabric"
+	"fabric-gateway/models"
+	"fabric-gateway/openapi"
+)
+
+// transactionStatusResponse is the body of GET /api/tx/:txId
+type transactionStatusResponse struct {
+	Success     bool            `json:"success"`
+	Transaction fabric.TxStatus `json:"transaction"`
+}
+
+// liveResponse is the body of the liveness endpoints
+type liveResponse struct {
+	Status string `json:"status"`
+}
+
+// DescribeRoutes documents the routed handlers. Paths use gin syntax and must
+// match the routes registered in main.
+func DescribeRoutes(spec *openapi.Spec) {
+	spec.APIKeyScheme("apiKey", auth.APIKeyHeader, "Client key; Authorization: Bearer <key> is also accepted")
+	spec.APIKeyScheme("adminKey", auth.APIKeyHeader, "Admin key (ADMIN_API_KEY) for key management")
+
+	spec.Describe(http.MethodGet, "/health", openapi.Operation{
+		ID:        "health",
+		Summary:   "Liveness probe (alias of /health/live)",
+		Tags:      []string{"health"},
+		Responses: map[int]any{http.StatusOK: liveResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/health/live", openapi.Operation{
+		ID:        "live",
+		Summary:   "Report that the process is up",
+		Tags:      []string{"health"},
+		Responses: map[int]any{http.StatusOK: liveResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/health/ready", openapi.Operation{
+		ID:      "ready",
+		Summary: "Check the peer connection, chaincode and event listener",
+		Tags:    []string{"health"},
+		Responses: map[int]any{
+			http.StatusOK:                 fabric.Readiness{},
+			http.StatusServiceUnavailable: fabric.Readiness{},
+		},
+	})
+
+	spec.Describe(http.MethodPost, "/api/telemetry/submit", openapi.Operation{
+		ID:       "submitTelemetry",
+		Summary:  "Submit a telemetry record for a registered vehicle that is not scrapped; ?async=true or Prefer: respond-async returns once ordered",
+		Tags:     []string{"telemetry"},
+		Security: "apiKey",
+		Query: []openapi.Parameter{
+			{Name: "async", Type: "boolean", Description: "Return 202 without waiting for the commit"},
+		},
+		Request: SubmitTelemetryRequest{},
+		Responses: map[int]any{
+			http.StatusOK:       TelemetryResponse{},
+			http.StatusAccepted: TelemetryResponse{},
+		},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/vehicle/:carId", openapi.Operation{
+		ID:        "getTelemetryByVehicle",
+		Summary:   "List the telemetry recorded for a vehicle",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/vehicle/:carId/latest", openapi.Operation{
+		ID:        "getLatestTelemetry",
+		Summary:   "Read a vehicle's newest telemetry record",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/vehicle/:carId/:timestamp", openapi.Operation{
+		ID:        "readTelemetry",
+		Summary:   "Read one telemetry record by vehicle and Unix time in nanoseconds",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/vehicle/:carId/:timestamp/history", openapi.Operation{
+		ID:        "getTelemetryHistory",
+		Summary:   "List the ledger changes of a telemetry record, newest first",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: []TelemetryHistoryEntry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/key/:key", openapi.Operation{
+		ID:        "readTelemetryByKey",
+		Summary:   "Read one telemetry record by the key returned with it",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/key/:key/history", openapi.Operation{
+		ID:        "getTelemetryHistoryByKey",
+		Summary:   "List the ledger changes of the telemetry record with a returned key",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: []TelemetryHistoryEntry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/all", openapi.Operation{
+		ID:        "getAllTelemetry",
+		Summary:   "List all telemetry records",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/latest", openapi.Operation{
+		ID:       "getLatestTelemetryForVehicles",
+		Summary:  "List the newest telemetry record of each vehicle",
+		Tags:     []string{"telemetry"},
+		Security: "apiKey",
+		Query: []openapi.Parameter{
+			{Name: "carIds", Description: "Comma-separated vehicle IDs; all vehicles if omitted"},
+		},
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/after", openapi.Operation{
+		ID:       "getTelemetryAfter",
+		Summary:  "List telemetry inserted after a timestamp",
+		Tags:     []string{"telemetry"},
+		Security: "apiKey",
+		Query: []openapi.Parameter{
+			{Name: "timestamp", Required: true, Format: "date-time", Description: "RFC 3339 timestamp"},
+		},
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodGet, "/api/telemetry/range", openapi.Operation{
+		ID:       "getTelemetryByRange",
+		Summary:  "List a vehicle's telemetry between two timestamps, inclusive",
+		Tags:     []string{"telemetry"},
+		Security: "apiKey",
+		Query: []openapi.Parameter{
+			{Name: "carId", Required: true},
+			{Name: "startTime", Format: "date-time", Description: "RFC 3339 timestamp"},
+			{Name: "endTime", Format: "date-time", Description: "RFC 3339 timestamp"},
+		},
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodPost, "/api/telemetry/query", openapi.Operation{
+		ID:        "queryTelemetry",
+		Summary:   "Query telemetry with a filter on indexed fields, one page at a time",
+		Tags:      []string{"telemetry"},
+		Security:  "apiKey",
+		Request:   TelemetryQueryRequest{},
+		Responses: map[int]any{http.StatusOK: TelemetryPage{}},
+	})
+
+	spec.Describe(http.MethodPost, "/api/vehicles", openapi.Operation{
+		ID:        "registerVehicle",
+		Summary:   "Register a vehicle owned by a user of the gateway's organization",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Request:   models.RegisterVehicleRequest{},
+		Responses: map[int]any{http.StatusCreated: vehicleResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/stolen", openapi.Operation{
+		ID:        "getStolenVehicles",
+		Summary:   "List the stolen vehicles this organization may locate, with their newest reading",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: stolenVehiclesResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId", openapi.Operation{
+		ID:        "readVehicle",
+		Summary:   "Read a vehicle, its current owner and lifecycle status",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: vehicleResponse{}},
+	})
+	spec.Describe(http.MethodPut, "/api/vehicles/:onChainId/status", openapi.Operation{
+		ID:        "setVehicleStatus",
+		Summary:   "Activate or scrap a vehicle as its owner's organization, report it stolen or recovered as the police, or write off a stolen vehicle as either",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Request:   models.VehicleStatusRequest{},
+		Responses: map[int]any{http.StatusOK: vehicleResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/location", openapi.Operation{
+		ID:        "getStolenVehicleLocation",
+		Summary:   "Read the newest reading of a stolen vehicle, for the police, its owner's organization and its insurers",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: stolenVehicleResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/owners", openapi.Operation{
+		ID:        "getOwnershipHistory",
+		Summary:   "List a vehicle's ownership chain, oldest first",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: ownersResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/owners/:sequence/telemetry", openapi.Operation{
+		ID:        "getTelemetryForOwnership",
+		Summary:   "List the telemetry recorded during one ownership period",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: []VehicleTelemetry{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/transfer", openapi.Operation{
+		ID:        "proposeTransfer",
+		Summary:   "Offer a vehicle to a new owner, who must accept it",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Request:   models.ProposeTransferRequest{},
+		Responses: map[int]any{http.StatusCreated: transferResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/transfer", openapi.Operation{
+		ID:        "getPendingTransfer",
+		Summary:   "Read a vehicle's pending transfer",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: transferResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/transfer/accept", openapi.Operation{
+		ID:        "acceptTransfer",
+		Summary:   "Take over a vehicle as the proposed new owner",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Request:   models.UserActionRequest{},
+		Responses: map[int]any{http.StatusOK: ownershipResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/transfer/cancel", openapi.Operation{
+		ID:        "cancelTransfer",
+		Summary:   "Withdraw a pending transfer as the owner or decline it as the new owner",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Request:   models.UserActionRequest{},
+		Responses: map[int]any{http.StatusOK: models.Response{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/endorsement", openapi.Operation{
+		ID:        "getEndorsingOrganizations",
+		Summary:   "List the organizations that must endorse writes to a vehicle",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: endorsementResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/endorsement/refresh", openapi.Operation{
+		ID:        "refreshEndorsement",
+		Summary:   "Drop the organizations of expired access grants from a vehicle's endorsement policy",
+		Tags:      []string{"vehicles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: endorsementResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/roles", openapi.Operation{
+		ID:        "getVehicleRoles",
+		Summary:   "List everyone with a role on a vehicle, the registered owner first",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: rolesResponse{}},
+	})
+	spec.Describe(http.MethodPut, "/api/vehicles/:onChainId/roles/:userId", openapi.Operation{
+		ID:        "assignRole",
+		Summary:   "Give a user a role on a vehicle or change it, as an owner",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Request:   models.AssignRoleRequest{},
+		Responses: map[int]any{http.StatusOK: roleResponse{}},
+	})
+	spec.Describe(http.MethodDelete, "/api/vehicles/:onChainId/roles/:userId", openapi.Operation{
+		ID:       "revokeRole",
+		Summary:  "Remove a user's role on a vehicle, as an owner",
+		Tags:     []string{"roles"},
+		Security: "apiKey",
+		Query: []openapi.Parameter{
+			{Name: "ownerUserId", Required: true, Description: "Owner making the change"},
+		},
+		Responses: map[int]any{http.StatusOK: models.Response{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/invitations", openapi.Operation{
+		ID:        "inviteUser",
+		Summary:   "Invite a user to a role on a vehicle, as an owner",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Request:   models.InviteUserRequest{},
+		Responses: map[int]any{http.StatusCreated: invitationResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/invitations", openapi.Operation{
+		ID:        "getInvitations",
+		Summary:   "List the invitations made for a vehicle",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: invitationsResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/invitations/:inviteId/accept", openapi.Operation{
+		ID:        "acceptInvitation",
+		Summary:   "Take the offered role as the invited user",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Request:   models.UserActionRequest{},
+		Responses: map[int]any{http.StatusOK: roleResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/invitations/:inviteId/decline", openapi.Operation{
+		ID:        "declineInvitation",
+		Summary:   "Turn down an invitation as the invited user",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Request:   models.UserActionRequest{},
+		Responses: map[int]any{http.StatusOK: invitationResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/vehicles/:onChainId/invitations/:inviteId/cancel", openapi.Operation{
+		ID:        "cancelInvitation",
+		Summary:   "Withdraw a pending invitation as an owner",
+		Tags:      []string{"roles"},
+		Security:  "apiKey",
+		Request:   models.UserActionRequest{},
+		Responses: map[int]any{http.StatusOK: invitationResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/api/access", openapi.Operation{
+		ID:        "grantAccess",
+		Summary:   "Give an insurance company access to a vehicle until its next transfer at the latest",
+		Tags:      []string{"access"},
+		Security:  "apiKey",
+		Request:   models.GrantAccessRequest{},
+		Responses: map[int]any{http.StatusOK: accessResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/access", openapi.Operation{
+		ID:        "getAccessGrantsByVehicle",
+		Summary:   "List the access grants made by every owner of a vehicle",
+		Tags:      []string{"access"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: accessGrantsResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/api/vehicles/:onChainId/access/:companyId", openapi.Operation{
+		ID:        "readAccess",
+		Summary:   "Read the current owner's grant to an insurance company",
+		Tags:      []string{"access"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: accessResponse{}},
+	})
+	spec.Describe(http.MethodDelete, "/api/vehicles/:onChainId/access/:companyId", openapi.Operation{
+		ID:        "revokeAccess",
+		Summary:   "End the current owner's grant to an insurance company now",
+		Tags:      []string{"access"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: accessResponse{}},
+	})
+
+	spec.Describe(http.MethodGet, "/api/tx/:txId", openapi.Operation{
+		ID:        "getTransactionStatus",
+		Summary:   "Report the commit status of a submitted transaction",
+		Tags:      []string{"transactions"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: transactionStatusResponse{}},
+	})
+
+	spec.Describe(http.MethodPost, "/admin/migrations/telemetry-keys", openapi.Operation{
+		ID:       "migrateTelemetryKeys",
+		Summary:  "Re-key one batch of telemetry records into day buckets; repeat until done",
+		Tags:     []string{"admin"},
+		Security: "adminKey",
+		Query: []openapi.Parameter{
+			{Name: "batchSize", Type: "integer", Description: "Records per transaction, 500 by default"},
+		},
+		Responses: map[int]any{http.StatusOK: KeyMigrationResult{}},
+	})
+	spec.Describe(http.MethodPost, "/admin/keys", openapi.Operation{
+		ID:        "createAPIKey",
+		Summary:   "Create a client API key; the key is only returned once",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Request:   models.CreateAPIKeyRequest{},
+		Responses: map[int]any{http.StatusCreated: apiKeyResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/admin/keys", openapi.Operation{
+		ID:        "listAPIKeys",
+		Summary:   "List client API keys",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: apiKeyListResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/admin/keys/:keyId", openapi.Operation{
+		ID:        "getAPIKey",
+		Summary:   "Get a client API key",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: apiKeyResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/admin/keys/:keyId/rotate", openapi.Operation{
+		ID:       "rotateAPIKey",
+		Summary:  "Issue a new secret for a key",
+		Tags:     []string{"admin"},
+		Security: "adminKey",
+		Query: []openapi.Parameter{
+			{Name: "gracePeriod", Description: "How long the previous key stays valid, e.g. 1h"},
+		},
+		Responses: map[int]any{http.StatusOK: apiKeyResponse{}},
+	})
+	spec.Describe(http.MethodDelete, "/admin/keys/:keyId", openapi.Operation{
+		ID:        "revokeAPIKey",
+		Summary:   "Revoke a client API key",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: apiKeyResponse{}},
+	})
+}
+
+// DescribeOutboxRoutes documents the routes added when the outbox is enabled
+func DescribeOutboxRoutes(spec *openapi.Spec) {
+	spec.Describe(http.MethodGet, "/api/outbox/:itemId", openapi.Operation{
+		ID:        "getOutboxItem",
+		Summary:   "Report the delivery status of a queued reading",
+		Tags:      []string{"outbox"},
+		Security:  "apiKey",
+		Responses: map[int]any{http.StatusOK: outboxItemResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/admin/outbox", openapi.Operation{
+		ID:        "getOutboxStats",
+		Summary:   "Report outbox depth and dead letters",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: outboxStatsResponse{}},
+	})
+	spec.Describe(http.MethodGet, "/admin/outbox/dead-letters", openapi.Operation{
+		ID:        "listDeadLetters",
+		Summary:   "List readings that could not be submitted",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: deadLettersResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/admin/outbox/dead-letters/:itemId/replay", openapi.Operation{
+		ID:        "replayDeadLetter",
+		Summary:   "Queue a dead-lettered reading again",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: outboxItemResponse{}},
+	})
+	spec.Describe(http.MethodDelete, "/admin/outbox/dead-letters/:itemId", openapi.Operation{
+		ID:       "discardDeadLetter",
+		Summary:  "Delete a dead-lettered reading",
+		Tags:     []string{"admin"},
+		Security: "adminKey",
+	})
+	spec.Describe(http.MethodGet, "/admin/outbox/unknown", openapi.Operation{
+		ID:        "listUnknownOutboxItems",
+		Summary:   "List readings that may or may not have been committed",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Responses: map[int]any{http.StatusOK: unknownItemsResponse{}},
+	})
+	spec.Describe(http.MethodPost, "/admin/outbox/unknown/:itemId/resolve", openapi.Operation{
+		ID:        "resolveUnknownOutboxItem",
+		Summary:   "Mark a reading in doubt delivered or queue it again",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Request:   ResolveItemRequest{},
+		Responses: map[int]any{http.StatusOK: outboxItemResponse{}},
+	})
+}
+
+// DescribeQueryPlanRoutes documents the routes added when COUCHDB_URL is set
+func DescribeQueryPlanRoutes(spec *openapi.Spec) {
+	spec.Describe(http.MethodPost, "/admin/telemetry/explain", openapi.Operation{
+		ID:        "explainTelemetryQuery",
+		Summary:   "Show the CouchDB index a telemetry query would use",
+		Tags:      []string{"admin"},
+		Security:  "adminKey",
+		Request:   TelemetryQueryRequest{},
+		Responses: map[int]any{http.StatusOK: QueryPlan{}},
+	})
+}
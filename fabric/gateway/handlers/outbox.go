@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"fabric-gateway/auth"
+	"fabric-gateway/fabric"
+	"fabric-gateway/models"
+	"fabric-gateway/outbox"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OutboxHandler struct {
+	outbox *outbox.Outbox
+}
+
+func NewOutboxHandler(ob *outbox.Outbox) *OutboxHandler {
+	return &OutboxHandler{outbox: ob}
+}
+
+type outboxItemResponse struct {
+	Success bool         `json:"success"`
+	Item    *outbox.Item `json:"item"`
+}
+
+type outboxStatsResponse struct {
+	Success bool         `json:"success"`
+	Outbox  outbox.Stats `json:"outbox"`
+}
+
+type deadLettersResponse struct {
+	Success     bool           `json:"success"`
+	DeadLetters []*outbox.Item `json:"deadLetters"`
+}
+
+type unknownItemsResponse struct {
+	Success bool           `json:"success"`
+	Unknown []*outbox.Item `json:"unknown"`
+}
+
+// ResolveItemRequest reports what the ledger shows for an item in doubt
+type ResolveItemRequest struct {
+	Committed *bool `json:"committed" binding:"required"`
+	// TxID is the transaction that committed the reading, for items that
+	// have none recorded
+	TxID string `json:"txId"`
+}
+
+// GetItem handles GET /api/outbox/:itemId
+// Once delivered the item carries the txId of the committed transaction.
+func (h *OutboxHandler) GetItem(c *gin.Context) {
+	item, err := h.outbox.Get(c.Param("itemId"))
+	if err == nil && item == nil {
+		err = outbox.ErrItemNotFound
+	}
+	if err != nil {
+		respondOutboxError(c, "Failed to get outbox item", err)
+		return
+	}
+	if !auth.AuthorizeVehicle(c, item.CarID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, outboxItemResponse{Success: true, Item: item})
+}
+
+// Stats handles GET /admin/outbox
+func (h *OutboxHandler) Stats(c *gin.Context) {
+	stats, err := h.outbox.Stats()
+	if err != nil {
+		respondOutboxError(c, "Failed to read outbox", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, outboxStatsResponse{Success: true, Outbox: stats})
+}
+
+// DeadLetters handles GET /admin/outbox/dead-letters
+func (h *OutboxHandler) DeadLetters(c *gin.Context) {
+	items, err := h.outbox.DeadLetters()
+	if err != nil {
+		respondOutboxError(c, "Failed to list dead letters", err)
+		return
+	}
+	if items == nil {
+		items = []*outbox.Item{}
+	}
+
+	c.JSON(http.StatusOK, deadLettersResponse{Success: true, DeadLetters: items})
+}
+
+// Replay handles POST /admin/outbox/dead-letters/:itemId/replay
+func (h *OutboxHandler) Replay(c *gin.Context) {
+	item, err := h.outbox.Replay(c.Param("itemId"))
+	if err != nil {
+		respondOutboxError(c, "Failed to replay outbox item", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, outboxItemResponse{Success: true, Item: item})
+}
+
+// Discard handles DELETE /admin/outbox/dead-letters/:itemId
+func (h *OutboxHandler) Discard(c *gin.Context) {
+	if err := h.outbox.Discard(c.Param("itemId")); err != nil {
+		respondOutboxError(c, "Failed to discard outbox item", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Unknown handles GET /admin/outbox/unknown
+// These readings may have reached the orderer; check their txId on the
+// ledger before resolving them.
+func (h *OutboxHandler) Unknown(c *gin.Context) {
+	items, err := h.outbox.Unknown()
+	if err != nil {
+		respondOutboxError(c, "Failed to list outbox items in doubt", err)
+		return
+	}
+	if items == nil {
+		items = []*outbox.Item{}
+	}
+
+	c.JSON(http.StatusOK, unknownItemsResponse{Success: true, Unknown: items})
+}
+
+// Resolve handles POST /admin/outbox/unknown/:itemId/resolve
+func (h *OutboxHandler) Resolve(c *gin.Context) {
+	var req ResolveItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	item, err := h.outbox.Resolve(c.Param("itemId"), *req.Committed, req.TxID)
+	if errors.Is(err, outbox.ErrNoTxID) {
+		respondBadRequest(c, err.Error())
+		return
+	}
+	if err != nil {
+		respondOutboxError(c, "Failed to resolve outbox item", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, outboxItemResponse{Success: true, Item: item})
+}
+
+func respondOutboxError(c *gin.Context, message string, err error) {
+	status, code := http.StatusInternalServerError, fabric.ErrCodeInternal
+	if errors.Is(err, outbox.ErrItemNotFound) {
+		status, code = http.StatusNotFound, fabric.ErrCodeNotFound
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   message + ": " + err.Error(),
+		Code:    code,
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transferResponse is the body of the pending transfer routes
+type transferResponse struct {
+	Success  bool                    `json:"success"`
+	Transfer models.TransferProposal `json:"transfer"`
+}
+
+// ownershipResponse is the body of POST .../transfer/accept
+type ownershipResponse struct {
+	Success   bool             `json:"success"`
+	Ownership models.Ownership `json:"ownership"`
+}
+
+// ownersResponse is the ownership chain of a vehicle, oldest first
+type ownersResponse struct {
+	Success bool               `json:"success"`
+	Owners  []models.Ownership `json:"owners"`
+}
+
+// ProposeTransfer handles POST /api/vehicles/:onChainId/transfer
+func (h *VehicleHandler) ProposeTransfer(c *gin.Context) {
+	onChainID := c.Param("onChainId")
+
+	var req models.ProposeTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"ProposeTransfer",
+		onChainID,
+		req.OwnerUserID,
+		req.NewOwnerUserID,
+		req.NewOwnerMSPID,
+	)
+	if err != nil {
+		respondError(c, "Failed to propose transfer", err)
+		return
+	}
+
+	var proposal models.TransferProposal
+	if err := decodeResult(result, &proposal); err != nil {
+		respondError(c, "Failed to propose transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, transferResponse{Success: true, Transfer: proposal})
+}
+
+// GetPendingTransfer handles GET /api/vehicles/:onChainId/transfer
+func (h *VehicleHandler) GetPendingTransfer(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
+		"GetPendingTransfer",
+		c.Param("onChainId"),
+	)
+	if err != nil {
+		respondError(c, "Failed to read transfer", err)
+		return
+	}
+
+	var proposal models.TransferProposal
+	if err := decodeResult(result, &proposal); err != nil {
+		respondError(c, "Failed to read transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transferResponse{Success: true, Transfer: proposal})
+}
+
+// AcceptTransfer handles POST /api/vehicles/:onChainId/transfer/accept
+func (h *VehicleHandler) AcceptTransfer(c *gin.Context) {
+	onChainID := c.Param("onChainId")
+
+	var req models.UserActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(c.Request.Context(), "AcceptTransfer", onChainID, req.UserID)
+	if err != nil {
+		respondError(c, "Failed to accept transfer", err)
+		return
+	}
+
+	var ownership models.Ownership
+	if err := decodeResult(result, &ownership); err != nil {
+		respondError(c, "Failed to accept transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ownershipResponse{Success: true, Ownership: ownership})
+}
+
+// CancelTransfer handles POST /api/vehicles/:onChainId/transfer/cancel,
+// which the new owner also uses to decline
+func (h *VehicleHandler) CancelTransfer(c *gin.Context) {
+	onChainID := c.Param("onChainId")
+
+	var req models.UserActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	if _, err := h.fabricClient.SubmitTransaction(c.Request.Context(), "CancelTransfer", onChainID, req.UserID); err != nil {
+		respondError(c, "Failed to cancel transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Success: true})
+}
+
+// GetOwnershipHistory handles GET /api/vehicles/:onChainId/owners
+func (h *VehicleHandler) GetOwnershipHistory(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
+		"GetOwnershipHistory",
+		c.Param("onChainId"),
+	)
+	if err != nil {
+		respondError(c, "Failed to get ownership history", err)
+		return
+	}
+
+	owners := []models.Ownership{}
+	if err := decodeResult(result, &owners); err != nil {
+		respondError(c, "Failed to get ownership history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ownersResponse{Success: true, Owners: owners})
+}
+
+// GetTelemetryForOwnership handles
+// GET /api/vehicles/:onChainId/owners/:sequence/telemetry
+func (h *VehicleHandler) GetTelemetryForOwnership(c *gin.Context) {
+	sequence := c.Param("sequence")
+	if n, err := strconv.Atoi(sequence); err != nil || n < 1 {
+		respondBadRequest(c, "sequence must be a positive integer")
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
+		"GetTelemetryForOwnership",
+		c.Param("onChainId"),
+		sequence,
+	)
+	if err != nil {
+		respondError(c, "Failed to get telemetry", err)
+		return
+	}
+
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get telemetry", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
@@ -5,32 +5,36 @@ import (
 	"strconv"
 
 	"fabric-gateway/fabric"
+	"fabric-gateway/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 type QueryHandler struct {
-	fabricClient *fabric.Client
+	fabricClient fabric.Ledger
 }
 
-func NewQueryHandler(client *fabric.Client) *QueryHandler {
+func NewQueryHandler(client fabric.Ledger) *QueryHandler {
 	return &QueryHandler{fabricClient: client}
 }
 
 // GetAllVehicles returns all vehicles
 func (h *QueryHandler) GetAllVehicles(c *gin.Context) {
-	result, err := h.fabricClient.EvaluateTransaction("GetAllVehicles")
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetAllVehicles")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicles", err)
+		return
+	}
+
+	vehicles := []models.Vehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"vehicles": result,
+		"vehicles": vehicles,
 	})
 }
 
@@ -39,25 +43,25 @@ func (h *QueryHandler) GetVehiclesByOwner(c *gin.Context) {
 	ownerUserID := c.Param("ownerUserId")
 
 	if ownerUserID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "ownerUserId is required",
-		})
+		respondBadRequest(c, "ownerUserId is required")
 		return
 	}
 
-	result, err := h.fabricClient.EvaluateTransaction("GetVehiclesByOwner", ownerUserID)
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetVehiclesByOwner", ownerUserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicles", err)
+		return
+	}
+
+	vehicles := []models.Vehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"vehicles": result,
+		"vehicles": vehicles,
 	})
 }
 
@@ -66,25 +70,25 @@ func (h *QueryHandler) GetVehiclesByVINPrefix(c *gin.Context) {
 	vinPrefix := c.Query("prefix")
 
 	if vinPrefix == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "prefix query parameter is required",
-		})
+		respondBadRequest(c, "prefix query parameter is required")
 		return
 	}
 
-	result, err := h.fabricClient.EvaluateTransaction("GetVehiclesByVINPrefix", vinPrefix)
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetVehiclesByVINPrefix", vinPrefix)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicles", err)
+		return
+	}
+
+	vehicles := []models.Vehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"vehicles": result,
+		"vehicles": vehicles,
 	})
 }
 
@@ -93,25 +97,25 @@ func (h *QueryHandler) GetVehiclesRegisteredAfter(c *gin.Context) {
 	timestamp := c.Query("after")
 
 	if timestamp == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "after query parameter is required (RFC3339 format)",
-		})
+		respondBadRequest(c, "after query parameter is required (RFC3339 format)")
 		return
 	}
 
-	result, err := h.fabricClient.EvaluateTransaction("GetVehiclesRegisteredAfter", timestamp)
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetVehiclesRegisteredAfter", timestamp)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicles", err)
+		return
+	}
+
+	vehicles := []models.Vehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"vehicles": result,
+		"vehicles": vehicles,
 	})
 }
 
@@ -122,22 +126,26 @@ func (h *QueryHandler) GetVehiclesByMultipleCriteria(c *gin.Context) {
 	afterDate := c.Query("after")
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"GetVehiclesByMultipleCriteria",
 		ownerUserID,
 		vinPrefix,
 		afterDate,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicles", err)
+		return
+	}
+
+	vehicles := []models.Vehicle{}
+	if err := decodeResult(result, &vehicles); err != nil {
+		respondError(c, "Failed to get vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"vehicles": result,
+		"vehicles": vehicles,
 	})
 }
 
@@ -149,10 +157,7 @@ func (h *QueryHandler) QueryVehiclesWithPagination(c *gin.Context) {
 
 	pageSize, err := strconv.ParseInt(pageSizeStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid pageSize",
-		})
+		respondBadRequest(c, "Invalid pageSize")
 		return
 	}
 
@@ -161,22 +166,26 @@ func (h *QueryHandler) QueryVehiclesWithPagination(c *gin.Context) {
 	}
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"QueryVehiclesWithPagination",
 		queryString,
 		strconv.FormatInt(pageSize, 10),
 		bookmark,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to query vehicles: " + err.Error(),
-		})
+		respondError(c, "Failed to query vehicles", err)
+		return
+	}
+
+	page := models.VehiclePage{}
+	if err := decodeResult(result, &page); err != nil {
+		respondError(c, "Failed to query vehicles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"result":  result,
+		"result":  page,
 	})
 }
 
@@ -185,25 +194,25 @@ func (h *QueryHandler) GetVehicleHistory(c *gin.Context) {
 	onChainID := c.Param("onChainId")
 
 	if onChainID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "onChainId is required",
-		})
+		respondBadRequest(c, "onChainId is required")
 		return
 	}
 
-	result, err := h.fabricClient.EvaluateTransaction("GetVehicleHistory", onChainID)
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetVehicleHistory", onChainID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get vehicle history: " + err.Error(),
-		})
+		respondError(c, "Failed to get vehicle history", err)
+		return
+	}
+
+	history := []models.VehicleHistoryEntry{}
+	if err := decodeResult(result, &history); err != nil {
+		respondError(c, "Failed to get vehicle history", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"history": result,
+		"history": history,
 	})
 }
 
@@ -212,24 +221,21 @@ func (h *QueryHandler) GetAccessGrantsByVehicle(c *gin.Context) {
 	onChainID := c.Param("onChainId")
 
 	if onChainID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "onChainId is required",
-		})
+		respondBadRequest(c, "onChainId is required")
 		return
 	}
 
-	result, err := h.fabricClient.EvaluateTransaction("GetAccessGrantsByVehicle", onChainID)
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetAccessGrantsByVehicle", onChainID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get access grants: " + err.Error(),
-		})
+		respondError(c, "Failed to get access grants", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"grants":  result,
-	})
+	grants := []models.AccessGrant{}
+	if err := decodeResult(result, &grants); err != nil {
+		respondError(c, "Failed to get access grants", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accessGrantsResponse{Success: true, Grants: grants})
 }
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"fabric-gateway/couchdb"
+	"fabric-gateway/fabric"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QueryPlanHandler struct {
+	fabricClient fabric.Ledger
+	couch        *couchdb.Client
+}
+
+func NewQueryPlanHandler(client fabric.Ledger, couch *couchdb.Client) *QueryPlanHandler {
+	return &QueryPlanHandler{fabricClient: client, couch: couch}
+}
+
+// QueryPlan is the CouchDB query a telemetry filter compiles to and how
+// CouchDB would run it
+type QueryPlan struct {
+	Query    json.RawMessage `json:"query"`
+	PageSize int32           `json:"pageSize"`
+	*couchdb.Explanation
+}
+
+// compiledQuery matches the chaincode's CompiledQuery
+type compiledQuery struct {
+	Query    string `json:"query"`
+	PageSize int32  `json:"pageSize"`
+}
+
+// ExplainTelemetryQuery handles POST /admin/telemetry/explain
+// It takes the body of POST /api/telemetry/query and reports the index
+// CouchDB picks for it; fullScan is true if it would read every document.
+func (h *QueryPlanHandler) ExplainTelemetryQuery(c *gin.Context) {
+	var req TelemetryQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	filter, err := json.Marshal(req)
+	if err != nil {
+		respondError(c, "Failed to explain query", err)
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "CompileTelemetryQuery", string(filter))
+	if err != nil {
+		respondError(c, "Failed to explain query", err)
+		return
+	}
+
+	var compiled compiledQuery
+	if err := decodeResult(result, &compiled); err != nil {
+		respondError(c, "Failed to explain query", err)
+		return
+	}
+
+	explanation, err := h.couch.Explain(c.Request.Context(), compiled.Query, compiled.PageSize)
+	if err != nil {
+		respondError(c, "Failed to explain query", err)
+		return
+	}
+	if explanation.FullScan {
+		slog.WarnContext(c.Request.Context(), "telemetry query would scan every document", "query", compiled.Query)
+	}
+
+	c.JSON(http.StatusOK, QueryPlan{
+		Query:       json.RawMessage(compiled.Query),
+		PageSize:    compiled.PageSize,
+		Explanation: explanation,
+	})
+}
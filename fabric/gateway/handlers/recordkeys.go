@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// telemetryObjectType is the object type of the chaincode's composite keys
+// telemetry~carId~yyyymmdd~timestamp
+const telemetryObjectType = "telemetry"
+
+// compositeKeySeparator delimits the parts of a Fabric composite key
+const compositeKeySeparator = "\x00"
+
+// dayLayout formats the UTC day bucket of a telemetry key
+const dayLayout = "20060102"
+
+var errInvalidRecordKey = errors.New("invalid telemetry key")
+
+// telemetryKey builds the world state key of the reading taken by carId at
+// timestamp, the Unix time in nanoseconds used by SubmitTelemetry
+func telemetryKey(carId, timestamp string) (string, error) {
+	if !validKeyAttribute(carId) {
+		return "", errors.New("carId must be valid UTF-8 without NUL characters")
+	}
+	nanos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || strings.Trim(timestamp, "0123456789") != "" {
+		return "", errors.New("timestamp must be the record's Unix time in nanoseconds")
+	}
+	day := time.Unix(0, nanos).UTC().Format(dayLayout)
+	return compositeKeySeparator + telemetryObjectType + compositeKeySeparator +
+		carId + compositeKeySeparator + day + compositeKeySeparator +
+		timestamp + compositeKeySeparator, nil
+}
+
+// encodeRecordKey makes a world state key safe to use as a URL path segment
+func encodeRecordKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeRecordKey reverses encodeRecordKey for a telemetry key and returns
+// the raw key with the car it belongs to
+func decodeRecordKey(encoded string) (key, carId string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", errInvalidRecordKey
+	}
+
+	// Records not yet re-keyed by MigrateTelemetryKeys have no day bucket
+	parts := strings.Split(string(raw), compositeKeySeparator)
+	if len(parts) < 5 || len(parts) > 6 || parts[0] != "" || parts[1] != telemetryObjectType ||
+		parts[len(parts)-1] != "" {
+		return "", "", errInvalidRecordKey
+	}
+	carId = parts[2]
+	key, err = telemetryKey(carId, parts[len(parts)-2])
+	if err != nil {
+		return "", "", errInvalidRecordKey
+	}
+	if len(parts) == 5 {
+		return string(raw), carId, nil
+	}
+	if key != string(raw) {
+		return "", "", errInvalidRecordKey
+	}
+	return key, carId, nil
+}
+
+func validKeyAttribute(attr string) bool {
+	return attr != "" && utf8.ValidString(attr) && !strings.Contains(attr, compositeKeySeparator)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestTelemetryKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		carId     string
+		timestamp string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "reading key with its UTC day",
+			carId:     "7",
+			timestamp: "1741651200000000001", // 2025-03-11T00:00:00.000000001Z
+			want:      "\x00telemetry\x007\x0020250311\x001741651200000000001\x00",
+		},
+		{
+			name:      "time before the epoch",
+			carId:     "7",
+			timestamp: "0",
+			want:      "\x00telemetry\x007\x0019700101\x000\x00",
+		},
+		{name: "empty car", carId: "", timestamp: "1", wantErr: true},
+		{name: "car with NUL", carId: "7\x00x", timestamp: "1", wantErr: true},
+		{name: "car not UTF-8", carId: "\xff", timestamp: "1", wantErr: true},
+		{name: "signed timestamp", carId: "7", timestamp: "+1", wantErr: true},
+		{name: "negative timestamp", carId: "7", timestamp: "-1", wantErr: true},
+		{name: "RFC 3339 timestamp", carId: "7", timestamp: "2025-03-11T00:00:00Z", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := telemetryKey(tt.carId, tt.timestamp)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got key %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("telemetryKey: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordKey(t *testing.T) {
+	encode := func(key string) string { return base64.RawURLEncoding.EncodeToString([]byte(key)) }
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantKey string
+		wantCar string
+		wantErr bool
+	}{
+		{
+			name:    "bucket layout",
+			encoded: encode("\x00telemetry\x007\x0020250311\x001741651200000000001\x00"),
+			wantKey: "\x00telemetry\x007\x0020250311\x001741651200000000001\x00",
+			wantCar: "7",
+		},
+		{
+			name:    "legacy layout",
+			encoded: encode("\x00telemetry\x007\x001741651200000000001\x00"),
+			wantKey: "\x00telemetry\x007\x001741651200000000001\x00",
+			wantCar: "7",
+		},
+		{
+			name:    "day bucket does not match the time",
+			encoded: encode("\x00telemetry\x007\x0020250310\x001741651200000000001\x00"),
+			wantErr: true,
+		},
+		{
+			name:    "other object type",
+			encoded: encode("\x00vehicle\x007\x0020250311\x001741651200000000001\x00"),
+			wantErr: true,
+		},
+		{
+			name:    "too many attributes",
+			encoded: encode("\x00telemetry\x007\x0020250311\x00x\x001741651200000000001\x00"),
+			wantErr: true,
+		},
+		{
+			name:    "missing trailing separator",
+			encoded: encode("\x00telemetry\x007\x0020250311\x001741651200000000001"),
+			wantErr: true,
+		},
+		{
+			name:    "time is not a number",
+			encoded: encode("\x00telemetry\x007\x00noon\x00"),
+			wantErr: true,
+		},
+		{name: "standard base64", encoded: "AHRlbGVtZXRyeQA3ADE3NDE2NTEyMDAwMDAwMDAwMDEA+/", wantErr: true},
+		{name: "empty", encoded: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, carId, err := decodeRecordKey(tt.encoded)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got key %q, want an error", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeRecordKey: %v", err)
+			}
+			if key != tt.wantKey || carId != tt.wantCar {
+				t.Errorf("got (%q, %q), want (%q, %q)", key, carId, tt.wantKey, tt.wantCar)
+			}
+			if encodeRecordKey(key) != tt.encoded {
+				t.Errorf("encodeRecordKey(%q) = %q, want %q", key, encodeRecordKey(key), tt.encoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"net/http"
+
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleResponse is the body of the routes that assign a role
+type roleResponse struct {
+	Success bool                  `json:"success"`
+	Role    models.RoleAssignment `json:"role"`
+}
+
+// rolesResponse lists everyone with a role on a vehicle
+type rolesResponse struct {
+	Success bool                    `json:"success"`
+	Roles   []models.RoleAssignment `json:"roles"`
+}
+
+// invitationResponse is the body of the routes that change an invitation
+type invitationResponse struct {
+	Success    bool              `json:"success"`
+	Invitation models.Invitation `json:"invitation"`
+}
+
+// invitationsResponse lists the invitations made for a vehicle
+type invitationsResponse struct {
+	Success     bool                `json:"success"`
+	Invitations []models.Invitation `json:"invitations"`
+}
+
+// GetVehicleRoles handles GET /api/vehicles/:onChainId/roles
+func (h *VehicleHandler) GetVehicleRoles(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetVehicleRoles", c.Param("onChainId"))
+	if err != nil {
+		respondError(c, "Failed to get roles", err)
+		return
+	}
+
+	roles := []models.RoleAssignment{}
+	if err := decodeResult(result, &roles); err != nil {
+		respondError(c, "Failed to get roles", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rolesResponse{Success: true, Roles: roles})
+}
+
+// AssignRole handles PUT /api/vehicles/:onChainId/roles/:userId
+func (h *VehicleHandler) AssignRole(c *gin.Context) {
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"AssignRole",
+		c.Param("onChainId"),
+		req.OwnerUserID,
+		c.Param("userId"),
+		req.MSPID,
+		req.Role,
+	)
+	if err != nil {
+		respondError(c, "Failed to assign role", err)
+		return
+	}
+
+	var assignment models.RoleAssignment
+	if err := decodeResult(result, &assignment); err != nil {
+		respondError(c, "Failed to assign role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roleResponse{Success: true, Role: assignment})
+}
+
+// RevokeRole handles DELETE /api/vehicles/:onChainId/roles/:userId?ownerUserId=...
+func (h *VehicleHandler) RevokeRole(c *gin.Context) {
+	ownerUserID := c.Query("ownerUserId")
+	if ownerUserID == "" {
+		respondBadRequest(c, "ownerUserId query parameter is required")
+		return
+	}
+
+	_, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"RevokeRole",
+		c.Param("onChainId"),
+		ownerUserID,
+		c.Param("userId"),
+	)
+	if err != nil {
+		respondError(c, "Failed to revoke role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Success: true})
+}
+
+// InviteUser handles POST /api/vehicles/:onChainId/invitations
+func (h *VehicleHandler) InviteUser(c *gin.Context) {
+	var req models.InviteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"InviteUser",
+		c.Param("onChainId"),
+		req.InviterUserID,
+		req.InvitedUserID,
+		req.InvitedMSPID,
+		req.Role,
+	)
+	if err != nil {
+		respondError(c, "Failed to invite user", err)
+		return
+	}
+
+	var invitation models.Invitation
+	if err := decodeResult(result, &invitation); err != nil {
+		respondError(c, "Failed to invite user", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitationResponse{Success: true, Invitation: invitation})
+}
+
+// GetInvitations handles GET /api/vehicles/:onChainId/invitations
+func (h *VehicleHandler) GetInvitations(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetInvitations", c.Param("onChainId"))
+	if err != nil {
+		respondError(c, "Failed to get invitations", err)
+		return
+	}
+
+	invitations := []models.Invitation{}
+	if err := decodeResult(result, &invitations); err != nil {
+		respondError(c, "Failed to get invitations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitationsResponse{Success: true, Invitations: invitations})
+}
+
+// AcceptInvitation handles
+// POST /api/vehicles/:onChainId/invitations/:inviteId/accept
+func (h *VehicleHandler) AcceptInvitation(c *gin.Context) {
+	var req models.UserActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"AcceptInvitation",
+		c.Param("onChainId"),
+		c.Param("inviteId"),
+		req.UserID,
+	)
+	if err != nil {
+		respondError(c, "Failed to accept invitation", err)
+		return
+	}
+
+	var assignment models.RoleAssignment
+	if err := decodeResult(result, &assignment); err != nil {
+		respondError(c, "Failed to accept invitation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roleResponse{Success: true, Role: assignment})
+}
+
+// DeclineInvitation handles
+// POST /api/vehicles/:onChainId/invitations/:inviteId/decline
+func (h *VehicleHandler) DeclineInvitation(c *gin.Context) {
+	h.closeInvitation(c, "DeclineInvitation", "Failed to decline invitation")
+}
+
+// CancelInvitation handles
+// POST /api/vehicles/:onChainId/invitations/:inviteId/cancel
+func (h *VehicleHandler) CancelInvitation(c *gin.Context) {
+	h.closeInvitation(c, "CancelInvitation", "Failed to cancel invitation")
+}
+
+// closeInvitation submits a function that ends a pending invitation on
+// behalf of the user in the body
+func (h *VehicleHandler) closeInvitation(c *gin.Context, funcName, failure string) {
+	var req models.UserActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		funcName,
+		c.Param("onChainId"),
+		c.Param("inviteId"),
+		req.UserID,
+	)
+	if err != nil {
+		respondError(c, failure, err)
+		return
+	}
+
+	var invitation models.Invitation
+	if err := decodeResult(result, &invitation); err != nil {
+		respondError(c, failure, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitationResponse{Success: true, Invitation: invitation})
+}
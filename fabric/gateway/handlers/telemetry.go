@@ -3,18 +3,27 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"fabric-gateway/auth"
 	"fabric-gateway/fabric"
+	"fabric-gateway/logging"
+	"fabric-gateway/outbox"
 
 	"github.com/gin-gonic/gin"
 )
 
 type TelemetryHandler struct {
-	fabricClient *fabric.Client
+	fabricClient fabric.Ledger
+	// outbox, when set, takes every submission and delivers it in the
+	// background
+	outbox *outbox.Outbox
 }
 
-func NewTelemetryHandler(client *fabric.Client) *TelemetryHandler {
-	return &TelemetryHandler{fabricClient: client}
+func NewTelemetryHandler(client fabric.Ledger, ob *outbox.Outbox) *TelemetryHandler {
+	return &TelemetryHandler{fabricClient: client, outbox: ob}
 }
 
 // SubmitTelemetryRequest matches the .NET SubmitTelemetryRequest
@@ -23,43 +32,119 @@ type SubmitTelemetryRequest struct {
 	CarData string `json:"carData" binding:"required"`
 }
 
+// TelemetryQueryRequest is the filter of POST /api/telemetry/query. The
+// chaincode validates fields and operators: carId supports eq, ne and in;
+// insertTime supports eq, gt, gte, lt and lte with RFC 3339 values, and
+// speedKmh, odometerKm, latitude and longitude the same with numbers.
+type TelemetryQueryRequest struct {
+	Conditions []TelemetryCondition `json:"conditions" binding:"dive"`
+	Sort       []TelemetrySort      `json:"sort" binding:"dive"`
+	Limit      int32                `json:"limit" binding:"min=0"`
+	Bookmark   string               `json:"bookmark"`
+}
+
+// TelemetryCondition compares a field with a string or number, or for "in"
+// an array of strings
+type TelemetryCondition struct {
+	Field string `json:"field" binding:"required"`
+	Op    string `json:"op" binding:"required"`
+	Value any    `json:"value" binding:"required"`
+}
+
+// TelemetrySort orders query results, "asc" by default or "desc"
+type TelemetrySort struct {
+	Field     string `json:"field" binding:"required"`
+	Direction string `json:"direction"`
+}
+
+// TelemetryPage is one page of a telemetry query
+type TelemetryPage struct {
+	Records             []VehicleTelemetry `json:"records"`
+	FetchedRecordsCount int32              `json:"fetchedRecordsCount"`
+	Bookmark            string             `json:"bookmark"`
+}
+
 // TelemetryResponse for successful operations
 type TelemetryResponse struct {
-	Success bool   `json:"success"`
-	Result  string `json:"result,omitempty"`
-	TxId    string `json:"txId,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success  bool   `json:"success"`
+	Result   string `json:"result,omitempty"`
+	TxId     string `json:"txId,omitempty"`
+	OutboxId string `json:"outboxId,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 // VehicleTelemetry matches the chaincode model
 type VehicleTelemetry struct {
-	CarId      string `json:"carId"`
-	CarData    string `json:"carData"`
-	InsertTime string `json:"insertTime"`
+	CarId      string    `json:"carId"`
+	CarData    string    `json:"carData"`
+	InsertTime time.Time `json:"insertTime"`
+	// Key is the record's world state key in URL-safe base64, for
+	// GET /api/telemetry/key/:key
+	Key string `json:"key,omitempty"`
+}
+
+// TelemetryHistoryEntry is one ledger modification of a telemetry record
+type TelemetryHistoryEntry struct {
+	TxId      string            `json:"txId"`
+	Timestamp time.Time         `json:"timestamp"`
+	IsDelete  bool              `json:"isDelete"`
+	Record    *VehicleTelemetry `json:"record,omitempty"`
 }
 
 // SubmitTelemetry handles POST /api/telemetry/submit
+// With ?async=true or "Prefer: respond-async" it replies 202 once the
+// transaction is ordered; poll GET /api/tx/:txId for the commit status.
+// With the outbox enabled it always replies 202 once the reading is stored;
+// poll GET /api/outbox/:itemId for delivery.
 func (h *TelemetryHandler) SubmitTelemetry(c *gin.Context) {
 	var req SubmitTelemetryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, TelemetryResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	logging.Annotate(c.Request.Context(), "carId", req.CarId)
+
+	if h.outbox != nil {
+		item, err := h.outbox.Enqueue(req.CarId, req.CarData, fabric.UserFromContext(c.Request.Context()))
+		if err != nil {
+			respondError(c, "Failed to queue telemetry", err)
+			return
+		}
+
+		c.Header("Location", "/api/outbox/"+item.ID)
+		c.JSON(http.StatusAccepted, TelemetryResponse{
+			Success:  true,
+			Result:   "Telemetry queued for submission",
+			OutboxId: item.ID,
+		})
+		return
+	}
+
+	if wantsAsync(c) {
+		txId, err := h.fabricClient.SubmitAsync(c.Request.Context(), "SubmitTelemetry", req.CarId, req.CarData)
+		if err != nil {
+			respondError(c, "Failed to submit telemetry", err)
+			return
+		}
+
+		c.Header("Location", "/api/tx/"+txId)
+		c.JSON(http.StatusAccepted, TelemetryResponse{
+			Success: true,
+			Result:  "Telemetry accepted for ordering",
+			TxId:    txId,
 		})
 		return
 	}
 
 	txId, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
 		"SubmitTelemetry",
 		req.CarId,
 		req.CarData,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, TelemetryResponse{
-			Success: false,
-			Error:   "Failed to submit telemetry: " + err.Error(),
-		})
+		respondError(c, "Failed to submit telemetry", err)
 		return
 	}
 
@@ -73,35 +158,28 @@ func (h *TelemetryHandler) SubmitTelemetry(c *gin.Context) {
 // GetTelemetryByVehicle handles GET /api/telemetry/vehicle/:carId
 func (h *TelemetryHandler) GetTelemetryByVehicle(c *gin.Context) {
 	carId := c.Param("carId")
+	logging.Annotate(c.Request.Context(), "carId", carId)
 
 	if carId == "" {
-		c.JSON(http.StatusBadRequest, TelemetryResponse{
-			Success: false,
-			Error:   "carId is required",
-		})
+		respondBadRequest(c, "carId is required")
 		return
 	}
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"GetTelemetryByVehicle",
 		carId,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, TelemetryResponse{
-			Success: false,
-			Error:   "Failed to get telemetry: " + err.Error(),
-		})
+		respondError(c, "Failed to get telemetry", err)
 		return
 	}
 
-	// Parse the result as array of telemetry records
-	var records []VehicleTelemetry
-	if result != "" {
-		if err := json.Unmarshal([]byte(result), &records); err != nil {
-			// If unmarshal fails, return empty array
-			records = []VehicleTelemetry{}
-		}
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get telemetry", err)
+		return
 	}
 
 	c.JSON(http.StatusOK, records)
@@ -109,24 +187,20 @@ func (h *TelemetryHandler) GetTelemetryByVehicle(c *gin.Context) {
 
 // GetAllTelemetry handles GET /api/telemetry/all
 func (h *TelemetryHandler) GetAllTelemetry(c *gin.Context) {
-	result, err := h.fabricClient.EvaluateTransaction("GetAllTelemetry")
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetAllTelemetry")
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, TelemetryResponse{
-			Success: false,
-			Error:   "Failed to get all telemetry: " + err.Error(),
-		})
+		respondError(c, "Failed to get all telemetry", err)
 		return
 	}
 
-	var records []VehicleTelemetry
-	if result != "" {
-		if err := json.Unmarshal([]byte(result), &records); err != nil {
-			records = []VehicleTelemetry{}
-		}
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get all telemetry", err)
+		return
 	}
 
-	c.JSON(http.StatusOK, records)
+	c.JSON(http.StatusOK, visibleTelemetry(c, records))
 }
 
 // GetTelemetryAfter handles GET /api/telemetry/after?timestamp=...
@@ -134,51 +208,52 @@ func (h *TelemetryHandler) GetTelemetryAfter(c *gin.Context) {
 	timestamp := c.Query("timestamp")
 
 	if timestamp == "" {
-		c.JSON(http.StatusBadRequest, TelemetryResponse{
-			Success: false,
-			Error:   "timestamp query parameter is required",
-		})
+		respondBadRequest(c, "timestamp query parameter is required")
+		return
+	}
+	if !validTime(timestamp) {
+		respondBadRequest(c, "timestamp must be an RFC 3339 timestamp")
 		return
 	}
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"GetTelemetryAfter",
 		timestamp,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, TelemetryResponse{
-			Success: false,
-			Error:   "Failed to get telemetry: " + err.Error(),
-		})
+		respondError(c, "Failed to get telemetry", err)
 		return
 	}
 
-	var records []VehicleTelemetry
-	if result != "" {
-		if err := json.Unmarshal([]byte(result), &records); err != nil {
-			records = []VehicleTelemetry{}
-		}
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get telemetry", err)
+		return
 	}
 
-	c.JSON(http.StatusOK, records)
+	c.JSON(http.StatusOK, visibleTelemetry(c, records))
 }
 
 // GetTelemetryByRange handles GET /api/telemetry/range?carId=...&startTime=...&endTime=...
 func (h *TelemetryHandler) GetTelemetryByRange(c *gin.Context) {
 	carId := c.Query("carId")
+	logging.Annotate(c.Request.Context(), "carId", carId)
 	startTime := c.Query("startTime")
 	endTime := c.Query("endTime")
 
 	if carId == "" {
-		c.JSON(http.StatusBadRequest, TelemetryResponse{
-			Success: false,
-			Error:   "carId query parameter is required",
-		})
+		respondBadRequest(c, "carId query parameter is required")
+		return
+	}
+	if (startTime != "" && !validTime(startTime)) || (endTime != "" && !validTime(endTime)) {
+		respondBadRequest(c, "startTime and endTime must be RFC 3339 timestamps")
 		return
 	}
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"GetTelemetryByRange",
 		carId,
 		startTime,
@@ -186,19 +261,302 @@ func (h *TelemetryHandler) GetTelemetryByRange(c *gin.Context) {
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, TelemetryResponse{
-			Success: false,
-			Error:   "Failed to get telemetry: " + err.Error(),
-		})
+		respondError(c, "Failed to get telemetry", err)
+		return
+	}
+
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get telemetry", err)
 		return
 	}
 
-	var records []VehicleTelemetry
-	if result != "" {
-		if err := json.Unmarshal([]byte(result), &records); err != nil {
-			records = []VehicleTelemetry{}
+	c.JSON(http.StatusOK, records)
+}
+
+// GetLatestTelemetry handles GET /api/telemetry/vehicle/:carId/latest
+func (h *TelemetryHandler) GetLatestTelemetry(c *gin.Context) {
+	carId := c.Param("carId")
+	logging.Annotate(c.Request.Context(), "carId", carId)
+
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetLatestTelemetry", carId)
+	if err != nil {
+		respondError(c, "Failed to get latest telemetry", err)
+		return
+	}
+
+	var record VehicleTelemetry
+	if err := decodeResult(result, &record); err != nil {
+		respondError(c, "Failed to get latest telemetry", err)
+		return
+	}
+	record.Key = encodeRecordKey(record.Key)
+
+	c.JSON(http.StatusOK, record)
+}
+
+// GetLatestTelemetryForVehicles handles GET /api/telemetry/latest?carIds=...
+// carIds is a comma-separated list; without it every vehicle is returned.
+// Vehicles without telemetry are left out.
+func (h *TelemetryHandler) GetLatestTelemetryForVehicles(c *gin.Context) {
+	carIds := []string{}
+	for _, carId := range strings.Split(c.Query("carIds"), ",") {
+		if carId = strings.TrimSpace(carId); carId == "" {
+			continue
+		}
+		// The auth middleware only sees a single carId
+		if !auth.AuthorizeVehicle(c, carId) {
+			return
 		}
+		carIds = append(carIds, carId)
+	}
+
+	carIdsJSON, err := json.Marshal(carIds)
+	if err != nil {
+		respondError(c, "Failed to get latest telemetry", err)
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
+		"GetLatestTelemetryForVehicles",
+		string(carIdsJSON),
+	)
+	if err != nil {
+		respondError(c, "Failed to get latest telemetry", err)
+		return
+	}
+
+	records, err := decodeTelemetry(result)
+	if err != nil {
+		respondError(c, "Failed to get latest telemetry", err)
+		return
 	}
 
 	c.JSON(http.StatusOK, records)
 }
+
+// QueryTelemetry handles POST /api/telemetry/query
+// A key limited to some vehicles must filter on carId with eq or in.
+func (h *TelemetryHandler) QueryTelemetry(c *gin.Context) {
+	var req TelemetryQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	if !auth.AuthorizeVehicles(c, filteredVehicles(req.Conditions)) {
+		return
+	}
+
+	filter, err := json.Marshal(req)
+	if err != nil {
+		respondError(c, "Failed to query telemetry", err)
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "QueryTelemetry", string(filter))
+	if err != nil {
+		respondError(c, "Failed to query telemetry", err)
+		return
+	}
+
+	page := TelemetryPage{}
+	if err := decodeResult(result, &page); err != nil {
+		respondError(c, "Failed to query telemetry", err)
+		return
+	}
+	if page.Records == nil {
+		page.Records = []VehicleTelemetry{}
+	}
+	for i := range page.Records {
+		page.Records[i].Key = encodeRecordKey(page.Records[i].Key)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// filteredVehicles returns the cars a query is restricted to by carId eq and
+// in conditions
+func filteredVehicles(conditions []TelemetryCondition) []string {
+	var carIds []string
+	for _, condition := range conditions {
+		if condition.Field != "carId" {
+			continue
+		}
+		switch value := condition.Value.(type) {
+		case string:
+			if condition.Op == "eq" {
+				carIds = append(carIds, value)
+			}
+		case []any:
+			if condition.Op != "in" {
+				continue
+			}
+			for _, v := range value {
+				if carId, ok := v.(string); ok {
+					carIds = append(carIds, carId)
+				}
+			}
+		}
+	}
+	return carIds
+}
+
+// ReadTelemetry handles GET /api/telemetry/vehicle/:carId/:timestamp and
+// GET /api/telemetry/key/:key
+func (h *TelemetryHandler) ReadTelemetry(c *gin.Context) {
+	key, ok := recordKey(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "ReadTelemetry", key)
+	if err != nil {
+		respondError(c, "Failed to read telemetry", err)
+		return
+	}
+
+	var record VehicleTelemetry
+	if err := decodeResult(result, &record); err != nil {
+		respondError(c, "Failed to read telemetry", err)
+		return
+	}
+	record.Key = encodeRecordKey(record.Key)
+
+	c.JSON(http.StatusOK, record)
+}
+
+// GetTelemetryHistory handles GET /api/telemetry/vehicle/:carId/:timestamp/history
+// and GET /api/telemetry/key/:key/history, newest change first
+func (h *TelemetryHandler) GetTelemetryHistory(c *gin.Context) {
+	key, ok := recordKey(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetTelemetryHistory", key)
+	if err != nil {
+		respondError(c, "Failed to get telemetry history", err)
+		return
+	}
+
+	var history []TelemetryHistoryEntry
+	if err := decodeResult(result, &history); err != nil {
+		respondError(c, "Failed to get telemetry history", err)
+		return
+	}
+	if len(history) == 0 {
+		respondError(c, "Failed to get telemetry history", &fabric.Error{
+			Code:       fabric.ErrCodeNotFound,
+			HTTPStatus: http.StatusNotFound,
+			Message:    "telemetry record not found",
+		})
+		return
+	}
+
+	for i := range history {
+		if history[i].IsDelete {
+			history[i].Record = nil
+		} else if history[i].Record != nil {
+			history[i].Record.Key = encodeRecordKey(history[i].Record.Key)
+		}
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// KeyMigrationResult reports one batch of MigrateTelemetryKeys
+type KeyMigrationResult struct {
+	Migrated int  `json:"migrated"`
+	Done     bool `json:"done"`
+}
+
+// MigrateTelemetryKeys handles POST /admin/migrations/telemetry-keys?batchSize=500
+// Each call re-keys one batch of records into the day-bucketed layout; repeat
+// until done is true.
+func (h *TelemetryHandler) MigrateTelemetryKeys(c *gin.Context) {
+	batchSize := 500
+	if value := c.Query("batchSize"); value != "" {
+		var err error
+		if batchSize, err = strconv.Atoi(value); err != nil || batchSize <= 0 {
+			respondBadRequest(c, "Invalid batchSize")
+			return
+		}
+	}
+
+	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
+		"MigrateTelemetryKeys",
+		strconv.Itoa(batchSize),
+	)
+	if err != nil {
+		respondError(c, "Failed to migrate telemetry keys", err)
+		return
+	}
+
+	var migration KeyMigrationResult
+	if err := decodeResult(result, &migration); err != nil {
+		respondError(c, "Failed to migrate telemetry keys", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+// recordKey resolves the world state key addressed by the route, built from
+// carId and timestamp or decoded from key. Encoded keys name their vehicle,
+// so its scope is checked here rather than by the auth middleware. It
+// responds and returns false if the key is invalid or not allowed.
+func recordKey(c *gin.Context) (string, bool) {
+	if encoded := c.Param("key"); encoded != "" {
+		key, carId, err := decodeRecordKey(encoded)
+		if err != nil {
+			respondBadRequest(c, err.Error())
+			return "", false
+		}
+		logging.Annotate(c.Request.Context(), "carId", carId)
+		return key, auth.AuthorizeVehicle(c, carId)
+	}
+
+	carId := c.Param("carId")
+	logging.Annotate(c.Request.Context(), "carId", carId)
+	key, err := telemetryKey(carId, c.Param("timestamp"))
+	if err != nil {
+		respondBadRequest(c, err.Error())
+		return "", false
+	}
+	return key, true
+}
+
+func validTime(value string) bool {
+	_, err := time.Parse(time.RFC3339Nano, value)
+	return err == nil
+}
+
+// decodeTelemetry decodes a list of records returned by the chaincode and
+// makes their keys URL safe
+// visibleTelemetry leaves out the records of vehicles outside the scope of
+// the request's API key
+func visibleTelemetry(c *gin.Context, records []VehicleTelemetry) []VehicleTelemetry {
+	visible := []VehicleTelemetry{}
+	for _, record := range records {
+		if auth.VisibleVehicle(c, record.CarId) {
+			visible = append(visible, record)
+		}
+	}
+	return visible
+}
+
+func decodeTelemetry(result string) ([]VehicleTelemetry, error) {
+	records := []VehicleTelemetry{}
+	if err := decodeResult(result, &records); err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []VehicleTelemetry{}
+	}
+	for i := range records {
+		records[i].Key = encodeRecordKey(records[i].Key)
+	}
+	return records, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"fabric-gateway/auth"
+	"fabric-gateway/fabric"
+	"fabric-gateway/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TransactionHandler struct {
+	fabricClient fabric.Ledger
+}
+
+func NewTransactionHandler(client fabric.Ledger) *TransactionHandler {
+	return &TransactionHandler{fabricClient: client}
+}
+
+// GetTransactionStatus handles GET /api/tx/:txId
+// The status does not say which vehicle the transaction was for, so keys
+// limited to some vehicles cannot read it.
+func (h *TransactionHandler) GetTransactionStatus(c *gin.Context) {
+	if !auth.AuthorizeAllVehicles(c) {
+		return
+	}
+	txId := c.Param("txId")
+
+	status, err := h.fabricClient.TransactionStatus(txId)
+	if err != nil {
+		respondError(c, "Failed to get transaction status", err)
+		return
+	}
+
+	if status == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Transaction not found: " + txId,
+			Code:    fabric.ErrCodeNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"transaction": status,
+	})
+}
+
+// wantsAsync reports whether the caller asked for asynchronous submission
+func wantsAsync(c *gin.Context) bool {
+	if c.Query("async") == "true" {
+		return true
+	}
+	return strings.Contains(c.GetHeader("Prefer"), "respond-async")
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"fabric-gateway/auth"
+	"fabric-gateway/fabric"
+	"fabric-gateway/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserHeader names the backend user a request is made for. The backend sets
+// it to the signed-in user, and the chaincode then only lets that user read
+// or submit telemetry for vehicles they hold a role on, and take the actions
+// of a party, such as accepting a transfer. The API key must be allowed to
+// act for the user; a key bound to a single user acts for it without the
+// header.
+const UserHeader = "X-User-Id"
+
+// ActingUser passes the user the request acts for to its ledger calls,
+// rejecting users the API key may not act for. Requests acting for no user
+// are made for the organization, which may submit telemetry for its own
+// vehicles but not read registered vehicles' telemetry.
+func ActingUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.AuthorizeUser(c, c.GetHeader(UserHeader))
+		if !ok {
+			return
+		}
+		if userID != "" {
+			ctx := fabric.WithUser(c.Request.Context(), userID)
+			logging.Annotate(ctx, "userId", userID)
+			c.Request = c.Request.WithContext(ctx)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"fabric-gateway/models"
+	"fabric-gateway/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateRequests rejects requests that do not match the OpenAPI document
+// with a 400 listing every violation. Routes without a description pass
+// through unchecked.
+func ValidateRequests(spec *openapi.Spec) gin.HandlerFunc {
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		route := spec.Route(c.Request.Method, c.FullPath())
+		if route == nil {
+			c.Next()
+			return
+		}
+
+		pathParams := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			pathParams[param.Key] = param.Value
+		}
+
+		err := openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid request",
+				Code:    ErrCodeInvalidRequest,
+				Details: validationDetails(err, ""),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// validationDetails flattens the errors reported by openapi3filter into one
+// detail per violation. field names the parameter or body property the
+// errors belong to.
+func validationDetails(err error, field string) []models.ErrorDetail {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var details []models.ErrorDetail
+		for _, nested := range e {
+			details = append(details, validationDetails(nested, field)...)
+		}
+		return details
+
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		switch e.Err.(type) {
+		case openapi3.MultiError, *openapi3.SchemaError:
+			return validationDetails(e.Err, field)
+		}
+		message := e.Reason
+		if message == "" && e.Err != nil {
+			message = e.Err.Error()
+		}
+		return []models.ErrorDetail{{Field: field, Message: message}}
+
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			field = strings.Join(pointer, ".")
+		}
+		return []models.ErrorDetail{{Field: field, Message: e.Reason}}
+	}
+
+	return []models.ErrorDetail{{Field: field, Message: err.Error()}}
+}
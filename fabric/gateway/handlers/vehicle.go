@@ -10,24 +10,35 @@ import (
 )
 
 type VehicleHandler struct {
-	fabricClient *fabric.Client
+	fabricClient fabric.Ledger
 }
 
-func NewVehicleHandler(client *fabric.Client) *VehicleHandler {
+func NewVehicleHandler(client fabric.Ledger) *VehicleHandler {
 	return &VehicleHandler{fabricClient: client}
 }
 
+// vehicleResponse is the body of the vehicle routes
+type vehicleResponse struct {
+	Success bool           `json:"success"`
+	Vehicle models.Vehicle `json:"vehicle"`
+}
+
+// endorsementResponse lists the organizations that endorse writes to a
+// vehicle
+type endorsementResponse struct {
+	Success       bool     `json:"success"`
+	Organizations []string `json:"organizations"`
+}
+
 func (h *VehicleHandler) RegisterVehicle(c *gin.Context) {
 	var req models.RegisterVehicleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		respondBadRequest(c, "Invalid request: "+err.Error())
 		return
 	}
 
 	result, err := h.fabricClient.SubmitTransaction(
+		c.Request.Context(),
 		"RegisterVehicle",
 		req.OnChainID,
 		req.VIN,
@@ -35,46 +46,77 @@ func (h *VehicleHandler) RegisterVehicle(c *gin.Context) {
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Success: false,
-			Error:   "Failed to register vehicle: " + err.Error(),
-		})
+		respondError(c, "Failed to register vehicle", err)
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := decodeResult(result, &vehicle); err != nil {
+		respondError(c, "Failed to register vehicle", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Result:  result,
-		TxID:    req.OnChainID,
-	})
+	c.JSON(http.StatusCreated, vehicleResponse{Success: true, Vehicle: vehicle})
 }
 
 func (h *VehicleHandler) ReadVehicle(c *gin.Context) {
 	onChainID := c.Param("onChainId")
 
 	if onChainID == "" {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   "onChainId is required",
-		})
+		respondBadRequest(c, "onChainId is required")
 		return
 	}
 
 	result, err := h.fabricClient.EvaluateTransaction(
+		c.Request.Context(),
 		"ReadVehicle",
 		onChainID,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.Response{
-			Success: false,
-			Error:   "Vehicle not found: " + err.Error(),
-		})
+		respondError(c, "Failed to read vehicle", err)
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := decodeResult(result, &vehicle); err != nil {
+		respondError(c, "Failed to read vehicle", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicleResponse{Success: true, Vehicle: vehicle})
+}
+
+// GetEndorsingOrganizations handles GET /api/vehicles/:onChainId/endorsement
+func (h *VehicleHandler) GetEndorsingOrganizations(c *gin.Context) {
+	result, err := h.fabricClient.EvaluateTransaction(c.Request.Context(), "GetEndorsingOrganizations", c.Param("onChainId"))
+	if err != nil {
+		respondError(c, "Failed to get endorsing organizations", err)
+		return
+	}
+
+	orgs := []string{}
+	if err := decodeResult(result, &orgs); err != nil {
+		respondError(c, "Failed to get endorsing organizations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, endorsementResponse{Success: true, Organizations: orgs})
+}
+
+// RefreshEndorsement handles POST /api/vehicles/:onChainId/endorsement/refresh
+func (h *VehicleHandler) RefreshEndorsement(c *gin.Context) {
+	result, err := h.fabricClient.SubmitTransaction(c.Request.Context(), "RefreshEndorsement", c.Param("onChainId"))
+	if err != nil {
+		respondError(c, "Failed to refresh endorsement", err)
+		return
+	}
+
+	orgs := []string{}
+	if err := decodeResult(result, &orgs); err != nil {
+		respondError(c, "Failed to refresh endorsement", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"vehicle": result,
-	})
+	c.JSON(http.StatusOK, endorsementResponse{Success: true, Organizations: orgs})
 }
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is read from incoming requests and echoed on responses
+const RequestIDHeader = "X-Request-ID"
+
+var logPayloads bool
+
+// Setup installs a JSON slog logger as the default. LOG_LEVEL selects the
+// minimum level (debug, info, warn, error) and LOG_PAYLOADS=true allows
+// transaction arguments to be logged at debug level. Payloads are off by
+// default because telemetry carries GPS positions.
+func Setup() {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+
+	logPayloads = os.Getenv("LOG_PAYLOADS") == "true"
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
+}
+
+// PayloadsEnabled reports whether transaction arguments may be logged
+func PayloadsEnabled() bool {
+	return logPayloads
+}
+
+type fieldsKey struct{}
+
+// fields holds the attributes collected for one request. Handlers add to it
+// as they learn more (e.g. the carId), so it is shared and locked.
+type fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// Annotate adds an attribute to every later log line for the request in ctx
+func Annotate(ctx context.Context, key string, value any) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.attrs = append(f.attrs, slog.Any(key, value))
+		f.mu.Unlock()
+	}
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, attr := range f.attrs {
+			if attr.Key == "requestId" {
+				return attr.Value.String()
+			}
+		}
+	}
+	return ""
+}
+
+// contextHandler adds the request attributes and trace ID from the context
+// to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		record.AddAttrs(f.attrs...)
+		f.mu.Unlock()
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		record.AddAttrs(slog.String("traceId", spanContext.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Middleware assigns each request an ID, makes it and the route available to
+// every log line written with the request context, and logs the outcome
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		f := &fields{attrs: []slog.Attr{
+			slog.String("requestId", requestID),
+			slog.String("route", route),
+		}}
+		ctx := context.WithValue(c.Request.Context(), fieldsKey{}, f)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		slog.Log(ctx, level, "request completed",
+			"method", c.Request.Method,
+			"status", c.Writer.Status(),
+			"durationMs", time.Since(start).Milliseconds(),
+			"clientIp", c.ClientIP(),
+		)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,30 +1,138 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
+	"fabric-gateway/auth"
+	"fabric-gateway/couchdb"
 	"fabric-gateway/fabric"
 	"fabric-gateway/handlers"
+	"fabric-gateway/logging"
+	"fabric-gateway/metrics"
+	"fabric-gateway/openapi"
+	"fabric-gateway/outbox"
+	"fabric-gateway/tracing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	fabricClient, err := fabric.NewClient("mychannel", "vehicle")
+	logging.Setup()
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	txStorePath := os.Getenv("TX_STATUS_DB")
+	if txStorePath == "" {
+		txStorePath = "/app/data/txstatus.db"
+	}
+
+	txStore, err := fabric.OpenTxStatusStore(txStorePath)
 	if err != nil {
-		log.Fatalf("Failed to create Fabric client: %v", err)
+		fatal("failed to open transaction status store", err)
+	}
+
+	keyStorePath := os.Getenv("API_KEYS_DB")
+	if keyStorePath == "" {
+		keyStorePath = "/app/data/apikeys.db"
+	}
+
+	keyStore, err := auth.OpenKeyStore(keyStorePath)
+	if err != nil {
+		fatal("failed to open API key store", err)
+	}
+
+	// FABRIC_MODE=mock runs the contract in process against an in-memory
+	// ledger, for working on the backend and frontend without a network. It
+	// is only linked into binaries built with -tags mock.
+	var ledger fabric.Ledger
+	switch mode := os.Getenv("FABRIC_MODE"); mode {
+	case "", "network":
+		ledger = connectFabric(txStore)
+	case "mock":
+		if ledger, err = newMockLedger(); err != nil {
+			fatal("failed to create mock ledger", err)
+		}
+	default:
+		fatal("invalid FABRIC_MODE", fmt.Errorf("unknown mode %q, expected network or mock", mode))
 	}
-	defer fabricClient.Close()
 
-	router := gin.Default()
+	// With OUTBOX_ENABLED=true submissions are persisted locally and
+	// delivered in the background, surviving peer and orderer outages
+	var telemetryOutbox *outbox.Outbox
+	if os.Getenv("OUTBOX_ENABLED") == "true" {
+		outboxPath := os.Getenv("OUTBOX_DB")
+		if outboxPath == "" {
+			outboxPath = "/app/data/outbox.db"
+		}
+
+		config := outbox.DefaultConfig()
+		if workers, err := strconv.Atoi(os.Getenv("OUTBOX_WORKERS")); err == nil && workers > 0 {
+			config.Workers = workers
+		}
+		if maxAttempts, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && maxAttempts > 0 {
+			config.MaxAttempts = maxAttempts
+		}
+
+		if telemetryOutbox, err = outbox.Open(outboxPath, ledger, config); err != nil {
+			fatal("failed to open outbox", err)
+		}
+
+		metrics.RegisterOutboxGauges(
+			func() float64 { stats, _ := telemetryOutbox.Stats(); return float64(stats.Pending) },
+			func() float64 { stats, _ := telemetryOutbox.Stats(); return float64(stats.DeadLetters) },
+			func() float64 { stats, _ := telemetryOutbox.Stats(); return float64(stats.Unknown) },
+		)
+	}
+
+	// COUCHDB_URL points at the peer's state database so telemetry query
+	// plans can be checked with /admin/telemetry/explain
+	var couch *couchdb.Client
+	if couchURL := os.Getenv("COUCHDB_URL"); couchURL != "" {
+		database := os.Getenv("COUCHDB_DATABASE")
+		if database == "" {
+			database = couchdb.StateDatabase("mychannel", "vehicle")
+		}
+		if couch, err = couchdb.New(couchURL, database); err != nil {
+			fatal("failed to configure CouchDB", err)
+		}
+	}
+
+	metrics.RegisterQueueGauges(
+		func() float64 { queued, _ := ledger.QueueDepth(); return float64(queued) },
+		func() float64 { _, running := ledger.QueueDepth(); return float64(running) },
+	)
+	metrics.RegisterCacheGauge(func() float64 { return float64(ledger.CacheSize()) })
+	metrics.RegisterGauges(
+		func() float64 { return float64(ledger.InFlight()) },
+		func() float64 { return float64(ledger.ListenerStatus().LastBlock) },
+	)
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(otelgin.Middleware(tracing.ServiceName))
+	router.Use(logging.Middleware())
+	router.Use(metrics.Middleware())
 
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Cache-Control, Pragma, traceparent, tracestate")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-RateLimit-Quota-Limit, X-RateLimit-Quota-Remaining, X-RateLimit-Quota-Reset, Retry-After, Location")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -34,37 +142,247 @@ func main() {
 		c.Next()
 	})
 
-	telemetryHandler := handlers.NewTelemetryHandler(fabricClient)
+	// Described routes are validated against the generated OpenAPI document
+	// once the caller is authenticated
+	spec := openapi.New("Fabric Gateway API", "1.0.0")
+	handlers.DescribeRoutes(spec)
+	if telemetryOutbox != nil {
+		handlers.DescribeOutboxRoutes(spec)
+	}
+	if couch != nil {
+		handlers.DescribeQueryPlanRoutes(spec)
+	}
+	validate := handlers.ValidateRequests(spec)
+
+	telemetryHandler := handlers.NewTelemetryHandler(ledger, telemetryOutbox)
+	vehicleHandler := handlers.NewVehicleHandler(ledger)
+	accessHandler := handlers.NewAccessHandler(ledger)
+	queryHandler := handlers.NewQueryHandler(ledger)
+	transactionHandler := handlers.NewTransactionHandler(ledger)
+	healthHandler := handlers.NewHealthHandler(ledger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(keyStore)
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	router.GET("/health", healthHandler.Live)
+	router.GET("/health/live", healthHandler.Live)
+	router.GET("/health/ready", healthHandler.Ready)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/openapi.json", spec.Handler())
+
+	// Client routes require an API key unless API_AUTH=disabled
+	api := router.Group("/api")
+	if os.Getenv("API_AUTH") == "disabled" {
+		slog.Warn("API key authentication is disabled")
+	} else {
+		api.Use(auth.NewAuthenticator(keyStore).Middleware())
+	}
+	api.Use(validate, handlers.CacheControl(), handlers.ActingUser())
 
 	// Telemetry routes - these match the chaincode functions
-	telemetryRoutes := router.Group("/api/telemetry")
+	telemetryRoutes := api.Group("/telemetry")
 	{
 		telemetryRoutes.POST("/submit", telemetryHandler.SubmitTelemetry)
 		telemetryRoutes.GET("/vehicle/:carId", telemetryHandler.GetTelemetryByVehicle)
+		telemetryRoutes.GET("/vehicle/:carId/latest", telemetryHandler.GetLatestTelemetry)
+		telemetryRoutes.GET("/vehicle/:carId/:timestamp", telemetryHandler.ReadTelemetry)
+		telemetryRoutes.GET("/vehicle/:carId/:timestamp/history", telemetryHandler.GetTelemetryHistory)
+		telemetryRoutes.GET("/key/:key", telemetryHandler.ReadTelemetry)
+		telemetryRoutes.GET("/key/:key/history", telemetryHandler.GetTelemetryHistory)
 		telemetryRoutes.GET("/all", telemetryHandler.GetAllTelemetry)
+		telemetryRoutes.GET("/latest", telemetryHandler.GetLatestTelemetryForVehicles)
 		telemetryRoutes.GET("/after", telemetryHandler.GetTelemetryAfter)
 		telemetryRoutes.GET("/range", telemetryHandler.GetTelemetryByRange)
+		telemetryRoutes.POST("/query", telemetryHandler.QueryTelemetry)
 	}
 
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
-		log.Println("Shutting down gracefully...")
-		os.Exit(0)
-	}()
+	vehicleRoutes := api.Group("/vehicles")
+	{
+		vehicleRoutes.POST("", vehicleHandler.RegisterVehicle)
+		vehicleRoutes.GET("/stolen", vehicleHandler.GetStolenVehicles)
+		vehicleRoutes.GET("/:onChainId", vehicleHandler.ReadVehicle)
+		vehicleRoutes.PUT("/:onChainId/status", vehicleHandler.SetVehicleStatus)
+		vehicleRoutes.GET("/:onChainId/location", vehicleHandler.GetStolenVehicleLocation)
+		vehicleRoutes.GET("/:onChainId/owners", vehicleHandler.GetOwnershipHistory)
+		vehicleRoutes.GET("/:onChainId/owners/:sequence/telemetry", vehicleHandler.GetTelemetryForOwnership)
+		vehicleRoutes.POST("/:onChainId/transfer", vehicleHandler.ProposeTransfer)
+		vehicleRoutes.GET("/:onChainId/transfer", vehicleHandler.GetPendingTransfer)
+		vehicleRoutes.POST("/:onChainId/transfer/accept", vehicleHandler.AcceptTransfer)
+		vehicleRoutes.POST("/:onChainId/transfer/cancel", vehicleHandler.CancelTransfer)
+		vehicleRoutes.GET("/:onChainId/endorsement", vehicleHandler.GetEndorsingOrganizations)
+		vehicleRoutes.POST("/:onChainId/endorsement/refresh", vehicleHandler.RefreshEndorsement)
+		vehicleRoutes.GET("/:onChainId/roles", vehicleHandler.GetVehicleRoles)
+		vehicleRoutes.PUT("/:onChainId/roles/:userId", vehicleHandler.AssignRole)
+		vehicleRoutes.DELETE("/:onChainId/roles/:userId", vehicleHandler.RevokeRole)
+		vehicleRoutes.POST("/:onChainId/invitations", vehicleHandler.InviteUser)
+		vehicleRoutes.GET("/:onChainId/invitations", vehicleHandler.GetInvitations)
+		vehicleRoutes.POST("/:onChainId/invitations/:inviteId/accept", vehicleHandler.AcceptInvitation)
+		vehicleRoutes.POST("/:onChainId/invitations/:inviteId/decline", vehicleHandler.DeclineInvitation)
+		vehicleRoutes.POST("/:onChainId/invitations/:inviteId/cancel", vehicleHandler.CancelInvitation)
+		vehicleRoutes.GET("/:onChainId/access", queryHandler.GetAccessGrantsByVehicle)
+		vehicleRoutes.GET("/:onChainId/access/:companyId", accessHandler.ReadAccess)
+		vehicleRoutes.DELETE("/:onChainId/access/:companyId", accessHandler.RevokeAccess)
+	}
+	api.POST("/access", accessHandler.GrantAccess)
+
+	api.GET("/tx/:txId", transactionHandler.GetTransactionStatus)
+
+	adminRoutes := router.Group("/admin", auth.AdminMiddleware(os.Getenv("ADMIN_API_KEY")), validate)
+	{
+		adminRoutes.POST("/keys", apiKeyHandler.CreateKey)
+		adminRoutes.GET("/keys", apiKeyHandler.ListKeys)
+		adminRoutes.GET("/keys/:keyId", apiKeyHandler.GetKey)
+		adminRoutes.POST("/keys/:keyId/rotate", apiKeyHandler.RotateKey)
+		adminRoutes.DELETE("/keys/:keyId", apiKeyHandler.RevokeKey)
+		adminRoutes.POST("/migrations/telemetry-keys", telemetryHandler.MigrateTelemetryKeys)
+	}
+
+	if telemetryOutbox != nil {
+		outboxHandler := handlers.NewOutboxHandler(telemetryOutbox)
+		api.GET("/outbox/:itemId", outboxHandler.GetItem)
+		adminRoutes.GET("/outbox", outboxHandler.Stats)
+		adminRoutes.GET("/outbox/dead-letters", outboxHandler.DeadLetters)
+		adminRoutes.POST("/outbox/dead-letters/:itemId/replay", outboxHandler.Replay)
+		adminRoutes.DELETE("/outbox/dead-letters/:itemId", outboxHandler.Discard)
+		adminRoutes.GET("/outbox/unknown", outboxHandler.Unknown)
+		adminRoutes.POST("/outbox/unknown/:itemId/resolve", outboxHandler.Resolve)
+	}
+
+	if couch != nil {
+		queryPlanHandler := handlers.NewQueryPlanHandler(ledger, couch)
+		adminRoutes.POST("/telemetry/explain", queryPlanHandler.ExplainTelemetryQuery)
+	}
+
+	if err := spec.Build(router.Routes()); err != nil {
+		fatal("failed to generate OpenAPI document", err)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3001"
 	}
 
-	log.Printf("Fabric Gateway API running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	shutdownTimeout := 30 * time.Second
+	if timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+		shutdownTimeout = timeout
+	}
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Fabric Gateway API running", "port", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		slog.Error("failed to start server", "error", err)
+	case <-sigChan:
+		slog.Info("shutting down gracefully", "timeout", shutdownTimeout.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests and let running handlers finish first, since
+	// they may still submit transactions
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server did not shut down cleanly", "error", err)
+	}
+
+	// Finish the outbox submissions already started; the rest stay queued
+	if telemetryOutbox != nil {
+		if err := telemetryOutbox.Shutdown(ctx); err != nil {
+			slog.Warn("outbox did not drain", "error", err)
+		}
+	}
+
+	// Then wait for pending commit statuses, stop the event listener and
+	// close the gateway and gRPC connection
+	if err := ledger.Shutdown(ctx); err != nil {
+		slog.Warn("Fabric client did not drain", "error", err)
+	}
+
+	if err := txStore.Close(); err != nil {
+		slog.Error("failed to close transaction status store", "error", err)
+	}
+
+	if err := keyStore.Close(); err != nil {
+		slog.Error("failed to close API key store", "error", err)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// connectFabric creates the client for the Fabric network configured by
+// FABRIC_PEERS and applies the retry, queue and cache settings
+func connectFabric(txStore *fabric.TxStatusStore) *fabric.Client {
+	peers := fabric.DefaultPeerEndpoints()
+	peerSpec := os.Getenv("FABRIC_PEERS")
+	if peerSpec == "" {
+		peerSpec = os.Getenv("FABRIC_PEER_ADDRESS")
+	}
+	if peerSpec != "" {
+		var err error
+		if peers, err = fabric.ParsePeerEndpoints(peerSpec); err != nil {
+			fatal("invalid peer configuration", err)
+		}
+	}
+
+	fabricClient, err := fabric.NewClient("mychannel", "vehicle", peers, txStore)
+	if err != nil {
+		fatal("failed to create Fabric client", err)
+	}
+
+	// FABRIC_RETRY_MAX_ATTEMPTS does not apply to the functions with their
+	// own cap, such as SubmitTelemetry; FABRIC_RETRY_MAX_ATTEMPTS_BY_FUNCTION
+	// sets those
+	policy := fabric.DefaultRetryPolicy()
+	if maxAttempts, err := strconv.Atoi(os.Getenv("FABRIC_RETRY_MAX_ATTEMPTS")); err == nil {
+		policy.MaxAttempts = maxAttempts
 	}
+	if spec := os.Getenv("FABRIC_RETRY_MAX_ATTEMPTS_BY_FUNCTION"); spec != "" {
+		attempts, err := fabric.ParseAttemptsByFunction(spec)
+		if err != nil {
+			fatal("invalid FABRIC_RETRY_MAX_ATTEMPTS_BY_FUNCTION", err)
+		}
+		maps.Copy(policy.MaxAttemptsByFunction, attempts)
+	}
+	fabricClient.SetRetryPolicy(policy)
+
+	queueConfig := fabric.DefaultQueueConfig()
+	if workers, err := strconv.Atoi(os.Getenv("FABRIC_SUBMIT_WORKERS")); err == nil && workers > 0 {
+		queueConfig.Workers = workers
+	}
+	if maxQueued, err := strconv.Atoi(os.Getenv("FABRIC_SUBMIT_QUEUE")); err == nil && maxQueued >= 0 {
+		queueConfig.MaxQueued = maxQueued
+	}
+	fabricClient.SetQueueConfig(queueConfig)
+
+	cacheConfig := fabric.DefaultCacheConfig()
+	if size, err := strconv.Atoi(os.Getenv("EVALUATE_CACHE_SIZE")); err == nil && size >= 0 {
+		cacheConfig.Size = size
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("EVALUATE_CACHE_TTL")); err == nil && ttl > 0 {
+		cacheConfig.TTL = ttl
+	}
+	fabricClient.SetCacheConfig(cacheConfig)
+
+	return fabricClient
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcome label values for Fabric call metrics
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Result label values for evaluate cache metrics
+const (
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+	CacheBypass = "bypass"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_http_requests_total",
+		Help: "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	fabricDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gateway_fabric_call_duration_seconds",
+		Help: "Latency of each Fabric transaction phase (queue, evaluate, endorse, submit, commit) per chaincode function.",
+		// Commits wait for block cutting, so the range goes past the defaults
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2, 5, 10, 30, 60},
+	}, []string{"phase", "function", "outcome"})
+
+	fabricErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_fabric_errors_total",
+		Help: "Failed Fabric calls by chaincode function and error code.",
+	}, []string{"function", "code"})
+
+	fabricRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_fabric_retries_total",
+		Help: "Fabric calls retried after a retryable error.",
+	}, []string{"function"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_evaluate_cache_requests_total",
+		Help: "Evaluations by cache result (hit, miss, bypass).",
+	}, []string{"function", "result"})
+
+	cacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_evaluate_cache_invalidations_total",
+		Help: "Cached evaluation results dropped because a block wrote the state they read.",
+	})
+
+	fabricQueueRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_fabric_queue_rejected_total",
+		Help: "Submissions rejected because the submission queue was full.",
+	}, []string{"function"})
+
+	fabricRetriesExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_fabric_retries_exhausted_total",
+		Help: "Fabric calls that still failed after the last allowed attempt.",
+	}, []string{"function"})
+)
+
+// Middleware records request counts and latency per gin route
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObservePhase records the latency of one phase of a Fabric call that
+// started at start and finished with err
+func ObservePhase(phase, function string, start time.Time, err error) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	fabricDuration.WithLabelValues(phase, function, outcome).Observe(time.Since(start).Seconds())
+}
+
+// CountError records a failed Fabric call by its error code
+func CountError(function, code string) {
+	fabricErrors.WithLabelValues(function, code).Inc()
+}
+
+func CountRetry(function string) {
+	fabricRetries.WithLabelValues(function).Inc()
+}
+
+func CountRetryExhausted(function string) {
+	fabricRetriesExhausted.WithLabelValues(function).Inc()
+}
+
+func CountQueueRejected(function string) {
+	fabricQueueRejected.WithLabelValues(function).Inc()
+}
+
+// CountCache records whether an evaluation was served from the cache
+func CountCache(function, result string) {
+	cacheRequests.WithLabelValues(function, result).Inc()
+}
+
+func CountCacheInvalidations(entries int) {
+	cacheInvalidations.Add(float64(entries))
+}
+
+// RegisterGauges exposes values owned by the Fabric client. They are passed
+// as functions so this package does not depend on the client.
+func RegisterGauges(inFlight, listenerBlock func() float64) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_fabric_transactions_in_flight",
+			Help: "Transactions submitted and not yet known to be committed.",
+		}, inFlight),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_event_listener_block_height",
+			Help: "Number of the last block received by the block event listener.",
+		}, listenerBlock),
+	)
+}
+
+// RegisterOutboxGauges exposes the depth of the telemetry outbox
+func RegisterOutboxGauges(pending, deadLetters, unknown func() float64) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_outbox_pending",
+			Help: "Telemetry readings accepted and waiting to be submitted.",
+		}, pending),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_outbox_dead_letters",
+			Help: "Telemetry readings that could not be submitted and need replay.",
+		}, deadLetters),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_outbox_unknown",
+			Help: "Telemetry readings that may have been committed and need checking.",
+		}, unknown),
+	)
+}
+
+// RegisterQueueGauges exposes the state of the submission queue
+func RegisterQueueGauges(queued, running func() float64) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_fabric_queue_depth",
+			Help: "Submissions waiting for a worker.",
+		}, queued),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gateway_fabric_queue_running",
+			Help: "Submissions being endorsed, ordered or committed by a worker.",
+		}, running),
+	)
+}
+
+// RegisterCacheGauge exposes the number of cached evaluation results
+func RegisterCacheGauge(entries func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gateway_evaluate_cache_entries",
+		Help: "Evaluation results currently cached.",
+	}, entries))
+}
@@ -0,0 +1,13 @@
+//go:build mock
+
+package main
+
+import (
+	"fabric-gateway/fabric"
+	"fabric-gateway/mockledger"
+)
+
+// newMockLedger creates the in-memory ledger used with FABRIC_MODE=mock
+func newMockLedger() (fabric.Ledger, error) {
+	return mockledger.New("mychannel", "vehicle")
+}
@@ -0,0 +1,319 @@
+//go:build mock
+
+package mockledger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fabric-gateway/fabric"
+	"fabric-gateway/logging"
+	_ "fabric-gateway/mockledger/protoconflict"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"vehicle-contract/contract"
+)
+
+// Peer is reported as the peer address by the readiness check
+const Peer = "mock"
+
+// Ledger runs the vehicle contract in process against an in-memory world
+// state, so the gateway can be used without a Fabric network. Submissions
+// are applied one at a time and each one is a block, so there are no MVCC
+// conflicts. Key-level endorsement policies are stored but not enforced, as
+// there is only one organization. The state is lost when the gateway stops.
+type Ledger struct {
+	channelName   string
+	chaincodeName string
+	chaincode     *contractapi.ContractChaincode
+	creator       []byte
+
+	mu         sync.RWMutex
+	state      map[string][]byte
+	keys       []string // sorted keys of state, for ranges and queries
+	validation map[string][]byte
+	history    map[string][]*queryresult.KeyModification
+	height     uint64
+	lastEvent  time.Time
+	statuses   map[string]*fabric.TxStatus
+
+	closing atomic.Bool
+}
+
+var _ fabric.Ledger = (*Ledger)(nil)
+
+// New creates an empty ledger running the vehicle contract
+func New(channelName, chaincodeName string) (*Ledger, error) {
+	// POLICE_MSP_ID is read as the chaincode reads it; setting it to MSPID
+	// lets the one mock organization report thefts as well
+	chaincode, err := contractapi.NewChaincode(&contract.VehicleContract{
+		AdminMSPID:  MSPID,
+		PoliceMSPID: os.Getenv("POLICE_MSP_ID"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chaincode: %w", err)
+	}
+	creator, err := newCreator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity: %w", err)
+	}
+	slog.Info("using in-process mock ledger", "channel", channelName, "chaincode", chaincodeName)
+
+	return &Ledger{
+		channelName:   channelName,
+		chaincodeName: chaincodeName,
+		chaincode:     chaincode,
+		creator:       creator,
+		state:         make(map[string][]byte),
+		validation:    make(map[string][]byte),
+		history:       make(map[string][]*queryresult.KeyModification),
+		// Block 0 is the genesis block, as on a real channel
+		height:   1,
+		statuses: make(map[string]*fabric.TxStatus),
+	}, nil
+}
+
+// SubmitTransaction runs the transaction and commits its writes
+func (l *Ledger) SubmitTransaction(ctx context.Context, funcName string, args ...string) (string, error) {
+	status, result, err := l.submit(ctx, funcName, args)
+	if err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "transaction committed", "function", funcName, "txId", status.TxID)
+	return string(result), nil
+}
+
+// SubmitAsync runs and commits the transaction like SubmitTransaction, but
+// returns its ID; the status is immediately COMMITTED
+func (l *Ledger) SubmitAsync(ctx context.Context, funcName string, args ...string) (string, error) {
+	status, _, err := l.submit(ctx, funcName, args)
+	if err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "transaction committed", "function", funcName, "txId", status.TxID)
+	return status.TxID, nil
+}
+
+// EvaluateTransaction runs the transaction and discards its writes
+func (l *Ledger) EvaluateTransaction(ctx context.Context, funcName string, args ...string) (string, error) {
+	logCall(ctx, "evaluating transaction", funcName, args)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, result, err := l.invoke(ctx, funcName, args)
+	if err != nil {
+		slog.WarnContext(ctx, "evaluation failed", "function", funcName,
+			"code", fabric.ClassifyError(err).Code, "error", err)
+		return "", fmt.Errorf("failed to evaluate transaction %s: %w", funcName, err)
+	}
+	return string(result), nil
+}
+
+// TransactionStatus returns the status recorded by SubmitAsync, or nil if
+// the transaction is unknown
+func (l *Ledger) TransactionStatus(txID string) (*fabric.TxStatus, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	status, ok := l.statuses[txID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *status
+	return &copied, nil
+}
+
+// ChannelOrganizations returns the one organization every transaction is
+// made by
+func (l *Ledger) ChannelOrganizations(ctx context.Context) ([]string, error) {
+	return []string{MSPID}, nil
+}
+
+// CheckReadiness reports the ledger as ready as long as the contract answers
+func (l *Ledger) CheckReadiness(ctx context.Context) *fabric.Readiness {
+	readiness := &fabric.Readiness{
+		Ready:           true,
+		Peer:            Peer,
+		ConnectionState: "READY",
+		Endpoints:       []fabric.EndpointStatus{},
+		EventListener:   l.ListenerStatus(),
+	}
+
+	result, err := l.EvaluateTransaction(ctx, "org.hyperledger.fabric:GetMetadata")
+	if err == nil {
+		readiness.Chaincode, err = fabric.ParseChaincodeInfo(l.chaincodeName, []byte(result))
+	}
+	if err != nil {
+		readiness.Ready = false
+		readiness.Errors = append(readiness.Errors, fmt.Sprintf("chaincode check failed: %v", err))
+	}
+
+	l.mu.RLock()
+	readiness.ChannelHeight = l.height
+	l.mu.RUnlock()
+	return readiness
+}
+
+// ListenerStatus reports the last committed block. Commits are applied
+// synchronously, so the mock never lags behind.
+func (l *Ledger) ListenerStatus() fabric.ListenerStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return fabric.ListenerStatus{Running: true, LastBlock: l.height - 1, LastEvent: l.lastEvent}
+}
+
+// InFlight is always zero: submissions return once committed
+func (l *Ledger) InFlight() int64 {
+	return 0
+}
+
+// QueueDepth is always zero: submissions are not queued
+func (l *Ledger) QueueDepth() (queued, running int) {
+	return 0, 0
+}
+
+// CacheSize is always zero: evaluations are not cached
+func (l *Ledger) CacheSize() int {
+	return 0
+}
+
+// Shutdown rejects new submissions and waits for the running one
+func (l *Ledger) Shutdown(ctx context.Context) error {
+	l.closing.Store(true)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return nil
+}
+
+func (l *Ledger) submit(ctx context.Context, funcName string, args []string) (*fabric.TxStatus, []byte, error) {
+	if l.closing.Load() {
+		return nil, nil, fabric.ErrShuttingDown
+	}
+	logCall(ctx, "submitting transaction", funcName, args)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stub, result, err := l.invoke(ctx, funcName, args)
+	if err != nil {
+		slog.ErrorContext(ctx, "transaction failed", "function", funcName,
+			"code", fabric.ClassifyError(err).Code, "error", err)
+		return nil, nil, fmt.Errorf("failed to submit transaction %s: %w", funcName, err)
+	}
+
+	blockNumber := l.commit(stub)
+	status := &fabric.TxStatus{
+		TxID:           stub.txID,
+		Function:       funcName,
+		Status:         fabric.TxStatusCommitted,
+		ValidationCode: "VALID",
+		BlockNumber:    blockNumber,
+		SubmittedAt:    stub.timestamp,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	l.statuses[status.TxID] = status
+	return status, result, nil
+}
+
+// invoke runs the contract through the contract API, exactly as the peer
+// would, with the trace context and acting user in the transient map
+func (l *Ledger) invoke(ctx context.Context, funcName string, args []string) (*stub, []byte, error) {
+	stub := newStub(l, newTxID(), funcName, args, fabric.Transient(ctx))
+	response := l.chaincode.Invoke(stub)
+	if response.GetStatus() >= shim.ERRORTHRESHOLD {
+		return stub, nil, fabric.ChaincodeError(stub.txID, response.GetMessage())
+	}
+	return stub, response.GetPayload(), nil
+}
+
+// commit applies the writes of stub as a new block and returns its number
+func (l *Ledger) commit(stub *stub) uint64 {
+	blockNumber := l.height
+	timestamp := timestamppb.New(stub.timestamp)
+	keysChanged := false
+
+	for key, value := range stub.writes {
+		if _, exists := l.state[key]; !exists {
+			keysChanged = true
+		}
+		l.state[key] = value
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      stub.txID,
+			Value:     value,
+			Timestamp: timestamp,
+		})
+	}
+	for key := range stub.deletes {
+		if _, exists := l.state[key]; !exists {
+			continue
+		}
+		keysChanged = true
+		delete(l.state, key)
+		delete(l.validation, key)
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      stub.txID,
+			Timestamp: timestamp,
+			IsDelete:  true,
+		})
+	}
+	for key, ep := range stub.validation {
+		l.validation[key] = ep
+	}
+
+	if keysChanged {
+		l.keys = l.keys[:0]
+		for key := range l.state {
+			l.keys = append(l.keys, key)
+		}
+		sort.Strings(l.keys)
+	}
+
+	l.height++
+	l.lastEvent = time.Now().UTC()
+	return blockNumber
+}
+
+// keysInRange returns the keys from startKey (inclusive) to endKey
+// (exclusive); an empty endKey leaves the range open
+func (l *Ledger) keysInRange(startKey, endKey string) []string {
+	start := sort.SearchStrings(l.keys, startKey)
+	end := len(l.keys)
+	if endKey != "" {
+		end = sort.SearchStrings(l.keys, endKey)
+	}
+	if end < start {
+		end = start
+	}
+	return append([]string(nil), l.keys[start:end]...)
+}
+
+func newTxID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", 64)
+	}
+	return hex.EncodeToString(b)
+}
+
+// logCall mirrors the Fabric client: arguments are only logged at debug
+// level when payload logging is enabled
+func logCall(ctx context.Context, msg, funcName string, args []string) {
+	attrs := []any{"function", funcName, "argCount", len(args)}
+	if logging.PayloadsEnabled() {
+		attrs = append(attrs, "args", args)
+	}
+	slog.DebugContext(ctx, msg, attrs...)
+}
@@ -0,0 +1,24 @@
+//go:build mock
+
+// Package protoconflict lets the chaincode shim be linked next to the Fabric
+// gateway SDK. The shim is built on fabric-protos-go and the SDK on
+// fabric-protos-go-apiv2; both register the same protobuf names, and the
+// protobuf runtime panics on the second registration unless told otherwise.
+//
+// Packages are initialized in import path order once their own imports are,
+// so this package, which only imports os, runs before either set of protos
+// and the later registration of each name is ignored. Both sides decode into
+// their own concrete types, so it does not matter which one the registry
+// keeps; the only name the gateway looks up, gateway.ErrorDetail in gRPC
+// status details, is not part of the shim.
+package protoconflict
+
+import "os"
+
+const policyEnv = "GOLANG_PROTOBUF_REGISTRATION_CONFLICT"
+
+func init() {
+	if os.Getenv(policyEnv) == "" {
+		os.Setenv(policyEnv, "ignore")
+	}
+}
@@ -0,0 +1,335 @@
+//go:build mock
+
+package mockledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// richQuery is the subset of a CouchDB Mango query the mock understands.
+// use_index and fields are accepted and ignored: every document is scanned
+// and returned whole.
+type richQuery struct {
+	Selector map[string]any `json:"selector"`
+	Sort     []any          `json:"sort"`
+	Limit    int            `json:"limit"`
+	Skip     int            `json:"skip"`
+	UseIndex any            `json:"use_index"`
+	Fields   []string       `json:"fields"`
+}
+
+type sortField struct {
+	field      string
+	descending bool
+}
+
+// query runs a rich query against the committed state and returns the
+// matching keys, in key order unless the query sorts them
+func (l *Ledger) query(queryString string) ([]string, error) {
+	var q richQuery
+	if err := decodeJSON([]byte(queryString), &q); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	if q.Selector == nil {
+		return nil, fmt.Errorf("invalid query: selector is required")
+	}
+	sortFields, err := parseSort(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	docs := make(map[string]map[string]any)
+	for _, key := range l.keys {
+		var doc map[string]any
+		if decodeJSON(l.state[key], &doc) != nil || doc == nil {
+			continue
+		}
+		ok, err := matchSelector(q.Selector, doc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, key)
+			docs[key] = doc
+		}
+	}
+
+	if len(sortFields) > 0 {
+		sort.SliceStable(keys, func(i, j int) bool {
+			for _, f := range sortFields {
+				a, _ := lookupField(docs[keys[i]], f.field)
+				b, _ := lookupField(docs[keys[j]], f.field)
+				if c := collate(a, b); c != 0 {
+					return (c < 0) != f.descending
+				}
+			}
+			return false
+		})
+	}
+
+	if q.Skip > 0 {
+		keys = keys[min(q.Skip, len(keys)):]
+	}
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+	}
+	return keys, nil
+}
+
+// decodeJSON keeps numbers as json.Number so they compare exactly
+func decodeJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// parseSort accepts ["field"] and [{"field": "asc"|"desc"}]
+func parseSort(spec []any) ([]sortField, error) {
+	var fields []sortField
+	for _, entry := range spec {
+		switch entry := entry.(type) {
+		case string:
+			fields = append(fields, sortField{field: entry})
+		case map[string]any:
+			for field, direction := range entry {
+				switch direction {
+				case "asc":
+					fields = append(fields, sortField{field: field})
+				case "desc":
+					fields = append(fields, sortField{field: field, descending: true})
+				default:
+					return nil, fmt.Errorf("invalid sort direction %v for %s", direction, field)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("invalid sort entry %v", entry)
+		}
+	}
+	return fields, nil
+}
+
+// matchSelector reports whether doc satisfies every condition of selector
+func matchSelector(selector map[string]any, doc map[string]any) (bool, error) {
+	for field, condition := range selector {
+		ok, err := matchField(field, condition, doc)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchField(field string, condition any, doc map[string]any) (bool, error) {
+	switch field {
+	case "$and", "$or", "$nor":
+		selectors, ok := condition.([]any)
+		if !ok {
+			return false, fmt.Errorf("%s expects an array of selectors", field)
+		}
+		matched := 0
+		for _, s := range selectors {
+			sub, ok := s.(map[string]any)
+			if !ok {
+				return false, fmt.Errorf("%s expects an array of selectors", field)
+			}
+			ok, err := matchSelector(sub, doc)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				matched++
+			}
+		}
+		switch field {
+		case "$and":
+			return matched == len(selectors), nil
+		case "$or":
+			return matched > 0, nil
+		default:
+			return matched == 0, nil
+		}
+	case "$not":
+		sub, ok := condition.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("$not expects a selector")
+		}
+		ok, err := matchSelector(sub, doc)
+		return !ok, err
+	}
+	if strings.HasPrefix(field, "$") {
+		return false, fmt.Errorf("selector operator %s is not supported by the mock ledger", field)
+	}
+
+	value, present := lookupField(doc, field)
+	return matchCondition(value, present, condition)
+}
+
+// matchCondition applies an operator object such as {"$gte": 1}, a nested
+// selector, or an implicit equality to one field
+func matchCondition(value any, present bool, condition any) (bool, error) {
+	operators, ok := condition.(map[string]any)
+	if !ok {
+		return present && equal(value, condition), nil
+	}
+	if !hasOperators(operators) {
+		nested, ok := value.(map[string]any)
+		if !ok {
+			return false, nil
+		}
+		return matchSelector(operators, nested)
+	}
+
+	for operator, operand := range operators {
+		ok, err := applyOperator(operator, operand, value, present)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func applyOperator(operator string, operand, value any, present bool) (bool, error) {
+	if operator == "$exists" {
+		want, ok := operand.(bool)
+		if !ok {
+			return false, fmt.Errorf("$exists expects a boolean")
+		}
+		return present == want, nil
+	}
+	// As in CouchDB, a missing field only matches $exists: false
+	if !present {
+		return false, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return equal(value, operand), nil
+	case "$ne":
+		return !equal(value, operand), nil
+	case "$gt":
+		return collate(value, operand) > 0, nil
+	case "$gte":
+		return collate(value, operand) >= 0, nil
+	case "$lt":
+		return collate(value, operand) < 0, nil
+	case "$lte":
+		return collate(value, operand) <= 0, nil
+	case "$in", "$nin":
+		candidates, ok := operand.([]any)
+		if !ok {
+			return false, fmt.Errorf("%s expects an array", operator)
+		}
+		found := false
+		for _, candidate := range candidates {
+			if equal(value, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$regex":
+		pattern, ok := operand.(string)
+		if !ok {
+			return false, fmt.Errorf("$regex expects a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid $regex: %w", err)
+		}
+		s, ok := value.(string)
+		return ok && re.MatchString(s), nil
+	}
+	return false, fmt.Errorf("selector operator %s is not supported by the mock ledger", operator)
+}
+
+func hasOperators(condition map[string]any) bool {
+	for key := range condition {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupField resolves a dotted field path such as "location.lat"
+func lookupField(doc map[string]any, path string) (any, bool) {
+	var value any = doc
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func equal(a, b any) bool {
+	switch a.(type) {
+	case []any, map[string]any:
+		return reflect.DeepEqual(a, b)
+	}
+	return collate(a, b) == 0
+}
+
+// collate orders JSON values the way CouchDB does: null, false, true,
+// numbers, strings, arrays, objects. Arrays and objects of the same type
+// are not ordered further.
+func collate(a, b any) int {
+	if ra, rb := collationRank(a), collationRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if !a {
+			return -1
+		}
+		return 1
+	case json.Number:
+		x, _ := a.Float64()
+		y, _ := b.(json.Number).Float64()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+func collationRank(v any) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case json.Number:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	default:
+		return 6
+	}
+}
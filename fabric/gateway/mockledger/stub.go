@@ -0,0 +1,419 @@
+//go:build mock
+
+package mockledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	compositeKeyNamespace = "\x00"
+	minUnicodeRuneValue   = 0
+	maxUnicodeRuneValue   = utf8.MaxRune
+	// emptyKeySubstitute starts an open range after every composite key,
+	// matching the peer's handling of GetStateByRange("", "")
+	emptyKeySubstitute = "\x01"
+)
+
+var errNotSupported = errors.New("not supported by the mock ledger")
+
+// stub is the ChaincodeStubInterface handed to the contract for one
+// transaction. Reads see the committed state only, as on a peer; writes are
+// collected and applied by the ledger if the transaction is submitted.
+type stub struct {
+	ledger    *Ledger
+	txID      string
+	timestamp time.Time
+	args      [][]byte
+	transient map[string][]byte
+
+	writes     map[string][]byte
+	deletes    map[string]bool
+	validation map[string][]byte
+	event      *pb.ChaincodeEvent
+}
+
+func newStub(ledger *Ledger, txID string, funcName string, args []string, transient map[string][]byte) *stub {
+	s := &stub{
+		ledger:     ledger,
+		txID:       txID,
+		timestamp:  time.Now().UTC(),
+		args:       [][]byte{[]byte(funcName)},
+		transient:  transient,
+		writes:     make(map[string][]byte),
+		deletes:    make(map[string]bool),
+		validation: make(map[string][]byte),
+	}
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	return s
+}
+
+func (s *stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *stub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+func (s *stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func (s *stub) GetArgsSlice() ([]byte, error) {
+	var slice []byte
+	for _, arg := range s.args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+func (s *stub) GetTxID() string {
+	return s.txID
+}
+
+func (s *stub) GetChannelID() string {
+	return s.ledger.channelName
+}
+
+func (s *stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	return shim.Error(fmt.Sprintf("invoking chaincode %s: %v", chaincodeName, errNotSupported))
+}
+
+func (s *stub) GetState(key string) ([]byte, error) {
+	return s.ledger.state[key], nil
+}
+
+func (s *stub) PutState(key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("value for key %q is empty", key)
+	}
+	s.writes[key] = value
+	delete(s.deletes, key)
+	return nil
+}
+
+func (s *stub) DelState(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.deletes[key] = true
+	delete(s.writes, key)
+	return nil
+}
+
+func (s *stub) SetStateValidationParameter(key string, ep []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.validation[key] = ep
+	return nil
+}
+
+func (s *stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return s.ledger.validation[key], nil
+}
+
+func (s *stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return s.kvIterator(s.ledger.keysInRange(startKey, endKey)), nil
+}
+
+func (s *stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	keys, metadata := rangePage(s.ledger.keysInRange(startKey, endKey), pageSize, bookmark)
+	return s.kvIterator(keys), metadata, nil
+}
+
+func (s *stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return s.kvIterator(s.ledger.keysInRange(startKey, endKey)), nil
+}
+
+func (s *stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, metadata := rangePage(s.ledger.keysInRange(startKey, endKey), pageSize, bookmark)
+	return s.kvIterator(page), metadata, nil
+}
+
+func (s *stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	components := strings.Split(compositeKey, string(rune(minUnicodeRuneValue)))
+	if len(components) < 3 || components[0] != "" || components[len(components)-1] != "" {
+		return "", nil, fmt.Errorf("invalid composite key %q", compositeKey)
+	}
+	return components[1], components[2 : len(components)-1], nil
+}
+
+func (s *stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	keys, err := s.ledger.query(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.kvIterator(keys), nil
+}
+
+func (s *stub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	keys, err := s.ledger.query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, metadata, err := queryPage(keys, pageSize, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.kvIterator(page), metadata, nil
+}
+
+// GetHistoryForKey returns the committed values of key, newest first
+func (s *stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	entries := s.ledger.history[key]
+	modifications := make([]*queryresult.KeyModification, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		modifications = append(modifications, entries[i])
+	}
+	return &historyIterator{modifications: modifications}, nil
+}
+
+func (s *stub) GetPrivateData(collection, key string) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) PutPrivateData(collection string, key string, value []byte) error {
+	return errNotSupported
+}
+
+func (s *stub) DelPrivateData(collection, key string) error {
+	return errNotSupported
+}
+
+func (s *stub) PurgePrivateData(collection, key string) error {
+	return errNotSupported
+}
+
+func (s *stub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return errNotSupported
+}
+
+func (s *stub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errNotSupported
+}
+
+// GetCreator returns the ledger's identity, an MSPID member
+func (s *stub) GetCreator() ([]byte, error) {
+	return s.ledger.creator, nil
+}
+
+func (s *stub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+func (s *stub) GetDecorations() map[string][]byte {
+	return nil
+}
+
+func (s *stub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return nil, errNotSupported
+}
+
+func (s *stub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.timestamp), nil
+}
+
+func (s *stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be empty string")
+	}
+	s.event = &pb.ChaincodeEvent{EventName: name, Payload: payload, TxId: s.txID}
+	return nil
+}
+
+func (s *stub) kvIterator(keys []string) *kvIterator {
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		results[i] = &queryresult.KV{Namespace: s.ledger.chaincodeName, Key: key, Value: s.ledger.state[key]}
+	}
+	return &kvIterator{results: results}
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key %q is not valid UTF-8", key)
+	}
+	return nil
+}
+
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+func partialCompositeKeyRange(objectType string, keys []string) (string, string, error) {
+	partialKey, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return "", "", err
+	}
+	return partialKey, partialKey + string(rune(maxUnicodeRuneValue)), nil
+}
+
+// rangePage returns the page of sorted keys starting at bookmark, which is
+// the first key of the page, and the bookmark of the next page. The last page
+// has an empty bookmark.
+func rangePage(keys []string, pageSize int32, bookmark string) ([]string, *pb.QueryResponseMetadata) {
+	start := 0
+	if bookmark != "" {
+		start = sort.SearchStrings(keys, bookmark)
+	}
+
+	page, more := slicePage(keys, start, pageSize)
+	next := ""
+	if more {
+		next = keys[start+len(page)]
+	}
+	return page, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(page)), Bookmark: next}
+}
+
+// queryPage pages rich query results, which may be sorted on any field, so
+// the bookmark is the offset of the page
+func queryPage(keys []string, pageSize int32, bookmark string) ([]string, *pb.QueryResponseMetadata, error) {
+	start := 0
+	if bookmark != "" {
+		var err error
+		if start, err = strconv.Atoi(bookmark); err != nil || start < 0 {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+	}
+
+	page, more := slicePage(keys, start, pageSize)
+	next := ""
+	if more {
+		next = strconv.Itoa(start + len(page))
+	}
+	return page, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(page)), Bookmark: next}, nil
+}
+
+func slicePage(keys []string, start int, pageSize int32) ([]string, bool) {
+	if start > len(keys) {
+		start = len(keys)
+	}
+	keys = keys[start:]
+	if pageSize > 0 && len(keys) > int(pageSize) {
+		return keys[:pageSize], true
+	}
+	return keys, false
+}
+
+type kvIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *kvIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *kvIterator) Next() (*queryresult.KV, error) {
+	if len(it.results) == 0 {
+		return nil, errors.New("no more results")
+	}
+	next := it.results[0]
+	it.results = it.results[1:]
+	return next, nil
+}
+
+func (it *kvIterator) Close() error {
+	return nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, errors.New("no more results")
+	}
+	next := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return next, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
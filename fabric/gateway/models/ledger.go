@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Vehicle is a vehicle asset as returned by the chaincode. Ownership is the
+// sequence of the current ownership period.
+type Vehicle struct {
+	OnChainID       string    `json:"onChainId"`
+	VIN             string    `json:"vin"`
+	OwnerUserID     string    `json:"ownerUserId"`
+	OwnerMSPID      string    `json:"ownerMspId"`
+	Ownership       int       `json:"ownership"`
+	RegisteredAt    time.Time `json:"registeredAt"`
+	Status          string    `json:"status"`
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+	StatusChangedBy string    `json:"statusChangedBy"`
+}
+
+// Ownership is one period of a vehicle's ownership chain. To is unset for
+// the current owner.
+type Ownership struct {
+	OnChainID   string     `json:"onChainId"`
+	Sequence    int        `json:"sequence"`
+	OwnerUserID string     `json:"ownerUserId"`
+	OwnerMSPID  string     `json:"ownerMspId"`
+	From        time.Time  `json:"from"`
+	To          *time.Time `json:"to,omitempty"`
+	TxID        string     `json:"txId"`
+}
+
+// TransferProposal is a vehicle transfer awaiting the new owner
+type TransferProposal struct {
+	OnChainID  string    `json:"onChainId"`
+	FromUserID string    `json:"fromUserId"`
+	FromMSPID  string    `json:"fromMspId"`
+	ToUserID   string    `json:"toUserId"`
+	ToMSPID    string    `json:"toMspId"`
+	ProposedAt time.Time `json:"proposedAt"`
+	TxID       string    `json:"txId"`
+}
+
+// RoleAssignment gives a user an OWNER, DRIVER or VIEWER role on a vehicle
+type RoleAssignment struct {
+	OnChainID  string    `json:"onChainId"`
+	UserID     string    `json:"userId"`
+	MSPID      string    `json:"mspId"`
+	Role       string    `json:"role"`
+	AssignedBy string    `json:"assignedBy"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
+
+// Invitation offers a user a role on a vehicle. Status is PENDING,
+// ACCEPTED, DECLINED or CANCELLED.
+type Invitation struct {
+	InviteID      string    `json:"inviteId"`
+	OnChainID     string    `json:"onChainId"`
+	InviterUserID string    `json:"inviterUserId"`
+	InvitedUserID string    `json:"invitedUserId"`
+	InvitedMSPID  string    `json:"invitedMspId"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// AccessGrant gives an insurance company read access to a vehicle's data
+// during one ownership period
+type AccessGrant struct {
+	OnChainID          string    `json:"onChainId"`
+	InsuranceCompanyID string    `json:"insuranceCompanyId"`
+	InsuranceMSPID     string    `json:"insuranceMspId,omitempty"`
+	Ownership          int       `json:"ownership"`
+	GrantedAt          time.Time `json:"grantedAt"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+}
+
+// VehicleHistoryEntry is one ledger modification of a vehicle asset
+type VehicleHistoryEntry struct {
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Record    *Vehicle  `json:"record"`
+}
+
+// VehiclePage is one page of a paginated vehicle query
+type VehiclePage struct {
+	Records             []Vehicle `json:"records"`
+	FetchedRecordsCount int32     `json:"fetchedRecordsCount"`
+	Bookmark            string    `json:"bookmark"`
+}
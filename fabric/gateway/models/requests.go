@@ -6,20 +6,94 @@ type RegisterVehicleRequest struct {
 	OwnerUserID string `json:"ownerUserId" binding:"required"`
 }
 
+// ProposeTransferRequest offers a vehicle to a new owner. NewOwnerMSPID
+// defaults to the current owner's organization.
+type ProposeTransferRequest struct {
+	OwnerUserID    string `json:"ownerUserId" binding:"required"`
+	NewOwnerUserID string `json:"newOwnerUserId" binding:"required"`
+	NewOwnerMSPID  string `json:"newOwnerMspId"`
+}
+
+// UserActionRequest names the user accepting, declining or cancelling a
+// transfer or invitation
+type UserActionRequest struct {
+	UserID string `json:"userId" binding:"required"`
+}
+
+// VehicleStatusRequest moves a vehicle along its lifecycle. SOLD is reached
+// by accepting a transfer, so it cannot be set here.
+type VehicleStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=ACTIVE STOLEN SCRAPPED"`
+}
+
+// AssignRoleRequest gives the user in the path a role on a vehicle.
+// OwnerUserID must be an owner; MSPID defaults to the user's current
+// organization, or the owner's for a new assignment.
+type AssignRoleRequest struct {
+	OwnerUserID string `json:"ownerUserId" binding:"required"`
+	MSPID       string `json:"mspId"`
+	Role        string `json:"role" binding:"required,oneof=OWNER DRIVER VIEWER"`
+}
+
+// InviteUserRequest offers a user a role on a vehicle. InvitedMSPID
+// defaults to the inviter's organization.
+type InviteUserRequest struct {
+	InviterUserID string `json:"inviterUserId" binding:"required"`
+	InvitedUserID string `json:"invitedUserId" binding:"required"`
+	InvitedMSPID  string `json:"invitedMspId"`
+	Role          string `json:"role" binding:"required,oneof=OWNER DRIVER VIEWER"`
+}
+
 type SubmitHashRequest struct {
 	OnChainID string `json:"onChainId" binding:"required"`
 	DataHash  string `json:"dataHash" binding:"required"`
 }
 
+// GrantAccessRequest gives an insurance company access to a vehicle.
+// InsuranceMSPID is the company's organization on the channel, if it has
+// one; it may then locate the vehicle if it is stolen while the grant runs.
 type GrantAccessRequest struct {
 	OnChainID          string `json:"onChainId" binding:"required"`
 	InsuranceCompanyID string `json:"insuranceCompanyId" binding:"required"`
+	InsuranceMSPID     string `json:"insuranceMspId"`
 	DurationDays       int    `json:"durationDays" binding:"required,min=1"`
 }
 
+// CreateAPIKeyRequest describes a client key. Routes are gin route patterns,
+// optionally prefixed with a method, and may end in *; Vehicles lists car
+// IDs or "*" for all; Users lists the backend users the key may act for, or
+// "*" for a backend that signs in its own users.
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Routes        []string `json:"routes" binding:"required,min=1"`
+	Vehicles      []string `json:"vehicles" binding:"required,min=1"`
+	Users         []string `json:"users"`
+	RatePerSecond float64  `json:"ratePerSecond" binding:"min=0"`
+	Burst         int      `json:"burst" binding:"min=0"`
+	DailyQuota    int64    `json:"dailyQuota" binding:"min=0"`
+}
+
 type Response struct {
 	Success bool   `json:"success"`
 	Result  string `json:"result,omitempty"`
 	TxID    string `json:"txId,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
+
+// ErrorResponse is the envelope returned by every handler on failure
+type ErrorResponse struct {
+	Success bool          `json:"success"`
+	Error   string        `json:"error"`
+	Code    string        `json:"code"`
+	TxID    string        `json:"txId,omitempty"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail carries the message reported by an individual peer, or for
+// rejected requests the offending field
+type ErrorDetail struct {
+	Address string `json:"address,omitempty"`
+	MSPID   string `json:"mspId,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,15 @@
+//go:build !mock
+
+package main
+
+import (
+	"errors"
+
+	"fabric-gateway/fabric"
+)
+
+// newMockLedger fails in production builds, which leave out the chaincode
+// shim and the protobuf registration override it needs
+func newMockLedger() (fabric.Ledger, error) {
+	return nil, errors.New("built without the mock ledger; rebuild with -tags mock")
+}
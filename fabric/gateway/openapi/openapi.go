@@ -0,0 +1,336 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"fabric-gateway/models"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// Operation documents a gin route. Request and Responses hold zero values of
+// the Go types bound or rendered by the handler; their schemas are generated
+// from the json and binding struct tags.
+type Operation struct {
+	ID      string
+	Summary string
+	Tags    []string
+	// Security names the scheme, added with APIKeyScheme, that the route
+	// requires
+	Security  string
+	Query     []Parameter
+	Request   any
+	Responses map[int]any
+}
+
+// Parameter documents a query parameter
+type Parameter struct {
+	Name        string
+	Description string
+	Required    bool
+	// Type is a JSON schema type; string when empty
+	Type   string
+	Format string
+}
+
+// Spec collects operation descriptions and turns the gin route table into
+// an OpenAPI 3 document
+type Spec struct {
+	title      string
+	version    string
+	operations map[string]Operation
+	security   openapi3.SecuritySchemes
+
+	doc     *openapi3.T
+	payload []byte
+	routes  map[string]*routers.Route
+}
+
+// New returns an empty specification
+func New(title, version string) *Spec {
+	return &Spec{
+		title:      title,
+		version:    version,
+		operations: make(map[string]Operation),
+		security:   openapi3.SecuritySchemes{},
+	}
+}
+
+// APIKeyScheme declares a security scheme that reads a key from header
+func (s *Spec) APIKeyScheme(name, header, description string) {
+	scheme := openapi3.NewSecurityScheme()
+	scheme.Type = "apiKey"
+	scheme.In = "header"
+	scheme.Name = header
+	scheme.Description = description
+	s.security[name] = &openapi3.SecuritySchemeRef{Value: scheme}
+}
+
+// Describe attaches documentation to the route registered with gin under
+// method and path, e.g. "/api/telemetry/vehicle/:carId"
+func (s *Spec) Describe(method, path string, op Operation) {
+	s.operations[routeKey(method, path)] = op
+}
+
+// Build generates the document from the registered routes. It must run after
+// all routes are added and before the server starts.
+func (s *Spec) Build(routes gin.RoutesInfo) error {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:   s.title,
+			Version: s.version,
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas:         openapi3.Schemas{},
+			SecuritySchemes: s.security,
+		},
+	}
+
+	errorSchema, err := schemaFor(doc, models.ErrorResponse{})
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		key := routeKey(route.Method, route.Path)
+		registered[key] = true
+
+		op, documented := s.operations[key]
+		operation := openapi3.NewOperation()
+		operation.OperationID = op.ID
+		operation.Summary = op.Summary
+		operation.Tags = op.Tags
+		if op.Security != "" {
+			operation.Security = openapi3.NewSecurityRequirements().
+				With(openapi3.NewSecurityRequirement().Authenticate(op.Security))
+		}
+
+		for _, name := range pathParams(route.Path) {
+			operation.AddParameter(openapi3.NewPathParameter(name).WithSchema(openapi3.NewStringSchema()))
+		}
+		for _, param := range op.Query {
+			schema := &openapi3.Schema{Type: param.Type, Format: param.Format}
+			if schema.Type == "" {
+				schema.Type = openapi3.TypeString
+			}
+			operation.AddParameter(openapi3.NewQueryParameter(param.Name).
+				WithDescription(param.Description).
+				WithRequired(param.Required).
+				WithSchema(schema))
+		}
+
+		if op.Request != nil {
+			schema, err := schemaFor(doc, op.Request)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", route.Method, route.Path, err)
+			}
+			operation.RequestBody = &openapi3.RequestBodyRef{
+				Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(schema),
+			}
+		}
+
+		operation.Responses = openapi3.NewResponsesWithCapacity(len(op.Responses) + 2)
+		for status, body := range op.Responses {
+			response := openapi3.NewResponse().WithDescription(http.StatusText(status))
+			if body != nil {
+				schema, err := schemaFor(doc, body)
+				if err != nil {
+					return fmt.Errorf("%s %s: %w", route.Method, route.Path, err)
+				}
+				response.WithJSONSchemaRef(schema)
+			}
+			operation.AddResponse(status, response)
+		}
+		if len(op.Responses) == 0 {
+			operation.AddResponse(http.StatusOK, openapi3.NewResponse().WithDescription(http.StatusText(http.StatusOK)))
+		}
+		if documented {
+			if op.Request != nil || len(operation.Parameters) > 0 {
+				operation.AddResponse(http.StatusBadRequest, openapi3.NewResponse().
+					WithDescription("Request failed validation").
+					WithJSONSchemaRef(errorSchema))
+			}
+			operation.Responses.Set("default", &openapi3.ResponseRef{Value: openapi3.NewResponse().
+				WithDescription("Error").
+				WithJSONSchemaRef(errorSchema)})
+		}
+
+		path := openAPIPath(route.Path)
+		item := doc.Paths.Value(path)
+		if item == nil {
+			item = &openapi3.PathItem{}
+			doc.Paths.Set(path, item)
+		}
+		item.SetOperation(route.Method, operation)
+	}
+
+	for key := range s.operations {
+		if !registered[key] {
+			slog.Warn("documented route is not registered", "route", key)
+		}
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+
+	s.routes = make(map[string]*routers.Route, len(routes))
+	for _, route := range routes {
+		path := openAPIPath(route.Path)
+		item := doc.Paths.Value(path)
+		s.routes[routeKey(route.Method, route.Path)] = &routers.Route{
+			Spec:      doc,
+			Path:      path,
+			PathItem:  item,
+			Method:    route.Method,
+			Operation: item.GetOperation(route.Method),
+		}
+	}
+	s.doc = doc
+	s.payload = payload
+	return nil
+}
+
+// Route returns the documented operation for a gin route, or nil if the
+// route is unknown or not described
+func (s *Spec) Route(method, path string) *routers.Route {
+	if _, ok := s.operations[routeKey(method, path)]; !ok {
+		return nil
+	}
+	return s.routes[routeKey(method, path)]
+}
+
+// Handler serves the generated document
+func (s *Spec) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", s.payload)
+	}
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// pathParams returns the names of the :name and *name segments of a gin path
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// openAPIPath rewrites gin's :name and *name segments as {name}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor generates the schema of v's type. Named structs are stored as
+// components and referenced, so shared models appear once in the document.
+func schemaFor(doc *openapi3.T, v any) (*openapi3.SchemaRef, error) {
+	ref, err := openapi3gen.NewSchemaRefForValue(v, nil, openapi3gen.SchemaCustomizer(bindingConstraints))
+	if err != nil {
+		return nil, err
+	}
+	return component(doc, reflect.TypeOf(v), ref), nil
+}
+
+func component(doc *openapi3.T, t reflect.Type, ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Slice && ref.Value.Items != nil:
+		schema := openapi3.NewArraySchema()
+		schema.Items = component(doc, t.Elem(), ref.Value.Items)
+		return openapi3.NewSchemaRef("", schema)
+	case t.Kind() == reflect.Struct && t.Name() != "" && t != timeType:
+		doc.Components.Schemas[t.Name()] = openapi3.NewSchemaRef("", ref.Value)
+		return openapi3.NewSchemaRef("#/components/schemas/"+t.Name(), ref.Value)
+	}
+	return ref
+}
+
+// bindingConstraints carries gin's binding tags into the schema so the
+// document rejects what ShouldBindJSON would reject: required fields must be
+// present and non-empty, min=N bounds numbers, string lengths and array
+// sizes, and oneof lists the allowed strings
+func bindingConstraints(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t.Kind() == reflect.Struct && t != timeType {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !hasRule(field.Tag.Get("binding"), "required") {
+				continue
+			}
+			jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if jsonName == "" {
+				jsonName = field.Name
+			}
+			schema.Required = append(schema.Required, jsonName)
+		}
+	}
+
+	for _, rule := range strings.Split(tag.Get("binding"), ",") {
+		switch {
+		case rule == "required" && schema.Type == openapi3.TypeString:
+			schema.MinLength = 1
+		case strings.HasPrefix(rule, "min="):
+			min, err := strconv.ParseFloat(strings.TrimPrefix(rule, "min="), 64)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid binding rule %q", name, rule)
+			}
+			switch schema.Type {
+			case openapi3.TypeString:
+				schema.MinLength = uint64(min)
+			case openapi3.TypeArray:
+				schema.MinItems = uint64(min)
+			default:
+				schema.Min = &min
+			}
+		case strings.HasPrefix(rule, "oneof=") && schema.Type == openapi3.TypeString:
+			for _, value := range strings.Fields(strings.TrimPrefix(rule, "oneof=")) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		}
+	}
+	return nil
+}
+
+func hasRule(binding, rule string) bool {
+	for _, r := range strings.Split(binding, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
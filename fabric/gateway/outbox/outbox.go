@@ -0,0 +1,438 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"fabric-gateway/fabric"
+)
+
+const (
+	// pollInterval is how often the dispatcher looks for due items when
+	// nothing wakes it earlier
+	pollInterval = time.Second
+	// pruneInterval is how often delivered items past retention are removed
+	pruneInterval = time.Minute
+	// submitFunction is the chaincode function readings are submitted with
+	submitFunction = "SubmitTelemetry"
+)
+
+// ErrItemNotFound is returned for unknown item IDs
+var ErrItemNotFound = errors.New("outbox item not found")
+
+// ErrNoTxID is returned when an item in doubt is resolved as committed
+// without the ID of the transaction that committed it
+var ErrNoTxID = errors.New("txId is required for an item without one")
+
+// Submitter submits a transaction and waits for it to commit
+type Submitter interface {
+	SubmitTransaction(ctx context.Context, funcName string, args ...string) (string, error)
+}
+
+// Config controls delivery of queued readings
+type Config struct {
+	// Workers is the number of readings submitted concurrently. Readings for
+	// the same car are always submitted one at a time, in order.
+	Workers int
+	// MaxAttempts is how many retryable failures an item may have before it
+	// is dead-lettered
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Retention is how long delivered items stay available for lookup
+	Retention time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:     4,
+		MaxAttempts: 20,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		Retention:   24 * time.Hour,
+	}
+}
+
+// Stats summarises the outbox for monitoring
+type Stats struct {
+	Pending       int        `json:"pending"`
+	InFlight      int        `json:"inFlight"`
+	DeadLetters   int        `json:"deadLetters"`
+	Unknown       int        `json:"unknown"`
+	Delivered     int        `json:"delivered"`
+	OldestPending *time.Time `json:"oldestPending,omitempty"`
+}
+
+// Outbox is a write-ahead queue for telemetry. Readings are persisted before
+// they are acknowledged and submitted to the ledger in the background, so a
+// peer or orderer outage delays them instead of losing them. A reading whose
+// transaction may have reached the orderer is not submitted again: it is held
+// as UNKNOWN until an operator has checked its txId and resolved it. A crash
+// between commit and the outbox update still submits the reading twice.
+type Outbox struct {
+	store     *store
+	submitter Submitter
+	config    Config
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	// dispatching tracks the dispatch loop and deliveries the submissions
+	// it started. Submissions run on submitCtx, which is only cancelled when
+	// Shutdown gives up waiting for them.
+	dispatching sync.WaitGroup
+	deliveries  sync.WaitGroup
+	submitCtx   context.Context
+	abort       context.CancelFunc
+}
+
+// Open opens the outbox file at path and starts delivering pending items
+func Open(path string, submitter Submitter, config Config) (*Outbox, error) {
+	store, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	submitCtx, abort := context.WithCancel(context.Background())
+	o := &Outbox{
+		store:     store,
+		submitter: submitter,
+		config:    config,
+		inFlight:  make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		submitCtx: submitCtx,
+		abort:     abort,
+	}
+
+	o.dispatching.Add(1)
+	go o.dispatch()
+
+	if pending, err := store.count(StatusPending); err == nil && pending > 0 {
+		slog.Info("resuming outbox delivery", "pending", pending)
+	}
+	return o, nil
+}
+
+// Enqueue persists a reading for delivery. userID is the backend user it is
+// submitted for, or "" for the organization itself.
+func (o *Outbox) Enqueue(carID, carData, userID string) (*Item, error) {
+	now := time.Now().UTC()
+	item := &Item{
+		CarID:     carID,
+		CarData:   carData,
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.store.add(item); err != nil {
+		return nil, fmt.Errorf("failed to persist reading: %w", err)
+	}
+
+	o.notify()
+	return item, nil
+}
+
+// Get returns an item in any state, or nil if the ID is unknown or the
+// delivered item has been pruned
+func (o *Outbox) Get(id string) (*Item, error) {
+	return o.store.get(id)
+}
+
+// Stats reports queue depth, in-flight submissions and dead letters
+func (o *Outbox) Stats() (Stats, error) {
+	var stats Stats
+	var err error
+	if stats.Pending, err = o.store.count(StatusPending); err != nil {
+		return stats, err
+	}
+	if stats.DeadLetters, err = o.store.count(StatusDead); err != nil {
+		return stats, err
+	}
+	if stats.Unknown, err = o.store.count(StatusUnknown); err != nil {
+		return stats, err
+	}
+	if stats.Delivered, err = o.store.count(StatusDelivered); err != nil {
+		return stats, err
+	}
+	if stats.OldestPending, err = o.store.oldestPending(); err != nil {
+		return stats, err
+	}
+
+	o.mu.Lock()
+	stats.InFlight = len(o.inFlight)
+	o.mu.Unlock()
+	return stats, nil
+}
+
+// DeadLetters returns the items that could not be delivered
+func (o *Outbox) DeadLetters() ([]*Item, error) {
+	return o.store.list(StatusDead)
+}
+
+// Replay moves a dead-lettered item back to the queue with its attempts
+// reset. It keeps its original position relative to the car's other readings.
+func (o *Outbox) Replay(id string) (*Item, error) {
+	item, err := o.deadLetter(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Status = StatusPending
+	item.Attempts = 0
+	item.NextAttemptAt = nil
+	item.UpdatedAt = time.Now().UTC()
+	if err := o.store.move(item, StatusDead); err != nil {
+		return nil, err
+	}
+
+	o.notify()
+	return item, nil
+}
+
+// Discard deletes a dead-lettered item
+func (o *Outbox) Discard(id string) error {
+	item, err := o.deadLetter(id)
+	if err != nil {
+		return err
+	}
+	return o.store.remove(item)
+}
+
+// Unknown returns the items whose transaction may or may not have committed
+func (o *Outbox) Unknown() ([]*Item, error) {
+	return o.store.list(StatusUnknown)
+}
+
+// Resolve settles an item in doubt once its transaction has been looked up.
+// A committed item is marked delivered, with txID if it had none; otherwise
+// it is queued again.
+func (o *Outbox) Resolve(id string, committed bool, txID string) (*Item, error) {
+	item, err := o.held(id, StatusUnknown)
+	if err != nil {
+		return nil, err
+	}
+
+	item.UpdatedAt = time.Now().UTC()
+	item.NextAttemptAt = nil
+	if committed {
+		if txID != "" {
+			item.TxID = txID
+		}
+		if item.TxID == "" {
+			return nil, ErrNoTxID
+		}
+		item.Status = StatusDelivered
+		item.LastError, item.LastErrorCode = "", ""
+	} else {
+		item.Status = StatusPending
+		item.Attempts = 0
+	}
+	if err := o.store.move(item, StatusUnknown); err != nil {
+		return nil, err
+	}
+
+	o.notify()
+	return item, nil
+}
+
+func (o *Outbox) deadLetter(id string) (*Item, error) {
+	return o.held(id, StatusDead)
+}
+
+// held returns the item with the given ID if it has status
+func (o *Outbox) held(id, status string) (*Item, error) {
+	item, err := o.store.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Status != status {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// Shutdown stops dispatching, lets the submissions in progress finish until
+// ctx expires and then closes the outbox file. Pending items are delivered
+// after the next start.
+func (o *Outbox) Shutdown(ctx context.Context) error {
+	o.cancel()
+	o.dispatching.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		o.deliveries.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		o.abort()
+		<-drained
+		err = fmt.Errorf("outbox did not drain: %w", ctx.Err())
+	}
+
+	if closeErr := o.store.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts a delivery for the oldest pending item of each car that
+// is due and has nothing in flight, up to the configured number of workers
+func (o *Outbox) dispatch() {
+	defer o.dispatching.Done()
+
+	lastPrune := time.Time{}
+	for {
+		if time.Since(lastPrune) >= pruneInterval {
+			if pruned, err := o.store.pruneDelivered(time.Now().Add(-o.config.Retention)); err != nil {
+				slog.Error("failed to prune outbox", "error", err)
+			} else if pruned > 0 {
+				slog.Debug("pruned delivered outbox items", "count", pruned)
+			}
+			lastPrune = time.Now()
+		}
+
+		if err := o.startDue(); err != nil {
+			slog.Error("failed to read outbox", "error", err)
+		}
+
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (o *Outbox) startDue() error {
+	pending, err := o.store.list(StatusPending)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, item := range pending {
+		if len(o.inFlight) >= o.config.Workers {
+			return nil
+		}
+		// Only the oldest pending reading of a car may be submitted
+		if seen[item.CarID] {
+			continue
+		}
+		seen[item.CarID] = true
+
+		if o.inFlight[item.CarID] || (item.NextAttemptAt != nil && now.Before(*item.NextAttemptAt)) {
+			continue
+		}
+
+		o.inFlight[item.CarID] = true
+		o.deliveries.Add(1)
+		go o.deliver(item)
+	}
+	return nil
+}
+
+func (o *Outbox) deliver(item *Item) {
+	defer o.deliveries.Done()
+	defer func() {
+		o.mu.Lock()
+		delete(o.inFlight, item.CarID)
+		o.mu.Unlock()
+		o.notify()
+	}()
+
+	txID, err := o.submitter.SubmitTransaction(fabric.WithUser(o.submitCtx, item.UserID), submitFunction, item.CarID, item.CarData)
+	now := time.Now().UTC()
+	item.UpdatedAt = now
+
+	if err == nil {
+		item.Status = StatusDelivered
+		item.TxID = txID
+		item.LastError, item.LastErrorCode, item.NextAttemptAt = "", "", nil
+		o.save(item)
+		return
+	}
+
+	// Submissions refused by shutdown are not the item's fault; it stays
+	// pending as it was and is attempted after the next start
+	if errors.Is(err, fabric.ErrShuttingDown) {
+		return
+	}
+
+	fabricErr := fabric.ClassifyError(err)
+	item.Attempts++
+	item.LastError = fabricErr.Message
+	item.LastErrorCode = fabricErr.Code
+	item.TxID = fabricErr.TxID
+
+	// Submitting again could commit the reading twice. A submission abandoned
+	// at shutdown may be running still, so it is in doubt as well.
+	if fabric.MayBeOrdered(err) || o.submitCtx.Err() != nil {
+		item.Status = StatusUnknown
+		item.NextAttemptAt = nil
+		slog.Warn("outbox item may have been submitted, held for checking", "itemId", item.ID, "carId", item.CarID, "txId", item.TxID, "code", fabricErr.Code)
+	} else if !retryable(fabricErr.Code) || item.Attempts >= o.config.MaxAttempts {
+		item.Status = StatusDead
+		item.NextAttemptAt = nil
+		slog.Warn("outbox item dead-lettered", "itemId", item.ID, "carId", item.CarID, "attempts", item.Attempts, "code", fabricErr.Code)
+	} else {
+		next := now.Add(o.backoff(item.Attempts))
+		item.NextAttemptAt = &next
+		slog.Info("outbox delivery failed, will retry", "itemId", item.ID, "carId", item.CarID, "attempts", item.Attempts, "code", fabricErr.Code, "retryAt", next)
+	}
+	o.save(item)
+}
+
+func (o *Outbox) save(item *Item) {
+	if err := o.store.move(item, StatusPending); err != nil {
+		slog.Error("failed to update outbox item", "itemId", item.ID, "error", err)
+	}
+}
+
+// retryable reports whether a failure may succeed later without changes to
+// the reading. Chaincode and endorsement policy errors will not. Failures
+// after the transaction may have been ordered never get here.
+func retryable(code string) bool {
+	switch code {
+	case fabric.ErrCodeUnavailable, fabric.ErrCodeTimeout, fabric.ErrCodeMVCCConflict,
+		fabric.ErrCodeTxInvalid, fabric.ErrCodeQueueFull, fabric.ErrCodeInternal:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the delay with each attempt, with jitter, up to MaxDelay
+func (o *Outbox) backoff(attempt int) time.Duration {
+	delay := o.config.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > o.config.MaxDelay {
+		delay = o.config.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,258 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Item states. Items move between buckets of the same name.
+const (
+	StatusPending   = "PENDING"
+	StatusDelivered = "DELIVERED"
+	StatusDead      = "DEAD"
+	// StatusUnknown items may or may not be on the ledger and wait for an
+	// operator to check their txId
+	StatusUnknown = "UNKNOWN"
+)
+
+var (
+	pendingBucket   = []byte("pending")
+	deliveredBucket = []byte("delivered")
+	deadBucket      = []byte("dead")
+	unknownBucket   = []byte("unknown")
+)
+
+var statusBuckets = map[string][]byte{
+	StatusPending:   pendingBucket,
+	StatusDelivered: deliveredBucket,
+	StatusDead:      deadBucket,
+	StatusUnknown:   unknownBucket,
+}
+
+// Item is a telemetry reading accepted by the gateway and not necessarily
+// on the ledger yet
+type Item struct {
+	ID            string     `json:"id"`
+	CarID         string     `json:"carId"`
+	CarData       string     `json:"carData"`
+	UserID        string     `json:"userId,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorCode string     `json:"lastErrorCode,omitempty"`
+	TxID          string     `json:"txId,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+
+	seq uint64
+}
+
+// store keeps items in bbolt keyed by a big-endian sequence number, so a
+// cursor walks each bucket in acceptance order
+type store struct {
+	db *bolt.DB
+}
+
+func openStore(path string) (*store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range statusBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise outbox: %w", err)
+	}
+
+	return &store{db: db}, nil
+}
+
+// add persists a new pending item and assigns its ID. The ID starts with the
+// hex sequence number, followed by random bytes so IDs cannot be guessed.
+func (s *store) add(item *Item) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		item.seq = seq
+		item.ID = fmt.Sprintf("%016x%s", seq, hex.EncodeToString(suffix))
+		item.Status = StatusPending
+		return putItem(bucket, item)
+	})
+}
+
+// move stores item under its new status, removing it from the old bucket
+func (s *store) move(item *Item, from string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if from != item.Status {
+			if err := tx.Bucket(statusBuckets[from]).Delete(seqKey(item.seq)); err != nil {
+				return err
+			}
+		}
+		return putItem(tx.Bucket(statusBuckets[item.Status]), item)
+	})
+}
+
+// get returns the item with the given ID from any bucket, or nil
+func (s *store) get(id string) (*Item, error) {
+	if len(id) < 16 {
+		return nil, nil
+	}
+	seq, err := strconv.ParseUint(id[:16], 16, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	var item *Item
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range statusBuckets {
+			data := tx.Bucket(name).Get(seqKey(seq))
+			if data == nil {
+				continue
+			}
+			found, err := decodeItem(seq, data)
+			if err != nil {
+				return err
+			}
+			if found.ID == id {
+				item = found
+			}
+			return nil
+		}
+		return nil
+	})
+	return item, err
+}
+
+// list returns the items with status in sequence order
+func (s *store) list(status string) ([]*Item, error) {
+	var items []*Item
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusBuckets[status]).ForEach(func(key, data []byte) error {
+			item, err := decodeItem(binary.BigEndian.Uint64(key), data)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (s *store) count(status string) (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(statusBuckets[status]).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// oldestPending returns when the oldest pending item was accepted
+func (s *store) oldestPending() (*time.Time, error) {
+	var oldest *time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key, data := tx.Bucket(pendingBucket).Cursor().First()
+		if key == nil {
+			return nil
+		}
+		item, err := decodeItem(binary.BigEndian.Uint64(key), data)
+		if err != nil {
+			return err
+		}
+		oldest = &item.CreatedAt
+		return nil
+	})
+	return oldest, err
+}
+
+// pruneDelivered removes delivered items last updated before cutoff
+func (s *store) pruneDelivered(cutoff time.Time) (int, error) {
+	var expired [][]byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deliveredBucket)
+		err := bucket.ForEach(func(key, data []byte) error {
+			item, err := decodeItem(binary.BigEndian.Uint64(key), data)
+			if err != nil {
+				return err
+			}
+			if item.UpdatedAt.Before(cutoff) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Deleting while iterating skips keys, so delete afterwards
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(expired), err
+}
+
+// remove deletes an item from the bucket of its status
+func (s *store) remove(item *Item) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusBuckets[item.Status]).Delete(seqKey(item.seq))
+	})
+}
+
+func (s *store) close() error {
+	return s.db.Close()
+}
+
+func putItem(bucket *bolt.Bucket, item *Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(seqKey(item.seq), data)
+}
+
+func decodeItem(seq uint64, data []byte) (*Item, error) {
+	item := &Item{seq: seq}
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
@@ -28,6 +28,9 @@ mkdir -p "${CODE_DIR}"
 # Copy connection.json to code directory
 cp "${CHAINCODE_DIR}/connection.json" "${CODE_DIR}/connection.json"
 
+# The peer creates the CouchDB indexes it finds under META-INF
+cp -r "${CHAINCODE_DIR}/META-INF" "${CODE_DIR}/META-INF"
+
 print_step "Creating metadata.json..."
 cat > "${TMP_DIR}/metadata.json" << EOF
 {
@@ -38,7 +41,7 @@ EOF
 
 print_step "Packaging code.tar.gz..."
 cd "${CODE_DIR}"
-tar -czf "${TMP_DIR}/code.tar.gz" connection.json
+tar -czf "${TMP_DIR}/code.tar.gz" connection.json META-INF
 
 print_step "Creating final chaincode package..."
 cd "${TMP_DIR}"
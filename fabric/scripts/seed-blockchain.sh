@@ -7,6 +7,14 @@ YELLOW='\033[1;33m'
 NC='\033[0m'
 
 API_URL="${API_URL:-http://localhost:3001}"
+# Key from /admin/keys, needed unless the gateway runs with API_AUTH=disabled.
+# It must be allowed to act for user 1, who owns the seeded vehicles.
+API_KEY="${API_KEY:-}"
+
+AUTH=()
+if [ -n "$API_KEY" ]; then
+    AUTH=(-H "X-API-Key: $API_KEY")
+fi
 
 print_step() {
     echo -e "${GREEN}===> $1${NC}"
@@ -21,6 +29,7 @@ submit_telemetry() {
 
     response=$(curl -s -X POST "$API_URL/api/telemetry/submit" \
         -H "Content-Type: application/json" \
+        "${AUTH[@]}" \
         -d "$payload")
 
     success=$(echo "$response" | jq -r '.success // false')
@@ -31,6 +40,30 @@ submit_telemetry() {
     fi
 }
 
+# Telemetry is only accepted for registered vehicles
+register_vehicle() {
+    local onChainId="$1"
+    local vin="$2"
+    local ownerUserId="$3"
+
+    payload=$(jq -n --arg onChainId "$onChainId" --arg vin "$vin" --arg ownerUserId "$ownerUserId" \
+        '{onChainId: $onChainId, vin: $vin, ownerUserId: $ownerUserId}')
+
+    # Only the owner may register a vehicle, so act for them
+    response=$(curl -s -X POST "$API_URL/api/vehicles" \
+        -H "Content-Type: application/json" \
+        -H "X-User-Id: $ownerUserId" \
+        "${AUTH[@]}" \
+        -d "$payload")
+
+    success=$(echo "$response" | jq -r '.success // false')
+    if [ "$success" = "true" ]; then
+        echo -e "  ${GREEN}OK${NC} - Car $onChainId registered"
+    else
+        echo -e "  ${YELLOW}SKIP${NC} - Car $onChainId: $(echo "$response" | jq -r '.error // "Unknown error"')"
+    fi
+}
+
 print_step "Seeding Blockchain with Telemetry Data"
 echo "API URL: $API_URL"
 echo ""
@@ -44,6 +77,11 @@ fi
 echo "Gateway healthy"
 echo ""
 
+print_step "Registering vehicles..."
+register_vehicle "1" "SEEDVIN0000000001" "1"
+register_vehicle "2" "SEEDVIN0000000002" "1"
+echo ""
+
 print_step "Seeding Car 1 (Toyota Camry)"
 echo ""
 
@@ -195,15 +233,16 @@ submit_telemetry "2" '{"SensorDataId": "25f9598d-fb4a-436c-95be-9a29eee535a9", "
 print_step "Seeding complete!"
 echo ""
 
+# Telemetry of registered vehicles is only shown to users with a role on them
 echo "Car 1 records:"
-curl -s "$API_URL/api/telemetry/vehicle/1" | jq 'length'
+curl -s "$API_URL/api/telemetry/vehicle/1" -H "X-User-Id: 1" "${AUTH[@]}" | jq 'length'
 
 echo "Car 2 records:"
-curl -s "$API_URL/api/telemetry/vehicle/2" | jq 'length'
+curl -s "$API_URL/api/telemetry/vehicle/2" -H "X-User-Id: 1" "${AUTH[@]}" | jq 'length'
 
 echo ""
 echo "Total records:"
-curl -s "$API_URL/api/telemetry/all" | jq 'length'
+curl -s "$API_URL/api/telemetry/all" -H "X-User-Id: 1" "${AUTH[@]}" | jq 'length'
 
 echo ""
 print_step "Blockchain seeded with 122 telemetry records"
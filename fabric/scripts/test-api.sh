@@ -7,15 +7,39 @@ RED='\033[0;31m'
 NC='\033[0m'
 
 API_URL="http://localhost:3001"
+# A client key is created with ADMIN_API_KEY unless API_KEY is given
+ADMIN_API_KEY="${ADMIN_API_KEY:-}"
+API_KEY="${API_KEY:-}"
+# The test vehicles are registered to this user, and every request acts for it
+USER_ID="${USER_ID:-1}"
 
 echo -e "${GREEN}Testing Fabric Gateway Telemetry API${NC}"
 echo "=================================="
 
 echo -e "\n${GREEN}1. Health check...${NC}"
-curl -s "$API_URL/health" | jq .
+curl -s "$API_URL/health/live" | jq .
+curl -s "$API_URL/health/ready" | jq .
+
+if [ -z "$API_KEY" ] && [ -n "$ADMIN_API_KEY" ]; then
+    echo -e "\n${GREEN}Creating an API key...${NC}"
+    API_KEY=$(curl -s -X POST "$API_URL/admin/keys" \
+        -H "X-API-Key: $ADMIN_API_KEY" \
+        -H "Content-Type: application/json" \
+        -d '{"name": "test-api", "routes": ["/api/*"], "vehicles": ["*"], "users": ["*"], "ratePerSecond": 10, "burst": 20}' | jq -r .key)
+fi
+AUTH=(-H "X-API-Key: $API_KEY" -H "X-User-Id: $USER_ID")
+
+# Telemetry is only accepted for registered vehicles. A second run finds them
+# registered already, which is reported and ignored.
+echo -e "\n${GREEN}Registering cars 1 and 2...${NC}"
+for carId in 1 2; do
+    curl -s -X POST "${AUTH[@]}" "$API_URL/api/vehicles" \
+        -H "Content-Type: application/json" \
+        -d "{\"onChainId\": \"$carId\", \"vin\": \"TESTVIN000000000$carId\", \"ownerUserId\": \"$USER_ID\"}" | jq .
+done
 
 echo -e "\n${GREEN}2. Submitting telemetry for car 1...${NC}"
-curl -s -X POST "$API_URL/api/telemetry/submit" \
+curl -s -X POST "${AUTH[@]}" "$API_URL/api/telemetry/submit" \
     -H "Content-Type: application/json" \
     -d '{
         "carId": "1",
@@ -23,7 +47,7 @@ curl -s -X POST "$API_URL/api/telemetry/submit" \
     }' | jq .
 
 echo -e "\n${GREEN}3. Submitting telemetry for car 2...${NC}"
-curl -s -X POST "$API_URL/api/telemetry/submit" \
+curl -s -X POST "${AUTH[@]}" "$API_URL/api/telemetry/submit" \
     -H "Content-Type: application/json" \
     -d '{
         "carId": "2",
@@ -31,15 +55,39 @@ curl -s -X POST "$API_URL/api/telemetry/submit" \
     }' | jq .
 
 echo -e "\n${GREEN}4. Getting telemetry for car 1...${NC}"
-curl -s "$API_URL/api/telemetry/vehicle/1" | jq .
+curl -s "${AUTH[@]}" "$API_URL/api/telemetry/vehicle/1" | jq .
 
 echo -e "\n${GREEN}5. Getting all telemetry...${NC}"
-curl -s "$API_URL/api/telemetry/all" | jq .
+curl -s "${AUTH[@]}" "$API_URL/api/telemetry/all" | jq .
 
 echo -e "\n${GREEN}6. Getting telemetry after timestamp...${NC}"
-curl -s "$API_URL/api/telemetry/after?timestamp=2024-01-01T00:00:00Z" | jq .
+curl -s "${AUTH[@]}" "$API_URL/api/telemetry/after?timestamp=2024-01-01T00:00:00Z" | jq .
 
 echo -e "\n${GREEN}7. Getting telemetry by range for car 1...${NC}"
-curl -s "$API_URL/api/telemetry/range?carId=1&startTime=2024-01-01T00:00:00Z&endTime=2030-12-31T23:59:59Z" | jq .
+curl -s "${AUTH[@]}" "$API_URL/api/telemetry/range?carId=1&startTime=2024-01-01T00:00:00Z&endTime=2030-12-31T23:59:59Z" | jq .
+
+echo -e "\n${GREEN}8. Submitting telemetry asynchronously for car 1...${NC}"
+TX_ID=$(curl -s -X POST "${AUTH[@]}" "$API_URL/api/telemetry/submit?async=true" \
+    -H "Content-Type: application/json" \
+    -d '{
+        "carId": "1",
+        "carData": "{\"speed\": 70, \"rpm\": 3100, \"fuel\": 74}"
+    }' | jq -r .txId)
+echo "txId: $TX_ID"
+
+echo -e "\n${GREEN}9. Checking transaction status...${NC}"
+sleep 3
+curl -s "${AUTH[@]}" "$API_URL/api/tx/$TX_ID" | jq .
+
+echo -e "\n${GREEN}10. Submitting an invalid request...${NC}"
+curl -s -X POST "${AUTH[@]}" "$API_URL/api/telemetry/submit" \
+    -H "Content-Type: application/json" \
+    -d '{"carId": ""}' | jq .
+
+echo -e "\n${GREEN}11. Fetching the OpenAPI document...${NC}"
+curl -s "$API_URL/openapi.json" | jq '.paths | keys'
+
+echo -e "\n${GREEN}12. Calling the API without a key...${NC}"
+curl -s "$API_URL/api/telemetry/all" | jq .
 
 echo -e "\n${GREEN}All tests completed!${NC}"